@@ -7,7 +7,11 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+	// the tz database is embedded, so that the timezones of the ports are validated the same way on every host
+	_ "time/tzdata"
 
+	"github.com/CristianCurteanu/koken-api/internal/domains/imports"
 	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
 	"github.com/CristianCurteanu/koken-api/internal/infra/http"
 	"github.com/CristianCurteanu/koken-api/internal/infra/storage/database"
@@ -15,22 +19,55 @@ import (
 )
 
 var (
-	port        *int
-	mongoDbUrl  *string
-	mongoDbName *string
+	port              *int
+	mongoDbUrl        *string
+	mongoDbName       *string
+	importConcurrency *int
+	importBatchSize   *int
+	mongoBulkChunk    *int
+	importRetention   *time.Duration
+	pageSize          *int
+	maxPageSize       *int
+	softDelete        *bool
+	maxDecompressed   *int64
+	normalizeCountry  *bool
 )
 
 func init() {
 	port = flag.Int("port", 8080, "Port on which server will listen for requests")
 	mongoDbName = flag.String("mongo-db-name", "ports", "The database name for MongoDB storage")
 	mongoDbUrl = flag.String("mongo-db-uri", "", "The URL for MongoDB storage")
+	importConcurrency = flag.Int("import-concurrency", ports.DefaultConcurrency, "The maximum number of port batches stored at the same time")
+	importBatchSize = flag.Int("import-batch-size", ports.DefaultBatchSize, "The number of ports stored in a single storage call")
+	pageSize = flag.Int("page-size", ports.DefaultPageSize, "The default number of ports returned by a listing page")
+	maxPageSize = flag.Int("max-page-size", http.DefaultMaxPageSize, "The maximum number of ports returned by a listing page")
+	importRetention = flag.Duration("import-job-retention", imports.DefaultRetention, "How long the finished async import jobs are kept")
+	softDelete = flag.Bool("soft-delete", false, "Mark the deleted ports with a deleted_at timestamp, so that they can be restored, instead of removing them")
+	maxDecompressed = flag.Int64("max-decompressed-size", http.DefaultMaxDecompressedSize, "The maximum size in bytes of a gzip or zstd compressed upload, once it is decompressed")
+	normalizeCountry = flag.Bool("normalize-countries", false, "Recompute the country codes of all the stored ports, and overwrite the ones that differ, or unset the ones that can't be resolved, before serving the requests")
+	mongoBulkChunk = flag.Int("mongo-bulk-chunk-size", database.DefaultBulkChunkSize, "The maximum number of writes sent in a single MongoDB BulkWrite request")
 }
 
 func main() {
 	flag.Parse()
 
+	service := createPortService()
+	if *normalizeCountry {
+		updated, err := service.NormalizeCountries(context.Background())
+		if err != nil {
+			log.Fatalf("[normalize-countries]:\n\tError %q", err.Error())
+		}
+		log.Printf("[normalize-countries]: updated %d ports\n", updated)
+	}
+
+	importJobs := imports.NewManager(*importRetention)
 	app, err := http.BuildApp(*port,
-		http.PortHandlers(createPortService()),
+		http.PortHandlers(service,
+			http.WithImportJobs(importJobs),
+			http.WithPageSize(*pageSize, *maxPageSize),
+			http.WithMaxDecompressedSize(*maxDecompressed),
+		),
+		http.ImportHandlers(importJobs),
 	)
 	if err != nil {
 		panic(err)
@@ -59,13 +96,23 @@ func main() {
 
 // TODO: use a DI container, like wire
 func createPortService() ports.PortService {
+	serviceOptions := []ports.ServiceOption{
+		ports.WithConcurrency(*importConcurrency),
+		ports.WithBatchSize(*importBatchSize),
+		ports.WithSoftDelete(*softDelete),
+	}
+
 	if *mongoDbUrl == "" || *mongoDbName == "" {
-		return ports.NewPortService(ports.NewPortRepository(ports.StorageTypeInMem, inmemory.NewInMemoryStorage()))
+		return ports.NewPortService(ports.NewPortRepository(ports.StorageTypeInMem,
+			inmemory.NewInMemoryStorage(ports.InMemoryIndexes()...),
+		), serviceOptions...)
 	}
 
-	portsDbStorage, err := database.NewMongoDB(context.Background(), *mongoDbUrl, *mongoDbName, "ports")
+	portsDbStorage, err := database.NewMongoDB(context.Background(), *mongoDbUrl, *mongoDbName, "ports",
+		database.WithBulkChunkSize(*mongoBulkChunk),
+	)
 	if err != nil {
 		panic(err)
 	}
-	return ports.NewPortService(ports.NewPortRepository(ports.StorageTypeMongoDB, portsDbStorage))
+	return ports.NewPortService(ports.NewPortRepository(ports.StorageTypeMongoDB, portsDbStorage), serviceOptions...)
 }
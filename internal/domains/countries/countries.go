@@ -0,0 +1,134 @@
+/*
+Package countries is a reference table of the ISO 3166-1 countries, embedded in the binary, with
+a normalizer that maps the names, the common variants of the names, and the country prefixes of
+the UN/LOCODEs to the country codes.
+*/
+package countries
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Country is an ISO 3166-1 country, with its alpha-2 and alpha-3 codes
+type Country struct {
+	Alpha2 string
+	Alpha3 string
+	Name   string
+}
+
+/*
+countries.csv has a row per country, with the alpha-2 code, the alpha-3 code, the short name,
+and the variants of the name, separated by "|"; the variants are the ISO names, when the short
+name is a common one, and the names used in practice, ie. "UAE" or "Holland".
+*/
+//go:embed countries.csv
+var countriesCSV string
+
+var table = mustLoad(countriesCSV)
+
+type countryTable struct {
+	byCode map[string]Country
+	byName map[string]Country
+}
+
+func mustLoad(data string) countryTable {
+	table, err := load(data)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+func load(data string) (countryTable, error) {
+	rows, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		return countryTable{}, fmt.Errorf("reading countries: %w", err)
+	}
+
+	table := countryTable{byCode: make(map[string]Country), byName: make(map[string]Country)}
+	for _, row := range rows[1:] {
+		country := Country{Alpha2: row[0], Alpha3: row[1], Name: row[2]}
+		table.byCode[country.Alpha2] = country
+		table.byCode[country.Alpha3] = country
+
+		names := []string{country.Name}
+		if row[3] != "" {
+			names = append(names, strings.Split(row[3], "|")...)
+		}
+		for _, name := range names {
+			key := fold(name)
+			if other, found := table.byName[key]; found && other != country {
+				return countryTable{}, fmt.Errorf("country name %q is used by both %s and %s", name, other.Alpha2, country.Alpha2)
+			}
+			table.byName[key] = country
+		}
+	}
+	return table, nil
+}
+
+// ByCode returns the country with the ISO 3166-1 alpha-2 or alpha-3 code
+func ByCode(code string) (Country, bool) {
+	country, found := table.byCode[strings.ToUpper(strings.TrimSpace(code))]
+	return country, found
+}
+
+// ByName returns the country with the name, or a variant of it, ignoring the case, the diacritics and the punctuation
+func ByName(name string) (Country, bool) {
+	country, found := table.byName[fold(name)]
+	return country, found
+}
+
+// FromUNLOCODE returns the country of the UN/LOCODE, which starts with the alpha-2 code of the country
+func FromUNLOCODE(code string) (Country, bool) {
+	if len(code) < 2 {
+		return Country{}, false
+	}
+	country, found := table.byCode[strings.ToUpper(code[:2])]
+	return country, found
+}
+
+// Normalize returns the country, that the value refers to, either by name, or by alpha-2 or alpha-3 code
+func Normalize(value string) (Country, bool) {
+	if country, found := ByName(value); found {
+		return country, true
+	}
+	return ByCode(value)
+}
+
+/*
+fold turns the name into the key of the names table: the diacritics are removed, the words are
+lower cased and separated by single spaces, "&" is read as "and", "St" as "Saint", and a
+leading "the" is dropped, so that "St. Kitts & Nevis" and "Saint Kitts and Nevis" are the same.
+*/
+func fold(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r), r == '\'', r == '’':
+			continue
+		case r == '&':
+			b.WriteString(" and ")
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	words := strings.Fields(b.String())
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	for i, word := range words {
+		if word == "st" {
+			words[i] = "saint"
+		}
+	}
+	return strings.Join(words, " ")
+}
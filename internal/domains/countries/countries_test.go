@@ -0,0 +1,68 @@
+package countries
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		value  string
+		alpha2 string
+	}{
+		{"United Arab Emirates", "AE"},
+		{"united arab emirates ", "AE"},
+		{"UAE", "AE"},
+		{"AE", "AE"},
+		{"are", "AE"},
+		{"Russia", "RU"},
+		{"Russian Federation", "RU"},
+		{"Korea, Republic of", "KR"},
+		{"Republic of Korea", "KR"},
+		{"North Korea", "KP"},
+		{"The Netherlands", "NL"},
+		{"Turkey", "TR"},
+		{"Türkiye", "TR"},
+		{"Cote d'Ivoire", "CI"},
+		{"Côte d’Ivoire", "CI"},
+		{"St. Kitts & Nevis", "KN"},
+		{"United States of America", "US"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			country, found := Normalize(tt.value)
+			require.True(t, found)
+			require.Equal(t, tt.alpha2, country.Alpha2)
+		})
+	}
+
+	t.Run("return both codes", func(t *testing.T) {
+		country, found := Normalize("Brazil")
+		require.True(t, found)
+		require.Equal(t, Country{Alpha2: "BR", Alpha3: "BRA", Name: "Brazil"}, country)
+	})
+
+	t.Run("reject unknown country", func(t *testing.T) {
+		for _, value := range []string{"", "Atlantis", "XX", "the"} {
+			_, found := Normalize(value)
+			require.False(t, found, value)
+		}
+	})
+}
+
+func TestFromUNLOCODE(t *testing.T) {
+	country, found := FromUNLOCODE("AEDXB")
+	require.True(t, found)
+	require.Equal(t, "ARE", country.Alpha3)
+
+	_, found = FromUNLOCODE("XZ001")
+	require.False(t, found)
+}
+
+func TestLoad(t *testing.T) {
+	require.Len(t, table.byCode, 2*249)
+
+	_, err := load("alpha2,alpha3,name,variants\nCG,COG,Congo,\nCD,COD,DR Congo,Congo\n")
+	require.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package imports
+
+import (
+	"context"
+	"time"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+)
+
+type State string
+
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateCompleted State = "completed"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Job is a snapshot of an import, that runs in background
+type Job struct {
+	ID         string
+	State      State
+	Progress   ports.ImportResult
+	Error      string
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Finished returns true if the job is not going to change its state anymore
+func (j Job) Finished() bool {
+	return j.State == StateCompleted || j.State == StateFailed || j.State == StateCancelled
+}
+
+// RunFunc runs the import, and reports the intermediate results through progress
+type RunFunc func(ctx context.Context, progress func(ports.ImportResult)) (ports.ImportResult, error)
@@ -0,0 +1,162 @@
+package imports
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+)
+
+var (
+	ErrJobNotFound = errors.New("import job not found")
+	ErrJobFinished = errors.New("import job is already finished")
+)
+
+const DefaultRetention = time.Hour
+
+/*
+Manager keeps track of the imports, that run in background in the current process.
+Finished jobs are kept for the retention period, so that their status can be
+checked, and are dropped afterwards.
+*/
+type Manager struct {
+	mx        *sync.Mutex
+	jobs      map[string]*trackedJob
+	retention time.Duration
+	now       func() time.Time
+}
+
+type trackedJob struct {
+	job    Job
+	cancel context.CancelFunc
+}
+
+func NewManager(retention time.Duration) *Manager {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	return &Manager{
+		mx:        &sync.Mutex{},
+		jobs:      make(map[string]*trackedJob),
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// Start runs the import in a new goroutine, and returns the job that tracks it
+func (m *Manager) Start(run RunFunc) (Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tracked := &trackedJob{
+		job: Job{
+			ID:        id,
+			State:     StatePending,
+			CreatedAt: m.now(),
+		},
+		cancel: cancel,
+	}
+
+	m.mx.Lock()
+	m.pruneExpired()
+	m.jobs[id] = tracked
+	job := tracked.job
+	m.mx.Unlock()
+
+	go m.run(ctx, tracked, run)
+
+	return job, nil
+}
+
+func (m *Manager) run(ctx context.Context, tracked *trackedJob, run RunFunc) {
+	defer tracked.cancel()
+
+	m.update(tracked, func(job *Job) {
+		job.State = StateRunning
+		job.StartedAt = m.now()
+	})
+
+	result, err := run(ctx, func(progress ports.ImportResult) {
+		m.update(tracked, func(job *Job) {
+			job.Progress = progress
+		})
+	})
+
+	m.update(tracked, func(job *Job) {
+		job.Progress = result
+		job.FinishedAt = m.now()
+
+		switch {
+		case errors.Is(err, context.Canceled):
+			job.State = StateCancelled
+		case err != nil:
+			job.State = StateFailed
+			job.Error = err.Error()
+		default:
+			job.State = StateCompleted
+		}
+	})
+}
+
+func (m *Manager) update(tracked *trackedJob, fn func(*Job)) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	fn(&tracked.job)
+}
+
+func (m *Manager) Get(id string) (Job, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.pruneExpired()
+	tracked, found := m.jobs[id]
+	if !found {
+		return Job{}, ErrJobNotFound
+	}
+	return tracked.job, nil
+}
+
+// Cancel stops the import through its context; the job is marked as cancelled once the import returns
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.pruneExpired()
+	tracked, found := m.jobs[id]
+	if !found {
+		return Job{}, ErrJobNotFound
+	}
+	if tracked.job.Finished() {
+		return tracked.job, ErrJobFinished
+	}
+
+	tracked.cancel()
+	return tracked.job, nil
+}
+
+// pruneExpired drops the jobs finished earlier than the retention period; it should be called holding the lock
+func (m *Manager) pruneExpired() {
+	expiry := m.now().Add(-m.retention)
+	for id, tracked := range m.jobs {
+		if tracked.job.Finished() && tracked.job.FinishedAt.Before(expiry) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
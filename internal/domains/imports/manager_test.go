@@ -0,0 +1,91 @@
+package imports
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/stretchr/testify/require"
+)
+
+func waitFinished(t *testing.T, m *Manager, id string) Job {
+	var job Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = m.Get(id)
+		require.NoError(t, err)
+		return job.Finished()
+	}, time.Second, time.Millisecond)
+	return job
+}
+
+func TestManager(t *testing.T) {
+	t.Run("complete job with the import result", func(t *testing.T) {
+		m := NewManager(time.Hour)
+
+		job, err := m.Start(func(ctx context.Context, progress func(ports.ImportResult)) (ports.ImportResult, error) {
+			progress(ports.ImportResult{Created: 1})
+			return ports.ImportResult{Created: 2, Failed: 1}, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, StatePending, job.State)
+
+		job = waitFinished(t, m, job.ID)
+		require.Equal(t, StateCompleted, job.State)
+		require.Equal(t, 2, job.Progress.Created)
+		require.False(t, job.FinishedAt.IsZero())
+	})
+
+	t.Run("fail job if import fails", func(t *testing.T) {
+		m := NewManager(time.Hour)
+
+		job, err := m.Start(func(ctx context.Context, progress func(ports.ImportResult)) (ports.ImportResult, error) {
+			return ports.ImportResult{}, errors.New("bad json")
+		})
+		require.NoError(t, err)
+
+		job = waitFinished(t, m, job.ID)
+		require.Equal(t, StateFailed, job.State)
+		require.Equal(t, "bad json", job.Error)
+	})
+
+	t.Run("cancel running job through context", func(t *testing.T) {
+		m := NewManager(time.Hour)
+		started := make(chan struct{})
+
+		job, err := m.Start(func(ctx context.Context, progress func(ports.ImportResult)) (ports.ImportResult, error) {
+			close(started)
+			<-ctx.Done()
+			return ports.ImportResult{}, ctx.Err()
+		})
+		require.NoError(t, err)
+		<-started
+
+		_, err = m.Cancel(job.ID)
+		require.NoError(t, err)
+
+		job = waitFinished(t, m, job.ID)
+		require.Equal(t, StateCancelled, job.State)
+
+		_, err = m.Cancel(job.ID)
+		require.ErrorIs(t, err, ErrJobFinished)
+	})
+
+	t.Run("drop finished jobs after retention", func(t *testing.T) {
+		m := NewManager(time.Minute)
+		now := time.Now()
+		m.now = func() time.Time { return now }
+
+		job, err := m.Start(func(ctx context.Context, progress func(ports.ImportResult)) (ports.ImportResult, error) {
+			return ports.ImportResult{}, nil
+		})
+		require.NoError(t, err)
+		waitFinished(t, m, job.ID)
+
+		now = now.Add(2 * time.Minute)
+		_, err = m.Get(job.ID)
+		require.ErrorIs(t, err, ErrJobNotFound)
+	})
+}
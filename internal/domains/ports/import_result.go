@@ -0,0 +1,105 @@
+package ports
+
+import (
+	"sync"
+
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
+)
+
+// MaxImportFailures caps the failures, and the warnings, listed in an ImportResult, so that a file, where every port fails, is not held in memory
+const MaxImportFailures = 1000
+
+// ImportResult reports the outcome of storing many ports, record by record
+type ImportResult struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	Failed    int
+	Failures  []ImportFailure
+	// OmittedFailures is the number of failures past MaxImportFailures, that are counted in Failed, but not listed
+	OmittedFailures int
+	// Warnings are the issues of the stored ports, that are likely mistakes in the data, ie. a country, that doesn't match the port code
+	Warnings []ValidationError
+	// OmittedWarnings is the number of warnings past MaxImportFailures, that are not listed
+	OmittedWarnings int
+	// Removed are the codes of the ports removed in replace mode, because they were missing from the source
+	Removed []string
+	// RemovalSkipped is set in replace mode, if nothing was removed, because some ports of the source failed
+	RemovalSkipped bool
+}
+
+// ImportFailure describes a port, that could not be stored
+type ImportFailure struct {
+	PortCode string
+	// Line is the line of the port in the source, if the source is read by lines
+	Line   int
+	Reason string
+}
+
+// Stored returns the number of ports, that are stored after the import
+func (ir ImportResult) Stored() int {
+	return ir.Created + ir.Updated + ir.Unchanged
+}
+
+// importResultCollector merges the results of the batches, that are stored concurrently
+type importResultCollector struct {
+	mx       sync.Mutex
+	result   ImportResult
+	progress func(ImportResult)
+}
+
+func (c *importResultCollector) addBatch(ports []Port, res storage.BulkUpsertResult) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.result.Created += res.Created
+	c.result.Updated += res.Updated
+	c.result.Unchanged += res.Unchanged
+	for _, failure := range res.Failures {
+		c.fail(ImportFailure{PortCode: ports[failure.Index].PortCode, Reason: failure.Err.Error()})
+	}
+	c.reportProgress()
+}
+
+// failRecord reports a single record of the source, that was not stored, ie. because it is malformed, or not valid
+func (c *importResultCollector) failRecord(failure ImportFailure) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.fail(failure)
+}
+
+func (c *importResultCollector) warn(warnings []ValidationError) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	for _, warning := range warnings {
+		if len(c.result.Warnings) >= MaxImportFailures {
+			c.result.OmittedWarnings++
+			continue
+		}
+		c.result.Warnings = append(c.result.Warnings, warning)
+	}
+}
+
+func (c *importResultCollector) reportProgress() {
+	if c.progress != nil {
+		c.progress(c.result)
+	}
+}
+
+func (c *importResultCollector) fail(failure ImportFailure) {
+	c.result.Failed++
+	if len(c.result.Failures) >= MaxImportFailures {
+		c.result.OmittedFailures++
+		return
+	}
+	c.result.Failures = append(c.result.Failures, failure)
+}
+
+func (c *importResultCollector) get() ImportResult {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.result
+}
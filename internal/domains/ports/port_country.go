@@ -0,0 +1,44 @@
+package ports
+
+import (
+	"fmt"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/countries"
+)
+
+/*
+normalizeCountry sets the country code of the port from its country name; if the name is not
+known, the country code is taken from the port code, as UN/LOCODEs start with the alpha-2 code
+of the country.
+*/
+func normalizeCountry(port Port) Port {
+	if country, found := countries.Normalize(port.Country); found {
+		port.CountryCode = country.Alpha2
+	} else if country, found := countries.FromUNLOCODE(port.PortCode); found {
+		port.CountryCode = country.Alpha2
+	} else {
+		port.CountryCode = ""
+	}
+	return port
+}
+
+// Warn checks the port for the issues, that don't prevent it from being stored, but are likely mistakes in the data
+func Warn(port Port) []ValidationError {
+	var warnings []ValidationError
+	warn := func(field, message string) {
+		warnings = append(warnings, ValidationError{PortCode: port.PortCode, Field: field, Message: message})
+	}
+
+	if port.Country == "" {
+		return nil
+	}
+	country, found := countries.Normalize(port.Country)
+	if !found {
+		warn("country", "is not a known country")
+		return warnings
+	}
+	if codeCountry, found := countries.FromUNLOCODE(port.PortCode); found && codeCountry != country {
+		warn("country", fmt.Sprintf("is %s, but the port code is from %s", country.Alpha2, codeCountry.Alpha2))
+	}
+	return warnings
+}
@@ -0,0 +1,34 @@
+package ports
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeCountry(t *testing.T) {
+	t.Run("set code from country name", func(t *testing.T) {
+		port := normalizeCountry(Port{PortCode: "AEDXB", Country: "Oman"})
+		require.Equal(t, "OM", port.CountryCode)
+	})
+
+	t.Run("set code from port code if country is not known", func(t *testing.T) {
+		port := normalizeCountry(Port{PortCode: "AEDXB", Country: "Emirates of Arabia"})
+		require.Equal(t, "AE", port.CountryCode)
+	})
+
+	t.Run("clear code if country is not known", func(t *testing.T) {
+		port := normalizeCountry(Port{PortCode: "XZ001", Country: "High Seas", CountryCode: "AE"})
+		require.Empty(t, port.CountryCode)
+	})
+}
+
+func TestWarn(t *testing.T) {
+	require.Empty(t, Warn(Port{PortCode: "AEDXB", Country: "UAE"}))
+	require.Equal(t, []ValidationError{
+		{PortCode: "AEDXB", Field: "country", Message: "is OM, but the port code is from AE"},
+	}, Warn(Port{PortCode: "AEDXB", Country: "Oman"}))
+	require.Equal(t, []ValidationError{
+		{PortCode: "AEDXB", Field: "country", Message: "is not a known country"},
+	}, Warn(Port{PortCode: "AEDXB", Country: "Emirates of Arabia"}))
+}
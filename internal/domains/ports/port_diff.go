@@ -0,0 +1,101 @@
+package ports
+
+import "reflect"
+
+// ValidationReport tells what an import of the ports would change, without writing them
+type ValidationReport struct {
+	New       []string
+	Changed   []PortChange
+	Unchanged []string
+	// Errors are the broken validation rules, and the malformed records; the invalid ports are left out of the changes
+	Errors []ValidationError
+	// Warnings are the issues, that don't prevent the ports from being imported
+	Warnings []ValidationError
+	// Invalid is the number of ports, that have errors, including the ones with omitted errors
+	Invalid int
+	// OmittedErrors and OmittedWarnings are the numbers of errors and warnings past MaxImportFailures, that are not listed
+	OmittedErrors   int
+	OmittedWarnings int
+	// OmittedNew, OmittedChanged and OmittedUnchanged are the numbers of ports past MaxImportFailures, that are not listed
+	OmittedNew       int
+	OmittedChanged   int
+	OmittedUnchanged int
+}
+
+func (vr ValidationReport) Valid() bool {
+	return vr.Invalid == 0
+}
+
+// invalid reports the errors of a port, that is left out of the changes
+func (vr *ValidationReport) invalid(errs []ValidationError) {
+	vr.Invalid++
+	vr.Errors, vr.OmittedErrors = appendCapped(vr.Errors, vr.OmittedErrors, errs)
+}
+
+func (vr *ValidationReport) warn(warnings []ValidationError) {
+	vr.Warnings, vr.OmittedWarnings = appendCapped(vr.Warnings, vr.OmittedWarnings, warnings)
+}
+
+// added, changed and unchanged list the port in the report, up to MaxImportFailures listed ports of each kind
+func (vr *ValidationReport) added(code string) {
+	if len(vr.New) >= MaxImportFailures {
+		vr.OmittedNew++
+		return
+	}
+	vr.New = append(vr.New, code)
+}
+
+func (vr *ValidationReport) changed(change PortChange) {
+	if len(vr.Changed) >= MaxImportFailures {
+		vr.OmittedChanged++
+		return
+	}
+	vr.Changed = append(vr.Changed, change)
+}
+
+func (vr *ValidationReport) unchanged(code string) {
+	if len(vr.Unchanged) >= MaxImportFailures {
+		vr.OmittedUnchanged++
+		return
+	}
+	vr.Unchanged = append(vr.Unchanged, code)
+}
+
+// appendCapped appends the errors, up to MaxImportFailures listed ones, and counts the rest as omitted
+func appendCapped(listed []ValidationError, omitted int, errs []ValidationError) ([]ValidationError, int) {
+	for _, err := range errs {
+		if len(listed) >= MaxImportFailures {
+			omitted++
+			continue
+		}
+		listed = append(listed, err)
+	}
+	return listed, omitted
+}
+
+// PortChange lists the fields of a stored port, that would be changed
+type PortChange struct {
+	PortCode string
+	Diffs    []FieldDiff
+}
+
+// FieldDiff is a changed field, with its stored and its new value; a value is nil if the field is not set
+type FieldDiff struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// diffPorts compares the writable fields of the ports, in the order of PortFields
+func diffPorts(stored, port Port) []FieldDiff {
+	oldFields, newFields := stored.AsBson(), port.AsBson()
+
+	var diffs []FieldDiff
+	for _, field := range PortFields {
+		oldValue, newValue := oldFields[field], newFields[field]
+		if !reflect.DeepEqual(oldValue, newValue) {
+			diffs = append(diffs, FieldDiff{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+	return diffs
+}
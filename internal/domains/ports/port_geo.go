@@ -0,0 +1,36 @@
+package ports
+
+import "github.com/CristianCurteanu/koken-api/internal/infra/storage"
+
+const (
+	DefaultNearbyLimit = 10
+	DefaultWithinLimit = 1000
+)
+
+// NearbyQuery selects the ports within RadiusKm kilometers from the location
+type NearbyQuery struct {
+	Lon      float64
+	Lat      float64
+	RadiusKm float64
+	Limit    int
+}
+
+// WithinQuery selects the ports inside the Box, or inside the Polygon, if there is no Box
+type WithinQuery struct {
+	Box     *storage.BBox
+	Polygon storage.Polygon
+	Limit   int
+}
+
+// NearbyPort is a port with its great-circle distance from the searched location
+type NearbyPort struct {
+	Port
+	DistanceKm float64
+}
+
+func distanceKm(lon, lat float64, port Port) float64 {
+	if len(port.Coordinates) != 2 {
+		return 0
+	}
+	return storage.DistanceMeters(lon, lat, port.Coordinates[0], port.Coordinates[1]) / 1000
+}
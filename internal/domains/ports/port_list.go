@@ -0,0 +1,56 @@
+package ports
+
+import "go.mongodb.org/mongo-driver/bson"
+
+const DefaultPageSize = 50
+
+// ListQuery selects a page of ports, ordered by port code, that come after the After port code
+type ListQuery struct {
+	Filter Filter
+	After  string
+	Limit  int
+	// IncludeDeleted lists the soft deleted ports too
+	IncludeDeleted bool
+}
+
+// Filter selects the ports, that match all the set fields; Regions and Unlocs match ports that have all the given values
+type Filter struct {
+	Country string
+	// CountryCode is the ISO 3166-1 alpha-2 code of the country
+	CountryCode string
+	Province    string
+	City        string
+	Timezone    string
+	Regions     []string
+	Unlocs      []string
+}
+
+func (f Filter) AsBson() bson.M {
+	filter := bson.M{}
+	for field, value := range map[string]string{
+		"country":      f.Country,
+		"country_code": f.CountryCode,
+		"province":     f.Province,
+		"city":         f.City,
+		"timezone":     f.Timezone,
+	} {
+		if value != "" {
+			filter[field] = value
+		}
+	}
+
+	if len(f.Regions) > 0 {
+		filter["regions"] = bson.M{"$all": f.Regions}
+	}
+	if len(f.Unlocs) > 0 {
+		filter["unlocs"] = bson.M{"$all": f.Unlocs}
+	}
+
+	return filter
+}
+
+// Page is a page of ports; NextCursor is the port code to list the next page after, and is empty on the last page
+type Page struct {
+	Ports      []Port
+	NextCursor string
+}
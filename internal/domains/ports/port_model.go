@@ -1,6 +1,11 @@
 package ports
 
-import "go.mongodb.org/mongo-driver/bson"
+import (
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
 
 type Port struct {
 	PortCode    string    `bson:"port_code,omitempty"`
@@ -14,19 +19,107 @@ type Port struct {
 	Province    string    `bson:"province,omitempty"`
 	Timezone    string    `bson:"timezone,omitempty"`
 	Unlocs      []string  `bson:"unlocs,omitempty"`
+	// CountryCode is the ISO 3166-1 alpha-2 code of the country, that is set from the country name when the port is written
+	CountryCode string `bson:"country_code,omitempty"`
+	// DeletedAt is set when the port is soft deleted, which hides it from reads
+	DeletedAt *time.Time `bson:"deleted_at,omitempty"`
 }
 
+// PortFields are the names of the port fields, that can be written, as they are stored
+var PortFields = []string{"name", "city", "country", "code", "alias", "regions", "coordinates", "province", "timezone", "unlocs"}
+
+// derivedFields are the names of the stored port fields, that are computed from the writable ones
+var derivedFields = []string{"country_code"}
+
+// AsBson returns the writable and derived fields of the port, that are set; empty strings and lists are left out, as they are not stored
 func (p Port) AsBson() bson.M {
-	return bson.M{
-		"name":        p.Name,
-		"city":        p.City,
-		"country":     p.Country,
-		"code":        p.Code,
-		"alias":       p.Alias,
-		"regions":     p.Regions,
-		"coordinates": p.Coordinates,
-		"province":    p.Province,
-		"timezone":    p.Timezone,
-		"unlocs":      p.Unlocs,
+	fields := bson.M{
+		"name":         p.Name,
+		"city":         p.City,
+		"country":      p.Country,
+		"country_code": p.CountryCode,
+		"code":         p.Code,
+		"alias":        p.Alias,
+		"regions":      p.Regions,
+		"coordinates":  p.Coordinates,
+		"province":     p.Province,
+		"timezone":     p.Timezone,
+		"unlocs":       p.Unlocs,
+	}
+	for field, value := range fields {
+		if v := reflect.ValueOf(value); v.IsZero() || (v.Kind() == reflect.Slice && v.Len() == 0) {
+			delete(fields, field)
+		}
+	}
+	return fields
+}
+
+// ReplaceBson returns an update, that sets the fields of the port, and removes the rest, including the soft delete mark
+func (p Port) ReplaceBson() bson.M {
+	set := p.AsBson()
+	unset := bson.M{"deleted_at": ""}
+	for _, field := range append(PortFields, derivedFields...) {
+		if _, found := set[field]; !found {
+			unset[field] = ""
+		}
+	}
+
+	update := bson.M{"$unset": unset}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	return update
+}
+
+// PortPatch is a merge patch of a port: the fields that are set in Set are replaced, and the Unset fields are removed
+type PortPatch struct {
+	Set   Port
+	Unset []string
+}
+
+func (pp PortPatch) Empty() bool {
+	return len(pp.Set.AsBson()) == 0 && len(pp.Unset) == 0
+}
+
+// AsBson returns the update, that applies the patch
+func (pp PortPatch) AsBson() bson.M {
+	update := bson.M{}
+	if set := pp.Set.AsBson(); len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(pp.Unset) > 0 {
+		unset := bson.M{}
+		for _, field := range pp.Unset {
+			unset[field] = ""
+		}
+		update["$unset"] = unset
+	}
+	return update
+}
+
+// Apply returns the port with the patch applied, by merging their stored representations
+func (pp PortPatch) Apply(port Port) (Port, error) {
+	data, err := bson.Marshal(port)
+	if err != nil {
+		return Port{}, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return Port{}, err
+	}
+
+	for _, field := range pp.Unset {
+		delete(doc, field)
+	}
+	for field, value := range pp.Set.AsBson() {
+		doc[field] = value
+	}
+
+	data, err = bson.Marshal(doc)
+	if err != nil {
+		return Port{}, err
 	}
+	var patched Port
+	err = bson.Unmarshal(data, &patched)
+	return patched, err
 }
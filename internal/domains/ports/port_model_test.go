@@ -0,0 +1,48 @@
+package ports
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPortBson(t *testing.T) {
+	port := Port{PortCode: "AEDXB", Name: "Dubai", Alias: []string{}, Coordinates: []float64{55.27, 25.25}}
+
+	t.Run("set only non empty fields", func(t *testing.T) {
+		require.Equal(t, bson.M{"name": "Dubai", "coordinates": []float64{55.27, 25.25}}, port.AsBson())
+	})
+
+	t.Run("remove empty fields on replace", func(t *testing.T) {
+		require.Equal(t, bson.M{
+			"$set": bson.M{"name": "Dubai", "coordinates": []float64{55.27, 25.25}},
+			"$unset": bson.M{
+				"city": "", "country": "", "country_code": "", "code": "", "alias": "", "regions": "",
+				"province": "", "timezone": "", "unlocs": "", "deleted_at": "",
+			},
+		}, port.ReplaceBson())
+	})
+}
+
+func TestPortPatch(t *testing.T) {
+	patch := PortPatch{Set: Port{Timezone: "Asia/Dubai"}, Unset: []string{"coordinates"}}
+
+	t.Run("update only patched fields", func(t *testing.T) {
+		require.Equal(t, bson.M{
+			"$set":   bson.M{"timezone": "Asia/Dubai"},
+			"$unset": bson.M{"coordinates": ""},
+		}, patch.AsBson())
+	})
+
+	t.Run("apply to port", func(t *testing.T) {
+		patched, err := patch.Apply(Port{PortCode: "AEDXB", Name: "Dubai", Timezone: "Asia/Riyadh", Coordinates: []float64{55.27, 25.25}})
+		require.NoError(t, err)
+		require.Equal(t, Port{PortCode: "AEDXB", Name: "Dubai", Timezone: "Asia/Dubai"}, patched)
+	})
+
+	t.Run("report empty patch", func(t *testing.T) {
+		require.True(t, PortPatch{Set: Port{Alias: []string{}}}.Empty())
+		require.False(t, patch.Empty())
+	})
+}
@@ -2,18 +2,47 @@ package ports
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sort"
+	"time"
 
 	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
 	"github.com/CristianCurteanu/koken-api/internal/infra/storage/inmemory"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// PortRepository hides the soft deleted ports from all reads, except the listings that ask for them
 type PortRepository interface {
 	Find(ctx context.Context, code string) (Port, error)
+	// FindMany returns the ports with the given codes, that exist, in no particular order
+	FindMany(ctx context.Context, codes []string) ([]Port, error)
 	Create(ctx context.Context, port Port) error
 	Update(ctx context.Context, port Port) error
+	// Upsert creates the port, or updates it if it already exists, in a single storage call
+	Upsert(ctx context.Context, port Port) error
+	// SaveMany upserts a batch of ports in a single storage call, and reports the failures by the index of the port in the batch
+	SaveMany(ctx context.Context, ports []Port) (storage.BulkUpsertResult, error)
+	List(ctx context.Context, query ListQuery) ([]Port, error)
+	// Each calls fn with every port selected by the query, in port code order, reading them one at a time from a storage cursor
+	Each(ctx context.Context, query ListQuery, fn func(Port) error) error
+	// Near returns the ports within the query radius, closest first
+	Near(ctx context.Context, query NearbyQuery) ([]Port, error)
+	// Within returns the ports inside the query area, ordered by port code
+	Within(ctx context.Context, query WithinQuery) ([]Port, error)
+	// Search returns the ports matching the query text, most relevant first
+	Search(ctx context.Context, query SearchQuery) ([]Port, error)
+	// Autocomplete returns the ports with a code, name or alias starting with the query prefix
+	Autocomplete(ctx context.Context, query AutocompleteQuery) ([]Port, error)
+	// Delete removes the port, whether it is soft deleted or not
+	Delete(ctx context.Context, code string) error
+	// SoftDelete marks the port as deleted at the given time; it returns storage.ErrNotFound if the port is already deleted
+	SoftDelete(ctx context.Context, code string, at time.Time) error
+	// Restore unmarks the soft deleted port; it returns storage.ErrNotFound if the port is not soft deleted
+	Restore(ctx context.Context, code string) error
+	// Patch applies the patch to the port; it returns storage.ErrNotFound if there is no such port
+	Patch(ctx context.Context, code string, patch PortPatch) error
 }
 
 var storageStrategies map[RepositoryStrategy]func(storage.Storage) PortRepository
@@ -59,10 +88,23 @@ func NewPortRepository(key RepositoryStrategy, st storage.Storage) PortRepositor
 	return &portsRepository{storageStrategy}
 }
 
+// InMemoryIndexes declares the indexes of the port queries, so that an in memory storage builds them upfront, and keeps them up to date on writes
+func InMemoryIndexes() []inmemory.Option {
+	return []inmemory.Option{
+		inmemory.WithGeoIndex(coordinatesField),
+		inmemory.WithTextIndex(searchWeights),
+		inmemory.WithPrefixIndex(autocompleteFields...),
+	}
+}
+
 func (pr *portsRepository) Find(ctx context.Context, code string) (port Port, err error) {
 	return pr.repositoryStrategy.Find(ctx, code)
 }
 
+func (pr *portsRepository) FindMany(ctx context.Context, codes []string) ([]Port, error) {
+	return pr.repositoryStrategy.FindMany(ctx, codes)
+}
+
 func (pr *portsRepository) Create(ctx context.Context, port Port) error {
 	return pr.repositoryStrategy.Create(ctx, port) //.Insert(ctx, obj)
 }
@@ -71,6 +113,145 @@ func (pr *portsRepository) Update(ctx context.Context, port Port) error {
 	return pr.repositoryStrategy.Update(ctx, port)
 }
 
+func (pr *portsRepository) Upsert(ctx context.Context, port Port) error {
+	return pr.repositoryStrategy.Upsert(ctx, port)
+}
+
+func (pr *portsRepository) SaveMany(ctx context.Context, ports []Port) (storage.BulkUpsertResult, error) {
+	return pr.repositoryStrategy.SaveMany(ctx, ports)
+}
+
+func (pr *portsRepository) List(ctx context.Context, query ListQuery) ([]Port, error) {
+	return pr.repositoryStrategy.List(ctx, query)
+}
+
+func (pr *portsRepository) Each(ctx context.Context, query ListQuery, fn func(Port) error) error {
+	return pr.repositoryStrategy.Each(ctx, query, fn)
+}
+
+func (pr *portsRepository) Near(ctx context.Context, query NearbyQuery) ([]Port, error) {
+	return pr.repositoryStrategy.Near(ctx, query)
+}
+
+func (pr *portsRepository) Within(ctx context.Context, query WithinQuery) ([]Port, error) {
+	return pr.repositoryStrategy.Within(ctx, query)
+}
+
+func (pr *portsRepository) Search(ctx context.Context, query SearchQuery) ([]Port, error) {
+	return pr.repositoryStrategy.Search(ctx, query)
+}
+
+func (pr *portsRepository) Autocomplete(ctx context.Context, query AutocompleteQuery) ([]Port, error) {
+	return pr.repositoryStrategy.Autocomplete(ctx, query)
+}
+
+func (pr *portsRepository) Delete(ctx context.Context, code string) error {
+	return pr.repositoryStrategy.Delete(ctx, code)
+}
+
+func (pr *portsRepository) SoftDelete(ctx context.Context, code string, at time.Time) error {
+	return pr.repositoryStrategy.SoftDelete(ctx, code, at)
+}
+
+func (pr *portsRepository) Restore(ctx context.Context, code string) error {
+	return pr.repositoryStrategy.Restore(ctx, code)
+}
+
+func (pr *portsRepository) Patch(ctx context.Context, code string, patch PortPatch) error {
+	return pr.repositoryStrategy.Patch(ctx, code, patch)
+}
+
+// visible adds the condition, that hides the soft deleted ports, to the filter
+func visible(filter bson.M) bson.M {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
+}
+
+func listFilter(query ListQuery) bson.M {
+	if query.IncludeDeleted {
+		return query.Filter.AsBson()
+	}
+	return visible(query.Filter.AsBson())
+}
+
+func listOptions(query ListQuery) storage.ListOptions {
+	return storage.ListOptions{
+		Filter:    listFilter(query),
+		SortField: "port_code",
+		After:     query.After,
+		Limit:     query.Limit,
+	}
+}
+
+// each walks the storage cursor; it stops at the first error of fn, and always closes the cursor
+func each(ctx context.Context, st storage.Storage, query ListQuery, fn func(Port) error) (err error) {
+	cursor, err := st.Stream(ctx, listOptions(query))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := cursor.Close(ctx); err == nil {
+			err = closeErr
+		}
+	}()
+
+	for cursor.Next(ctx) {
+		var port Port
+		if err := cursor.Decode(&port); err != nil {
+			return err
+		}
+		if err := fn(port); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// coordinatesField is the field of the stored ports, that has the [longitude, latitude] pair
+const coordinatesField = "coordinates"
+
+func nearQuery(query NearbyQuery) storage.NearQuery {
+	return storage.NearQuery{
+		Field:       coordinatesField,
+		Filter:      visible(nil),
+		Lon:         query.Lon,
+		Lat:         query.Lat,
+		MaxDistance: query.RadiusKm * 1000,
+		Limit:       query.Limit,
+	}
+}
+
+func withinQuery(query WithinQuery) storage.WithinQuery {
+	return storage.WithinQuery{
+		Field:   coordinatesField,
+		Filter:  visible(nil),
+		Box:     query.Box,
+		Polygon: query.Polygon,
+		Limit:   query.Limit,
+	}
+}
+
+func searchQuery(query SearchQuery) storage.SearchQuery {
+	return storage.SearchQuery{
+		Fields: searchWeights,
+		Filter: visible(nil),
+		Text:   query.Text,
+		Limit:  query.Limit,
+	}
+}
+
+func prefixQuery(query AutocompleteQuery) storage.PrefixQuery {
+	return storage.PrefixQuery{
+		Fields: autocompleteFields,
+		Filter: visible(nil),
+		Prefix: query.Prefix,
+		Limit:  query.Limit,
+	}
+}
+
 /*
 inMemoryRepository is a repository strategy, that is created to handle
 in memory data access layer, and to use this kind of storage type structs for insert
@@ -84,7 +265,7 @@ func NewInMemoryRepository(st storage.Storage) PortRepository {
 }
 
 func (imr *inMemoryRepository) Find(ctx context.Context, code string) (port Port, err error) {
-	err = imr.store.Find(ctx, bson.M{"port_code": code}, &port)
+	err = imr.store.Find(ctx, visible(bson.M{"port_code": code}), &port)
 	if err != nil {
 		log.Println("error while looking up for element, err:", err)
 		return
@@ -92,6 +273,23 @@ func (imr *inMemoryRepository) Find(ctx context.Context, code string) (port Port
 	return
 }
 
+// FindMany looks up the ports one by one, as the in-memory storage finds a port by code without scanning
+func (pr *inMemoryRepository) FindMany(ctx context.Context, codes []string) ([]Port, error) {
+	found := make([]Port, 0, len(codes))
+	for _, code := range codes {
+		var port Port
+		err := pr.store.Find(ctx, visible(bson.M{"port_code": code}), &port)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, port)
+	}
+	return found, nil
+}
+
 func (pr *inMemoryRepository) Create(ctx context.Context, port Port) error {
 	return pr.store.Insert(ctx, inmemory.KeyValue{
 		Key:   port.PortCode,
@@ -102,6 +300,91 @@ func (pr *inMemoryRepository) Update(ctx context.Context, port Port) error {
 	return pr.store.Update(ctx, port.PortCode, port)
 }
 
+func (pr *inMemoryRepository) Upsert(ctx context.Context, port Port) error {
+	return pr.store.Upsert(ctx, port.PortCode, port)
+}
+
+func (pr *inMemoryRepository) SaveMany(ctx context.Context, ports []Port) (storage.BulkUpsertResult, error) {
+	records := make([]storage.UpsertRecord, 0, len(ports))
+	for _, port := range ports {
+		records = append(records, storage.UpsertRecord{ID: port.PortCode, Obj: port})
+	}
+	return pr.store.BulkUpsert(ctx, records)
+}
+
+func (pr *inMemoryRepository) List(ctx context.Context, query ListQuery) (ports []Port, err error) {
+	err = pr.store.List(ctx, listOptions(query), &ports)
+	return
+}
+
+func (pr *inMemoryRepository) Each(ctx context.Context, query ListQuery, fn func(Port) error) error {
+	return each(ctx, pr.store, query, fn)
+}
+
+func (pr *inMemoryRepository) Near(ctx context.Context, query NearbyQuery) (ports []Port, err error) {
+	err = pr.store.Near(ctx, nearQuery(query), &ports)
+	return
+}
+
+func (pr *inMemoryRepository) Within(ctx context.Context, query WithinQuery) (ports []Port, err error) {
+	err = pr.store.Within(ctx, withinQuery(query), &ports)
+	return
+}
+
+func (pr *inMemoryRepository) Search(ctx context.Context, query SearchQuery) (ports []Port, err error) {
+	err = pr.store.Search(ctx, searchQuery(query), &ports)
+	return
+}
+
+func (pr *inMemoryRepository) Autocomplete(ctx context.Context, query AutocompleteQuery) (ports []Port, err error) {
+	err = pr.store.SearchPrefix(ctx, prefixQuery(query), &ports)
+	return
+}
+
+func (pr *inMemoryRepository) Delete(ctx context.Context, code string) error {
+	return pr.store.Delete(ctx, code)
+}
+
+func (pr *inMemoryRepository) SoftDelete(ctx context.Context, code string, at time.Time) error {
+	return pr.modify(ctx, code, func(port Port) (Port, error) {
+		if port.DeletedAt != nil {
+			return Port{}, storage.ErrNotFound
+		}
+		port.DeletedAt = &at
+		return port, nil
+	})
+}
+
+func (pr *inMemoryRepository) Restore(ctx context.Context, code string) error {
+	return pr.modify(ctx, code, func(port Port) (Port, error) {
+		if port.DeletedAt == nil {
+			return Port{}, storage.ErrNotFound
+		}
+		port.DeletedAt = nil
+		return port, nil
+	})
+}
+
+func (pr *inMemoryRepository) Patch(ctx context.Context, code string, patch PortPatch) error {
+	return pr.modify(ctx, code, func(port Port) (Port, error) {
+		if port.DeletedAt != nil {
+			return Port{}, storage.ErrNotFound
+		}
+		return patch.Apply(port)
+	})
+}
+
+// modify changes the stored port with fn, in a single update, so that concurrent writes of the port are not lost
+func (pr *inMemoryRepository) modify(ctx context.Context, code string, fn func(Port) (Port, error)) error {
+	return pr.store.Update(ctx, code, inmemory.UpdateFunc(func(current interface{}) (interface{}, error) {
+		port, isPort := current.(Port)
+		if !isPort {
+			return nil, fmt.Errorf("the record %q is not a port", code)
+		}
+		return fn(port)
+	}))
+}
+
 /*
 mongoRepository is a repository strategy, that is created to handle
 MongoDB data access layer, and to use this kind of storage type structs for update, like bson.M{"$set": ...}
@@ -115,7 +398,7 @@ func NewMongoRepository(st storage.Storage) PortRepository {
 }
 
 func (imr *mongoRepository) Find(ctx context.Context, code string) (port Port, err error) {
-	err = imr.store.Find(ctx, bson.M{"port_code": code}, &port)
+	err = imr.store.Find(ctx, visible(bson.M{"port_code": code}), &port)
 	if err != nil {
 		log.Println("error while looking up for element, err:", err)
 		return
@@ -123,10 +406,85 @@ func (imr *mongoRepository) Find(ctx context.Context, code string) (port Port, e
 	return
 }
 
+func (pr *mongoRepository) FindMany(ctx context.Context, codes []string) (ports []Port, err error) {
+	err = pr.store.List(ctx, storage.ListOptions{
+		Filter:    visible(bson.M{"port_code": bson.M{"$in": codes}}),
+		SortField: "port_code",
+		Limit:     len(codes),
+	}, &ports)
+	return
+}
+
 func (pr *mongoRepository) Create(ctx context.Context, port Port) error {
 	return pr.store.Insert(ctx, port)
 }
 
 func (pr *mongoRepository) Update(ctx context.Context, port Port) error {
-	return pr.store.Update(ctx, bson.M{"port_code": port.PortCode}, bson.M{"$set": port.AsBson()})
+	return pr.store.Update(ctx, bson.M{"port_code": port.PortCode}, port.ReplaceBson())
+}
+
+func (pr *mongoRepository) Upsert(ctx context.Context, port Port) error {
+	return pr.store.Upsert(ctx, bson.M{"port_code": port.PortCode}, port.ReplaceBson())
+}
+
+func (pr *mongoRepository) SaveMany(ctx context.Context, ports []Port) (storage.BulkUpsertResult, error) {
+	records := make([]storage.UpsertRecord, 0, len(ports))
+	for _, port := range ports {
+		records = append(records, storage.UpsertRecord{
+			ID:  bson.M{"port_code": port.PortCode},
+			Obj: port.ReplaceBson(),
+		})
+	}
+	return pr.store.BulkUpsert(ctx, records)
+}
+
+func (pr *mongoRepository) List(ctx context.Context, query ListQuery) (ports []Port, err error) {
+	err = pr.store.List(ctx, listOptions(query), &ports)
+	return
+}
+
+func (pr *mongoRepository) Each(ctx context.Context, query ListQuery, fn func(Port) error) error {
+	return each(ctx, pr.store, query, fn)
+}
+
+func (pr *mongoRepository) Near(ctx context.Context, query NearbyQuery) (ports []Port, err error) {
+	err = pr.store.Near(ctx, nearQuery(query), &ports)
+	return
+}
+
+func (pr *mongoRepository) Within(ctx context.Context, query WithinQuery) (ports []Port, err error) {
+	err = pr.store.Within(ctx, withinQuery(query), &ports)
+	return
+}
+
+func (pr *mongoRepository) Search(ctx context.Context, query SearchQuery) (ports []Port, err error) {
+	err = pr.store.Search(ctx, searchQuery(query), &ports)
+	return
+}
+
+func (pr *mongoRepository) Autocomplete(ctx context.Context, query AutocompleteQuery) (ports []Port, err error) {
+	err = pr.store.SearchPrefix(ctx, prefixQuery(query), &ports)
+	return
+}
+
+func (pr *mongoRepository) Delete(ctx context.Context, code string) error {
+	return pr.store.Delete(ctx, bson.M{"port_code": code})
+}
+
+func (pr *mongoRepository) SoftDelete(ctx context.Context, code string, at time.Time) error {
+	return pr.store.Update(ctx,
+		visible(bson.M{"port_code": code}),
+		bson.M{"$set": bson.M{"deleted_at": at}},
+	)
+}
+
+func (pr *mongoRepository) Restore(ctx context.Context, code string) error {
+	return pr.store.Update(ctx,
+		bson.M{"port_code": code, "deleted_at": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"deleted_at": ""}},
+	)
+}
+
+func (pr *mongoRepository) Patch(ctx context.Context, code string, patch PortPatch) error {
+	return pr.store.Update(ctx, visible(bson.M{"port_code": code}), patch.AsBson())
 }
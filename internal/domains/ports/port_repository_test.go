@@ -4,9 +4,13 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage/inmemory"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 type MockStorage struct {
@@ -28,6 +32,52 @@ func (ms *MockStorage) Update(ctx context.Context, id interface{}, obj interface
 	return args.Error(0)
 }
 
+func (ms *MockStorage) Upsert(ctx context.Context, id interface{}, obj interface{}) error {
+	args := ms.Called(ctx, id, obj)
+	return args.Error(0)
+}
+
+func (ms *MockStorage) List(ctx context.Context, opts storage.ListOptions, results interface{}) error {
+	args := ms.Called(ctx, opts, results)
+	return args.Error(0)
+}
+
+func (ms *MockStorage) Stream(ctx context.Context, opts storage.ListOptions) (storage.Cursor, error) {
+	args := ms.Called(ctx, opts)
+	cursor, _ := args.Get(0).(storage.Cursor)
+	return cursor, args.Error(1)
+}
+
+func (ms *MockStorage) Near(ctx context.Context, query storage.NearQuery, results interface{}) error {
+	args := ms.Called(ctx, query, results)
+	return args.Error(0)
+}
+
+func (ms *MockStorage) Within(ctx context.Context, query storage.WithinQuery, results interface{}) error {
+	args := ms.Called(ctx, query, results)
+	return args.Error(0)
+}
+
+func (ms *MockStorage) Search(ctx context.Context, query storage.SearchQuery, results interface{}) error {
+	args := ms.Called(ctx, query, results)
+	return args.Error(0)
+}
+
+func (ms *MockStorage) SearchPrefix(ctx context.Context, query storage.PrefixQuery, results interface{}) error {
+	args := ms.Called(ctx, query, results)
+	return args.Error(0)
+}
+
+func (ms *MockStorage) Delete(ctx context.Context, id interface{}) error {
+	args := ms.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (ms *MockStorage) BulkUpsert(ctx context.Context, records []storage.UpsertRecord) (storage.BulkUpsertResult, error) {
+	args := ms.Called(ctx, records)
+	return args.Get(0).(storage.BulkUpsertResult), args.Error(1)
+}
+
 func TestRepositoryFind(t *testing.T) {
 	t.Run("return no error if found", func(t *testing.T) {
 		storageMock := new(MockStorage)
@@ -121,6 +171,225 @@ func TestUpdate(t *testing.T) {
 	})
 }
 
+func TestUpsert(t *testing.T) {
+	t.Run("upsert by port code if storage is in-memory", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		repository := NewPortRepository(StorageTypeInMem, storageMock)
+
+		port := Port{PortCode: "TC-0001"}
+		storageMock.On("Upsert", mock.Anything, "TC-0001", port).Return(nil)
+
+		err := repository.Upsert(context.Background(), port)
+		require.NoError(t, err)
+		storageMock.AssertExpectations(t)
+	})
+
+	t.Run("upsert by port code filter if storage is mongo", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		repository := NewPortRepository(StorageTypeMongoDB, storageMock)
+
+		storageMock.On("Upsert", mock.Anything, bson.M{"port_code": "TC-0001"}, mock.Anything).Return(nil)
+
+		err := repository.Upsert(context.Background(), Port{PortCode: "TC-0001"})
+		require.NoError(t, err)
+		storageMock.AssertExpectations(t)
+	})
+
+	t.Run("return error if not upserted", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		repository := NewPortRepository(StorageTypeInMem, storageMock)
+
+		storageMock.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("upsert error"))
+
+		err := repository.Upsert(context.Background(), Port{PortCode: "TC-0001"})
+		require.Error(t, err)
+	})
+}
+
+func TestSaveMany(t *testing.T) {
+	t.Run("bulk upsert by port code if storage is in-memory", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		repository := NewPortRepository(StorageTypeInMem, storageMock)
+
+		pts := []Port{{PortCode: "TC-0001"}, {PortCode: "TC-0002"}}
+		storageMock.On("BulkUpsert", mock.Anything, []storage.UpsertRecord{
+			{ID: "TC-0001", Obj: pts[0]},
+			{ID: "TC-0002", Obj: pts[1]},
+		}).Return(storage.BulkUpsertResult{Created: 2}, nil)
+
+		result, err := repository.SaveMany(context.Background(), pts)
+		require.NoError(t, err)
+		require.Equal(t, 2, result.Created)
+		storageMock.AssertNumberOfCalls(t, "BulkUpsert", 1)
+		storageMock.AssertNotCalled(t, "Upsert", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("bulk upsert by port code filter if storage is mongo", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		repository := NewPortRepository(StorageTypeMongoDB, storageMock)
+
+		storageMock.On("BulkUpsert", mock.Anything, mock.MatchedBy(func(records []storage.UpsertRecord) bool {
+			return len(records) == 2 && records[1].ID.(bson.M)["port_code"] == "TC-0002"
+		})).Return(storage.BulkUpsertResult{Created: 1, Updated: 1}, nil)
+
+		result, err := repository.SaveMany(context.Background(), []Port{{PortCode: "TC-0001"}, {PortCode: "TC-0002"}})
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Updated)
+		storageMock.AssertExpectations(t)
+	})
+
+	t.Run("return error if storage fails", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		repository := NewPortRepository(StorageTypeMongoDB, storageMock)
+
+		storageMock.On("BulkUpsert", mock.Anything, mock.Anything).Return(storage.BulkUpsertResult{}, errors.New("bulk write failed"))
+
+		_, err := repository.SaveMany(context.Background(), []Port{{PortCode: "TC-0001"}, {PortCode: "TC-0002"}})
+		require.Error(t, err)
+	})
+}
+
+func TestList(t *testing.T) {
+	t.Run("hide soft deleted ports", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		repository := NewPortRepository(StorageTypeMongoDB, storageMock)
+
+		storageMock.On("List", mock.Anything, storage.ListOptions{
+			Filter: map[string]interface{}{
+				"country":    "United Arab Emirates",
+				"regions":    bson.M{"$all": []string{"Middle East"}},
+				"deleted_at": bson.M{"$exists": false},
+			},
+			SortField: "port_code",
+			After:     "TC-0001",
+			Limit:     10,
+		}, mock.Anything).
+			Run(func(args mock.Arguments) {
+				*args.Get(2).(*[]Port) = []Port{{PortCode: "TC-0002"}}
+			}).
+			Return(nil)
+
+		pts, err := repository.List(context.Background(), ListQuery{
+			Filter: Filter{Country: "United Arab Emirates", Regions: []string{"Middle East"}},
+			After:  "TC-0001",
+			Limit:  10,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []Port{{PortCode: "TC-0002"}}, pts)
+	})
+
+	t.Run("include soft deleted ports if asked", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		repository := NewPortRepository(StorageTypeMongoDB, storageMock)
+
+		storageMock.On("List", mock.Anything, storage.ListOptions{
+			Filter:    map[string]interface{}{"country": "United Arab Emirates"},
+			SortField: "port_code",
+			Limit:     10,
+		}, mock.Anything).Return(nil)
+
+		_, err := repository.List(context.Background(), ListQuery{
+			Filter:         Filter{Country: "United Arab Emirates"},
+			Limit:          10,
+			IncludeDeleted: true,
+		})
+		require.NoError(t, err)
+		storageMock.AssertNumberOfCalls(t, "List", 1)
+	})
+}
+
+func TestEach(t *testing.T) {
+	ctx := context.Background()
+	repository := NewPortRepository(StorageTypeInMem, inmemory.NewInMemoryStorage())
+	for _, code := range []string{"AEJEA", "AEAJM", "AEDXB", "AEAUH"} {
+		require.NoError(t, repository.Create(ctx, Port{PortCode: code, City: "Dubai"}))
+	}
+	require.NoError(t, repository.Update(ctx, Port{PortCode: "AEAUH", City: "Abu Dhabi"}))
+	require.NoError(t, repository.SoftDelete(ctx, "AEDXB", time.Now()))
+
+	t.Run("read the matching ports in port code order, hiding soft deleted ports", func(t *testing.T) {
+		var codes []string
+		err := repository.Each(ctx, ListQuery{Filter: Filter{City: "Dubai"}}, func(port Port) error {
+			codes = append(codes, port.PortCode)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"AEAJM", "AEJEA"}, codes)
+	})
+
+	t.Run("stop on the first error", func(t *testing.T) {
+		stop := errors.New("stop")
+		calls := 0
+		err := repository.Each(ctx, ListQuery{}, func(port Port) error {
+			calls++
+			return stop
+		})
+		require.ErrorIs(t, err, stop)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("return the storage error", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		storageMock.On("Stream", mock.Anything, mock.Anything).Return(nil, errors.New("connection refused"))
+
+		err := NewPortRepository(StorageTypeMongoDB, storageMock).Each(ctx, ListQuery{}, func(Port) error { return nil })
+		require.EqualError(t, err, "connection refused")
+	})
+}
+
+func TestDelete(t *testing.T) {
+	t.Run("remove port", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		repository := NewPortRepository(StorageTypeMongoDB, storageMock)
+
+		storageMock.On("Delete", mock.Anything, bson.M{"port_code": "TC-0001"}).Return(storage.ErrNotFound)
+
+		err := repository.Delete(context.Background(), "TC-0001")
+		require.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("mark only visible port as deleted", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		repository := NewPortRepository(StorageTypeMongoDB, storageMock)
+
+		at := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+		storageMock.On("Update", mock.Anything,
+			bson.M{"port_code": "TC-0001", "deleted_at": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"deleted_at": at}},
+		).Return(nil)
+
+		require.NoError(t, repository.SoftDelete(context.Background(), "TC-0001", at))
+	})
+
+	t.Run("restore only deleted port", func(t *testing.T) {
+		storageMock := new(MockStorage)
+		repository := NewPortRepository(StorageTypeMongoDB, storageMock)
+
+		storageMock.On("Update", mock.Anything,
+			bson.M{"port_code": "TC-0001", "deleted_at": bson.M{"$exists": true}},
+			bson.M{"$unset": bson.M{"deleted_at": ""}},
+		).Return(nil)
+
+		require.NoError(t, repository.Restore(context.Background(), "TC-0001"))
+	})
+
+	t.Run("mark and restore in-memory port in a single update", func(t *testing.T) {
+		ctx := context.Background()
+		repository := NewPortRepository(StorageTypeInMem, inmemory.NewInMemoryStorage())
+		require.NoError(t, repository.Create(ctx, Port{PortCode: "TC-0001"}))
+
+		require.ErrorIs(t, repository.Restore(ctx, "TC-0001"), storage.ErrNotFound)
+		require.NoError(t, repository.SoftDelete(ctx, "TC-0001", time.Now()))
+		require.ErrorIs(t, repository.SoftDelete(ctx, "TC-0001", time.Now()), storage.ErrNotFound)
+		require.ErrorIs(t, repository.Patch(ctx, "TC-0001", PortPatch{Set: Port{Name: "Test"}}), storage.ErrNotFound)
+
+		require.NoError(t, repository.Restore(ctx, "TC-0001"))
+		port, err := repository.Find(ctx, "TC-0001")
+		require.NoError(t, err)
+		require.Nil(t, port.DeletedAt)
+	})
+}
+
 func TestRegisterStrategy(t *testing.T) {
 	storageMock := new(MockStorage)
 
@@ -0,0 +1,27 @@
+package ports
+
+const DefaultSearchLimit = 20
+
+// SearchQuery selects the ports, whose name, alias, city or province contain the words of Text
+type SearchQuery struct {
+	Text  string
+	Limit int
+}
+
+// searchWeights rank the ports matching by name above the ones matching only by alias, city or province
+var searchWeights = map[string]int{
+	"name":     4,
+	"alias":    3,
+	"city":     2,
+	"province": 1,
+}
+
+const DefaultAutocompleteLimit = 10
+
+// AutocompleteQuery selects the ports, whose code, name or alias starts with the Prefix
+type AutocompleteQuery struct {
+	Prefix string
+	Limit  int
+}
+
+var autocompleteFields = []string{"port_code", "name", "alias"}
@@ -2,6 +2,10 @@ package ports
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
 
 	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
 	"golang.org/x/sync/errgroup"
@@ -9,41 +13,658 @@ import (
 
 type PortService interface {
 	GetByPortCode(ctx context.Context, code string) (Port, error)
+	List(ctx context.Context, query ListQuery) (Page, error)
+	Nearby(ctx context.Context, query NearbyQuery) ([]NearbyPort, error)
+	Within(ctx context.Context, query WithinQuery) ([]Port, error)
+	Search(ctx context.Context, query SearchQuery) ([]Port, error)
+	Autocomplete(ctx context.Context, query AutocompleteQuery) ([]Port, error)
+	Delete(ctx context.Context, code string) error
+	Restore(ctx context.Context, code string) (Port, error)
+	Replace(ctx context.Context, port Port) (stored Port, created bool, err error)
+	Patch(ctx context.Context, code string, patch PortPatch) (Port, error)
+	// Validate reads the ports from the source, and reports the broken validation rules, and what an import would change
+	Validate(ctx context.Context, src PortSource) (ValidationReport, error)
 	CreateOrUpdate(ctx context.Context, port Port) error
-	CreateOrUpdateMany(ctx context.Context, ports []Port) error
+	CreateOrUpdateMany(ctx context.Context, ports []Port) (ImportResult, error)
+	CreateOrUpdateFrom(ctx context.Context, src PortSource, opts ...ImportOption) (ImportResult, error)
+	// Export calls fn with every stored port, that matches the filter, in port code order; it stops at the first error of fn
+	Export(ctx context.Context, filter Filter, fn func(Port) error) error
+	// NormalizeCountries sets the country codes of the stored ports, that have none or an outdated one, and returns the number of updated ports
+	NormalizeCountries(ctx context.Context) (int, error)
 }
 
+// ErrEmptyReplace is returned by a replace mode import of a source without ports, that would delete all the stored ports
+var ErrEmptyReplace = errors.New("the source has no ports, replacing would remove all the stored ports")
+
+type importOptions struct {
+	progress func(ImportResult)
+	replace  bool
+	dryRun   bool
+	partial  bool
+}
+
+// ImportOption configures a single import, run with CreateOrUpdateFrom
+type ImportOption func(*importOptions)
+
+// WithProgress sets a callback, that receives the intermediate result of the import, after each stored batch
+func WithProgress(fn func(ImportResult)) ImportOption {
+	return func(options *importOptions) {
+		options.progress = fn
+	}
+}
+
+// WithReplace removes the stored ports, that are missing from the source, once all the ports from the source are stored
+func WithReplace() ImportOption {
+	return func(options *importOptions) {
+		options.replace = true
+	}
+}
+
+// WithDryRun reads the whole source, but doesn't write anything; in replace mode, the result lists the ports that would be removed
+func WithDryRun() ImportOption {
+	return func(options *importOptions) {
+		options.dryRun = true
+	}
+}
+
+// WithPartial skips the malformed records of the source, and reports them as failures, instead of failing the import
+func WithPartial() ImportOption {
+	return func(options *importOptions) {
+		options.partial = true
+	}
+}
+
+// PortSource yields ports one at a time, and returns io.EOF once there are no more ports left
+type PortSource interface {
+	Next() (Port, error)
+}
+
+// SourceError is returned when a PortSource fails to produce the next port, ie. because of malformed input
+type SourceError struct {
+	Err error
+}
+
+func (se *SourceError) Error() string {
+	return "reading ports source: " + se.Err.Error()
+}
+
+func (se *SourceError) Unwrap() error {
+	return se.Err
+}
+
+// RecordError is returned by a PortSource, when a single record is malformed; the source can still be read past it
+type RecordError struct {
+	Line int
+	// PortCode is the code of the malformed port, if it could be read
+	PortCode string
+	Err      error
+}
+
+func (re *RecordError) Error() string {
+	return fmt.Sprintf("line %d: %s", re.Line, re.Err)
+}
+
+func (re *RecordError) Unwrap() error {
+	return re.Err
+}
+
+// LineSource is a PortSource, that reads a port per line, and knows the line of the last port it returned
+type LineSource interface {
+	PortSource
+	Line() int
+}
+
+// sourceLine returns the line of the last port read from the source, or 0 if the source is not read by lines
+func sourceLine(src PortSource) int {
+	if lines, ok := src.(LineSource); ok {
+		return lines.Line()
+	}
+	return 0
+}
+
+const (
+	DefaultConcurrency = 8
+	DefaultBatchSize   = 500
+
+	// replaceScanSize is the number of stored ports, that are listed at a time, looking for the ones missing from the source
+	replaceScanSize = 1000
+)
+
 type portsService struct {
-	repo PortRepository
+	repo        PortRepository
+	concurrency int
+	batchSize   int
+	softDelete  bool
+}
+
+// ServiceOption configures the port service, created with NewPortService
+type ServiceOption func(*portsService)
+
+// WithConcurrency limits the number of batches that are written to the repository at the same time
+func WithConcurrency(n int) ServiceOption {
+	return func(ps *portsService) {
+		if n > 0 {
+			ps.concurrency = n
+		}
+	}
+}
+
+// WithBatchSize sets the number of ports, that are written to the repository in a single call
+func WithBatchSize(n int) ServiceOption {
+	return func(ps *portsService) {
+		if n > 0 {
+			ps.batchSize = n
+		}
+	}
 }
 
-func NewPortService(repo PortRepository) PortService {
-	return &portsService{repo}
+// WithSoftDelete makes Delete mark the ports as deleted, so that they can be restored, instead of removing them
+func WithSoftDelete(enabled bool) ServiceOption {
+	return func(ps *portsService) {
+		ps.softDelete = enabled
+	}
+}
+
+func NewPortService(repo PortRepository, opts ...ServiceOption) PortService {
+	ps := &portsService{
+		repo:        repo,
+		concurrency: DefaultConcurrency,
+		batchSize:   DefaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(ps)
+	}
+	return ps
 }
 
 func (ps *portsService) GetByPortCode(ctx context.Context, code string) (Port, error) {
 	return ps.repo.Find(ctx, code)
 }
 
-func (ps *portsService) CreateOrUpdate(ctx context.Context, port Port) error {
-	if _, err := ps.repo.Find(ctx, port.PortCode); err == storage.ErrNotFound {
-		return ps.repo.Create(ctx, port)
+// List returns a page of ports; one more port than the limit is fetched, to know if there is a next page
+func (ps *portsService) List(ctx context.Context, query ListQuery) (Page, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	query.Limit = limit + 1
+
+	ports, err := ps.repo.List(ctx, query)
+	if err != nil {
+		return Page{}, err
+	}
+
+	if len(ports) <= limit {
+		return Page{Ports: ports}, nil
 	}
-	return ps.repo.Update(ctx, port)
+
+	ports = ports[:limit]
+	return Page{Ports: ports, NextCursor: ports[limit-1].PortCode}, nil
 }
 
-func (ps *portsService) CreateOrUpdateMany(ctx context.Context, ports []Port) error {
-	g := new(errgroup.Group)
+// Nearby returns the ports closest to the query location, along with their distance from it
+func (ps *portsService) Nearby(ctx context.Context, query NearbyQuery) ([]NearbyPort, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultNearbyLimit
+	}
+
+	ports, err := ps.repo.Near(ctx, query)
+	if err != nil {
+		return nil, err
+	}
 
+	nearby := make([]NearbyPort, 0, len(ports))
 	for _, port := range ports {
-		g.Go(ps.wrapCreateOrUpdate(ctx, port))
+		nearby = append(nearby, NearbyPort{Port: port, DistanceKm: distanceKm(query.Lon, query.Lat, port)})
 	}
+	return nearby, nil
+}
 
-	return g.Wait()
+// Within returns the ports inside the query box or polygon, ordered by port code
+func (ps *portsService) Within(ctx context.Context, query WithinQuery) ([]Port, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultWithinLimit
+	}
+	return ps.repo.Within(ctx, query)
 }
 
-func (ps *portsService) wrapCreateOrUpdate(ctx context.Context, port Port) func() error {
+// Search returns the ports matching the query text by name, alias, city or province, most relevant first
+func (ps *portsService) Search(ctx context.Context, query SearchQuery) ([]Port, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultSearchLimit
+	}
+	return ps.repo.Search(ctx, query)
+}
+
+// Autocomplete returns the ports with a code, name or alias starting with the query prefix
+func (ps *portsService) Autocomplete(ctx context.Context, query AutocompleteQuery) ([]Port, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultAutocompleteLimit
+	}
+	return ps.repo.Autocomplete(ctx, query)
+}
+
+// Delete removes the port, or marks it as deleted, if soft deletes are enabled
+func (ps *portsService) Delete(ctx context.Context, code string) error {
+	if ps.softDelete {
+		return ps.repo.SoftDelete(ctx, code, time.Now().UTC())
+	}
+	return ps.repo.Delete(ctx, code)
+}
+
+// Restore unmarks the soft deleted port, and returns it
+func (ps *portsService) Restore(ctx context.Context, code string) (Port, error) {
+	if err := ps.repo.Restore(ctx, code); err != nil {
+		return Port{}, err
+	}
+	return ps.repo.Find(ctx, code)
+}
+
+/*
+Replace writes the port over the stored one, or creates it, and returns the stored port, and whether it was created;
+whether it was created is told by the storage, that upserts the port atomically, so that concurrent
+replaces of a missing port report a single creation. Replacing a soft deleted port restores it.
+*/
+func (ps *portsService) Replace(ctx context.Context, port Port) (Port, bool, error) {
+	if errs := Validate(port); len(errs) > 0 {
+		return Port{}, false, errs
+	}
+
+	port = normalizeCountry(port)
+	result, err := ps.repo.SaveMany(ctx, []Port{port})
+	if err != nil {
+		return Port{}, false, err
+	}
+	if len(result.Failures) > 0 {
+		return Port{}, false, result.Failures[0].Err
+	}
+	return port, result.Created > 0, nil
+}
+
+// Patch applies the patch to the port, and returns the patched port; the patch is rejected if the patched port is not valid
+func (ps *portsService) Patch(ctx context.Context, code string, patch PortPatch) (Port, error) {
+	port, err := ps.repo.Find(ctx, code)
+	if err != nil || patch.Empty() {
+		return port, err
+	}
+
+	patched, err := patch.Apply(port)
+	if err != nil {
+		return Port{}, err
+	}
+	if errs := Validate(patched); len(errs) > 0 {
+		return Port{}, errs
+	}
+
+	if code := normalizeCountry(patched).CountryCode; code != port.CountryCode {
+		if code == "" {
+			patch.Unset = append(patch.Unset, "country_code")
+		}
+		patch.Set.CountryCode = code
+	}
+
+	if err := ps.repo.Patch(ctx, code, patch); err != nil {
+		return Port{}, err
+	}
+	return ps.repo.Find(ctx, code)
+}
+
+func (ps *portsService) CreateOrUpdate(ctx context.Context, port Port) error {
+	if errs := Validate(port); len(errs) > 0 {
+		return errs
+	}
+	return ps.repo.Upsert(ctx, normalizeCountry(port))
+}
+
+func (ps *portsService) CreateOrUpdateMany(ctx context.Context, ports []Port) (ImportResult, error) {
+	return ps.CreateOrUpdateFrom(ctx, &sliceSource{ports})
+}
+
+/*
+CreateOrUpdateFrom reads the ports from the source, groups them in batches, and saves
+the batches using a bounded pool of workers. Reading from the source blocks while all
+workers are busy, so at most (concurrency + 1) batches are held in memory at a time.
+
+Ports that are not valid, or fail to be stored, are reported in the result, and don't stop the import;
+the country codes of the ports are set from the country names, and the mismatches are reported as warnings;
+an error is returned only if the source fails, a whole batch fails, ie. the storage is down, or the context is done.
+
+In replace mode, the codes of the source ports are kept, and once the whole source is
+imported, the stored ports with other codes are deleted, or soft deleted. Nothing is deleted
+if any port of the source failed, since its code may be missing, and an empty source is
+rejected with ErrEmptyReplace, rather than deleting all the stored ports.
+*/
+func (ps *portsService) CreateOrUpdateFrom(ctx context.Context, src PortSource, opts ...ImportOption) (ImportResult, error) {
+	var options importOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var codes *codesSource
+	if options.replace {
+		codes = &codesSource{src: src, codes: make(map[string]struct{})}
+		src = codes
+	}
+
+	var result ImportResult
+	var err error
+	if options.dryRun {
+		result.Failed, err = drain(ctx, src, options.partial)
+	} else {
+		result, err = ps.importFrom(ctx, src, options)
+	}
+	if err != nil || !options.replace {
+		return result, err
+	}
+	if len(codes.codes) == 0 {
+		return result, ErrEmptyReplace
+	}
+	if result.Failed > 0 {
+		result.RemovalSkipped = true
+		return result, nil
+	}
+
+	result.Removed, err = ps.removeMissing(ctx, codes.codes, options.dryRun)
+	return result, err
+}
+
+func (ps *portsService) importFrom(ctx context.Context, src PortSource, options importOptions) (ImportResult, error) {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(ps.concurrency)
+	results := &importResultCollector{progress: options.progress}
+
+	batch := make([]Port, 0, ps.batchSize)
+	for gctx.Err() == nil {
+		port, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		var recordErr *RecordError
+		if errors.As(err, &recordErr) && options.partial {
+			results.failRecord(ImportFailure{PortCode: recordErr.PortCode, Line: recordErr.Line, Reason: recordErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			g.Wait()
+			return results.get(), &SourceError{err}
+		}
+		if errs := Validate(port); len(errs) > 0 {
+			results.failRecord(ImportFailure{PortCode: port.PortCode, Line: sourceLine(src), Reason: errs.Error()})
+			continue
+		}
+		if warnings := Warn(port); len(warnings) > 0 {
+			results.warn(warnings)
+		}
+
+		batch = append(batch, normalizeCountry(port))
+		if len(batch) < ps.batchSize {
+			continue
+		}
+
+		g.Go(ps.wrapSaveMany(gctx, batch, results))
+		batch = make([]Port, 0, ps.batchSize)
+	}
+
+	if len(batch) > 0 && gctx.Err() == nil {
+		g.Go(ps.wrapSaveMany(gctx, batch, results))
+	}
+
+	if err := g.Wait(); err != nil {
+		return results.get(), err
+	}
+	return results.get(), ctx.Err()
+}
+
+func (ps *portsService) wrapSaveMany(ctx context.Context, ports []Port, results *importResultCollector) func() error {
 	return func() error {
-		return ps.CreateOrUpdate(ctx, port)
+		result, err := ps.repo.SaveMany(ctx, ports)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			return err
+		}
+
+		results.addBatch(ports, result)
+		return nil
+	}
+}
+
+// Export reads the ports from a storage cursor, so that only one port is held in memory at a time
+func (ps *portsService) Export(ctx context.Context, filter Filter, fn func(Port) error) error {
+	return ps.repo.Each(ctx, ListQuery{Filter: filter}, fn)
+}
+
+/*
+NormalizeCountries backfills the country codes of the ports, that were stored before the codes were
+set, or with a country table that has changed since; only the country code of a port is written,
+so that the ports written meanwhile are not overwritten. The soft deleted ports are skipped.
+*/
+func (ps *portsService) NormalizeCountries(ctx context.Context) (int, error) {
+	updated := 0
+	err := ps.repo.Each(ctx, ListQuery{}, func(port Port) error {
+		code := normalizeCountry(port).CountryCode
+		if code == port.CountryCode {
+			return nil
+		}
+
+		patch := PortPatch{Set: Port{CountryCode: code}}
+		if code == "" {
+			patch.Unset = []string{"country_code"}
+		}
+		err := ps.repo.Patch(ctx, port.PortCode, patch)
+		if errors.Is(err, storage.ErrNotFound) {
+			// the port was deleted meanwhile
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		updated++
+		return nil
+	})
+	return updated, err
+}
+
+/*
+removeMissing lists the stored ports page by page, and collects the ones missing from the
+source codes; they are deleted only after the listing, so that deletes don't move the pages.
+*/
+func (ps *portsService) removeMissing(ctx context.Context, codes map[string]struct{}, dryRun bool) ([]string, error) {
+	var missing []string
+	query := ListQuery{Limit: replaceScanSize}
+	for {
+		page, err := ps.repo.List(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, port := range page {
+			if _, found := codes[port.PortCode]; !found {
+				missing = append(missing, port.PortCode)
+			}
+		}
+		if len(page) < query.Limit {
+			break
+		}
+		query.After = page[len(page)-1].PortCode
+	}
+
+	if dryRun {
+		return missing, nil
+	}
+
+	removed := make([]string, 0, len(missing))
+	for _, code := range missing {
+		err := ps.Delete(ctx, code)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, code)
+	}
+	return removed, nil
+}
+
+/*
+Validate reads the ports from the source in batches, and compares each batch with the stored
+ports, that are fetched at once. Nothing is written, so the report can be used to review a file
+before importing it. Like a partial import, a malformed record is reported as an error, and the
+rest of the source is still read; only the errors, that stop the source, fail the validation.
+A port code found more than once in the source is an error too, as the import would keep only
+the last of the ports; the repeated ports are left out of the changes.
+*/
+func (ps *portsService) Validate(ctx context.Context, src PortSource) (ValidationReport, error) {
+	var report ValidationReport
+	batch := make([]Port, 0, ps.batchSize)
+	// firstLines are the lines of the ports read so far, by port code
+	firstLines := make(map[string]int)
+	for ctx.Err() == nil {
+		port, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		var recordErr *RecordError
+		if errors.As(err, &recordErr) {
+			report.invalid([]ValidationError{{PortCode: recordErr.PortCode, Line: recordErr.Line, Message: recordErr.Err.Error()}})
+			continue
+		}
+		if err != nil {
+			return report, &SourceError{err}
+		}
+
+		line := sourceLine(src)
+		if first, repeated := firstLines[port.PortCode]; repeated {
+			report.invalid([]ValidationError{repeatedError(port.PortCode, line, first)})
+			continue
+		}
+		if port.PortCode != "" {
+			firstLines[port.PortCode] = line
+		}
+
+		if errs := Validate(port); len(errs) > 0 {
+			report.invalid(atLine(errs, line))
+			continue
+		}
+		report.warn(atLine(Warn(port), line))
+
+		batch = append(batch, port)
+		if len(batch) < ps.batchSize {
+			continue
+		}
+		if err := ps.diffBatch(ctx, batch, &report); err != nil {
+			return report, err
+		}
+		batch = batch[:0]
+	}
+
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	if len(batch) > 0 {
+		return report, ps.diffBatch(ctx, batch, &report)
+	}
+	return report, nil
+}
+
+// repeatedError reports a port code, that was already read from the source, at the first line, if it is known
+func repeatedError(code string, line, first int) ValidationError {
+	message := "is repeated in the source"
+	if first > 0 {
+		message = fmt.Sprintf("is repeated, first found at line %d", first)
+	}
+	return ValidationError{PortCode: code, Line: line, Field: "port_code", Message: message}
+}
+
+// atLine sets the source line of the errors of a port
+func atLine(errs []ValidationError, line int) []ValidationError {
+	for i := range errs {
+		errs[i].Line = line
+	}
+	return errs
+}
+
+func (ps *portsService) diffBatch(ctx context.Context, batch []Port, report *ValidationReport) error {
+	codes := make([]string, 0, len(batch))
+	for _, port := range batch {
+		codes = append(codes, port.PortCode)
+	}
+
+	found, err := ps.repo.FindMany(ctx, codes)
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]Port, len(found))
+	for _, port := range found {
+		stored[port.PortCode] = port
+	}
+
+	for _, port := range batch {
+		current, exists := stored[port.PortCode]
+		if !exists {
+			report.added(port.PortCode)
+			continue
+		}
+		if diffs := diffPorts(current, port); len(diffs) > 0 {
+			report.changed(PortChange{PortCode: port.PortCode, Diffs: diffs})
+			continue
+		}
+		report.unchanged(port.PortCode)
+	}
+	return nil
+}
+
+// drain reads the whole source without storing the ports, and returns the number of ports, that would fail; in partial mode, the malformed records are skipped
+func drain(ctx context.Context, src PortSource, partial bool) (int, error) {
+	failed := 0
+	for ctx.Err() == nil {
+		port, err := src.Next()
+		if err == io.EOF {
+			return failed, nil
+		}
+		var recordErr *RecordError
+		if errors.As(err, &recordErr) && partial {
+			failed++
+			continue
+		}
+		if err != nil {
+			return failed, &SourceError{err}
+		}
+		if errs := Validate(port); len(errs) > 0 {
+			failed++
+		}
+	}
+	return failed, ctx.Err()
+}
+
+// codesSource keeps the codes of the ports read from the source
+type codesSource struct {
+	src   PortSource
+	codes map[string]struct{}
+}
+
+func (cs *codesSource) Next() (Port, error) {
+	port, err := cs.src.Next()
+	if err == nil {
+		cs.codes[port.PortCode] = struct{}{}
+	}
+	return port, err
+}
+
+func (cs *codesSource) Line() int {
+	return sourceLine(cs.src)
+}
+
+type sliceSource struct {
+	ports []Port
+}
+
+func (ss *sliceSource) Next() (Port, error) {
+	if len(ss.ports) == 0 {
+		return Port{}, io.EOF
 	}
+	port := ss.ports[0]
+	ss.ports = ss.ports[1:]
+	return port, nil
 }
@@ -2,7 +2,11 @@ package ports_test
 
 import (
 	"context"
+	"errors"
+	"io"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
 	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
@@ -30,42 +34,484 @@ func (mpr *MockPortRepo) Update(ctx context.Context, port ports.Port) error {
 	return args.Error(0)
 }
 
-func TestCreateOrUpdateMany(t *testing.T) {
-	t.Run("create if not found", func(t *testing.T) {
+func (mpr *MockPortRepo) Upsert(ctx context.Context, port ports.Port) error {
+	args := mpr.Called(ctx, port)
+	return args.Error(0)
+}
+
+func (mpr *MockPortRepo) List(ctx context.Context, query ports.ListQuery) ([]ports.Port, error) {
+	args := mpr.Called(ctx, query)
+	return args.Get(0).([]ports.Port), args.Error(1)
+}
+
+func (mpr *MockPortRepo) Each(ctx context.Context, query ports.ListQuery, fn func(ports.Port) error) error {
+	args := mpr.Called(ctx, query, fn)
+	return args.Error(0)
+}
+
+func (mpr *MockPortRepo) Near(ctx context.Context, query ports.NearbyQuery) ([]ports.Port, error) {
+	args := mpr.Called(ctx, query)
+	return args.Get(0).([]ports.Port), args.Error(1)
+}
+
+func (mpr *MockPortRepo) Within(ctx context.Context, query ports.WithinQuery) ([]ports.Port, error) {
+	args := mpr.Called(ctx, query)
+	return args.Get(0).([]ports.Port), args.Error(1)
+}
+
+func (mpr *MockPortRepo) Search(ctx context.Context, query ports.SearchQuery) ([]ports.Port, error) {
+	args := mpr.Called(ctx, query)
+	return args.Get(0).([]ports.Port), args.Error(1)
+}
+
+func (mpr *MockPortRepo) Autocomplete(ctx context.Context, query ports.AutocompleteQuery) ([]ports.Port, error) {
+	args := mpr.Called(ctx, query)
+	return args.Get(0).([]ports.Port), args.Error(1)
+}
+
+func (mpr *MockPortRepo) Delete(ctx context.Context, code string) error {
+	args := mpr.Called(ctx, code)
+	return args.Error(0)
+}
+
+func (mpr *MockPortRepo) SoftDelete(ctx context.Context, code string, at time.Time) error {
+	args := mpr.Called(ctx, code, at)
+	return args.Error(0)
+}
+
+func (mpr *MockPortRepo) Restore(ctx context.Context, code string) error {
+	args := mpr.Called(ctx, code)
+	return args.Error(0)
+}
+
+func (mpr *MockPortRepo) Patch(ctx context.Context, code string, patch ports.PortPatch) error {
+	args := mpr.Called(ctx, code, patch)
+	return args.Error(0)
+}
+
+func (mpr *MockPortRepo) FindMany(ctx context.Context, codes []string) ([]ports.Port, error) {
+	args := mpr.Called(ctx, codes)
+	return args.Get(0).([]ports.Port), args.Error(1)
+}
+
+func (mpr *MockPortRepo) SaveMany(ctx context.Context, pts []ports.Port) (storage.BulkUpsertResult, error) {
+	args := mpr.Called(ctx, pts)
+	return args.Get(0).(storage.BulkUpsertResult), args.Error(1)
+}
+
+func TestCreateOrUpdate(t *testing.T) {
+	t.Run("upsert port", func(t *testing.T) {
 		mockRepo := new(MockPortRepo)
 		service := ports.NewPortService(mockRepo)
-		p := ports.Port{PortCode: "TPC-00001"}
+		p := testPort("AEAJM")
 
-		ctx := context.Background()
-		mockRepo.On("Find", mock.Anything, mock.Anything).Return(ports.Port{}, storage.ErrNotFound)
-		mockRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("Upsert", mock.Anything, p).Return(nil)
 
-		pts := []ports.Port{p}
-		err := service.CreateOrUpdateMany(ctx, pts)
+		err := service.CreateOrUpdate(context.Background(), p)
 		require.NoError(t, err)
 
 		mockRepo.AssertExpectations(t)
-		mockRepo.AssertNumberOfCalls(t, "Find", len(pts))
-		mockRepo.AssertNumberOfCalls(t, "Create", len(pts))
+		mockRepo.AssertNotCalled(t, "Find", mock.Anything, mock.Anything)
 	})
 
-	t.Run("update if found", func(t *testing.T) {
+	t.Run("reject invalid port", func(t *testing.T) {
 		mockRepo := new(MockPortRepo)
 		service := ports.NewPortService(mockRepo)
-		p := ports.Port{PortCode: "TPC-00001"}
 
-		ctx := context.Background()
-		mockRepo.On("Find", mock.Anything, mock.Anything).Return(ports.Port{PortCode: "TPC-00001"}, nil)
-		mockRepo.On("Update", mock.Anything, mock.Anything).Return(nil)
+		err := service.CreateOrUpdate(context.Background(), ports.Port{PortCode: "TPC-00001"})
+		var errs ports.ValidationErrors
+		require.ErrorAs(t, err, &errs)
+		mockRepo.AssertNotCalled(t, "Upsert", mock.Anything, mock.Anything)
+	})
+
+	t.Run("return error if upsert fails", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("Upsert", mock.Anything, mock.Anything).Return(errors.New("upsert failed"))
 
-		pts := []ports.Port{p}
-		err := service.CreateOrUpdateMany(ctx, pts)
+		err := service.CreateOrUpdate(context.Background(), testPort("AEAJM"))
+		require.Error(t, err)
+	})
+}
+
+func TestCreateOrUpdateMany(t *testing.T) {
+	t.Run("save ports in batches", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo, ports.WithBatchSize(2))
+
+		pts := []ports.Port{testPort("AEAJM"), testPort("AEAUH"), testPort("AEDXB")}
+		mockRepo.On("SaveMany", mock.Anything, mock.Anything).Return(storage.BulkUpsertResult{}, nil)
+
+		_, err := service.CreateOrUpdateMany(context.Background(), pts)
 		require.NoError(t, err)
 
-		mockRepo.AssertExpectations(t)
-		mockRepo.AssertNumberOfCalls(t, "Find", len(pts))
-		mockRepo.AssertNumberOfCalls(t, "Update", len(pts))
+		mockRepo.AssertNumberOfCalls(t, "SaveMany", 2)
+		mockRepo.AssertCalled(t, "SaveMany", mock.Anything, pts[:2])
+		mockRepo.AssertCalled(t, "SaveMany", mock.Anything, pts[2:])
+	})
+
+	t.Run("report counts of the stored ports", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo, ports.WithBatchSize(3))
+
+		mockRepo.On("SaveMany", mock.Anything, mock.Anything).Return(storage.BulkUpsertResult{Created: 1, Updated: 1, Unchanged: 1}, nil)
+
+		pts := []ports.Port{testPort("AEAJM"), testPort("AEAUH"), testPort("AEDXB")}
+		result, err := service.CreateOrUpdateMany(context.Background(), append(pts, pts...))
+		require.NoError(t, err)
+		require.Equal(t, ports.ImportResult{Created: 2, Updated: 2, Unchanged: 2}, result)
+	})
+
+	t.Run("fail if a whole batch fails", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("SaveMany", mock.Anything, mock.Anything).Return(storage.BulkUpsertResult{}, errors.New("store failed"))
+
+		result, err := service.CreateOrUpdateMany(context.Background(), []ports.Port{testPort("AEAJM"), testPort("AEAUH")})
+		require.EqualError(t, err, "store failed")
+		require.Zero(t, result.Failed)
+	})
+
+	t.Run("cap the listed failures", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		invalid := make([]ports.Port, 0, ports.MaxImportFailures+5)
+		for i := 0; i < cap(invalid); i++ {
+			invalid = append(invalid, ports.Port{PortCode: testCode(i)})
+		}
+
+		result, err := service.CreateOrUpdateMany(context.Background(), invalid)
+		require.NoError(t, err)
+		require.Equal(t, ports.MaxImportFailures+5, result.Failed)
+		require.Len(t, result.Failures, ports.MaxImportFailures)
+		require.Equal(t, 5, result.OmittedFailures)
+	})
+
+	t.Run("report the ports that failed by port code", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("SaveMany", mock.Anything, mock.Anything).Return(storage.BulkUpsertResult{
+			Created:  1,
+			Failures: []storage.BulkFailure{{Index: 1, Err: errors.New("duplicate key")}},
+		}, nil)
+
+		result, err := service.CreateOrUpdateMany(context.Background(), []ports.Port{testPort("AEAJM"), testPort("AEAUH")})
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Created)
+		require.Equal(t, 1, result.Failed)
+		require.Equal(t, []ports.ImportFailure{{PortCode: "AEAUH", Reason: "duplicate key"}}, result.Failures)
+	})
+
+	t.Run("report invalid ports as failed, without storing them", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		valid := testPort("AEAJM")
+		mockRepo.On("SaveMany", mock.Anything, []ports.Port{valid}).Return(storage.BulkUpsertResult{Created: 1}, nil)
+
+		result, err := service.CreateOrUpdateMany(context.Background(), []ports.Port{valid, {PortCode: "AEAUH", Name: "Abu Dhabi"}})
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Created)
+		require.Equal(t, 1, result.Failed)
+		require.Equal(t, "AEAUH", result.Failures[0].PortCode)
+		require.Contains(t, result.Failures[0].Reason, "country")
+	})
+
+	t.Run("set country codes, and report country mismatches as warnings", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		port := ports.Port{PortCode: "AEKLF", Name: "Khor Fakkan", Country: "Oman"}
+		stored := port
+		stored.CountryCode = "OM"
+		mockRepo.On("SaveMany", mock.Anything, []ports.Port{stored}).Return(storage.BulkUpsertResult{Created: 1}, nil)
+
+		result, err := service.CreateOrUpdateMany(context.Background(), []ports.Port{port})
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Created)
+		require.Equal(t, []ports.ValidationError{{PortCode: "AEKLF", Field: "country", Message: "is OM, but the port code is from AE"}}, result.Warnings)
+	})
+
+	t.Run("cap the listed warnings", func(t *testing.T) {
+		service := ports.NewPortService(&concurrencyTrackingRepo{})
+
+		mismatched := make([]ports.Port, 0, ports.MaxImportFailures+5)
+		for i := 0; i < cap(mismatched); i++ {
+			mismatched = append(mismatched, ports.Port{PortCode: testCode(i), Name: "Port", Country: "Oman"})
+		}
+
+		result, err := service.CreateOrUpdateMany(context.Background(), mismatched)
+		require.NoError(t, err)
+		require.Equal(t, ports.MaxImportFailures+5, result.Created)
+		require.Len(t, result.Warnings, ports.MaxImportFailures)
+		require.Equal(t, 5, result.OmittedWarnings)
 	})
+
+	t.Run("limit the number of concurrent batches", func(t *testing.T) {
+		repo := &concurrencyTrackingRepo{}
+		service := ports.NewPortService(repo, ports.WithBatchSize(1), ports.WithConcurrency(3))
+
+		var pts []ports.Port
+		for i := 0; i < 50; i++ {
+			pts = append(pts, testPort(testCode(i)))
+		}
+
+		_, err := service.CreateOrUpdateMany(context.Background(), pts)
+		require.NoError(t, err)
+		require.LessOrEqual(t, repo.max, int32(3))
+		require.Equal(t, int32(len(pts)), repo.calls)
+	})
+}
+
+// testPort returns a valid port with the code
+func testPort(code string) ports.Port {
+	return ports.Port{PortCode: code, Name: code, Country: "United Arab Emirates", CountryCode: "AE"}
+}
+
+// testCode returns the i-th of the valid port codes, in ascending order
+func testCode(i int) string {
+	const symbols = "23456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	code := []byte("AE000")
+	for pos := len(code) - 1; pos >= 2; pos-- {
+		code[pos] = symbols[i%len(symbols)]
+		i /= len(symbols)
+	}
+	return string(code)
+}
+
+type concurrencyTrackingRepo struct {
+	MockPortRepo
+	active, max, calls int32
+}
+
+func (ctr *concurrencyTrackingRepo) SaveMany(ctx context.Context, pts []ports.Port) (storage.BulkUpsertResult, error) {
+	active := atomic.AddInt32(&ctr.active, 1)
+	defer atomic.AddInt32(&ctr.active, -1)
+	atomic.AddInt32(&ctr.calls, 1)
+
+	for {
+		max := atomic.LoadInt32(&ctr.max)
+		if active <= max || atomic.CompareAndSwapInt32(&ctr.max, max, active) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return storage.BulkUpsertResult{Created: len(pts)}, nil
+}
+
+type sliceSource struct {
+	ports []ports.Port
+	err   error
+}
+
+func (ss *sliceSource) Next() (ports.Port, error) {
+	if len(ss.ports) == 0 {
+		if ss.err != nil {
+			return ports.Port{}, ss.err
+		}
+		return ports.Port{}, io.EOF
+	}
+	port := ss.ports[0]
+	ss.ports = ss.ports[1:]
+	return port, nil
+}
+
+// lineSource reads a port per line, where the empty ports are the malformed lines
+type lineSource struct {
+	ports []ports.Port
+	line  int
+}
+
+func (ls *lineSource) Next() (ports.Port, error) {
+	if ls.line == len(ls.ports) {
+		return ports.Port{}, io.EOF
+	}
+	ls.line++
+	if port := ls.ports[ls.line-1]; port.PortCode != "" {
+		return port, nil
+	}
+	return ports.Port{}, &ports.RecordError{Line: ls.line, Err: errors.New("malformed line")}
+}
+
+func (ls *lineSource) Line() int {
+	return ls.line
+}
+
+func TestCreateOrUpdateFrom(t *testing.T) {
+	t.Run("store all ports from source", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		var pts []ports.Port
+		for i := 0; i < 1234; i++ {
+			pts = append(pts, testPort(testCode(i)))
+		}
+
+		mockRepo.On("SaveMany", mock.Anything, mock.Anything).Return(storage.BulkUpsertResult{}, nil)
+
+		_, err := service.CreateOrUpdateFrom(context.Background(), &sliceSource{ports: pts})
+		require.NoError(t, err)
+
+		mockRepo.AssertNumberOfCalls(t, "SaveMany", 3)
+	})
+
+	t.Run("report progress after each batch", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo, ports.WithBatchSize(1), ports.WithConcurrency(1))
+
+		mockRepo.On("SaveMany", mock.Anything, mock.Anything).Return(storage.BulkUpsertResult{Created: 1}, nil)
+
+		var progress []int
+		pts := []ports.Port{testPort("AEAJM"), testPort("AEAUH")}
+		_, err := service.CreateOrUpdateFrom(context.Background(), &sliceSource{ports: pts}, ports.WithProgress(func(result ports.ImportResult) {
+			progress = append(progress, result.Created)
+		}))
+		require.NoError(t, err)
+		require.Equal(t, []int{1, 2}, progress)
+	})
+
+	t.Run("skip malformed records in partial mode, and report them by line", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		valid := testPort("AEDXB")
+		mockRepo.On("SaveMany", mock.Anything, []ports.Port{valid}).Return(storage.BulkUpsertResult{Created: 1}, nil)
+
+		src := &lineSource{ports: []ports.Port{{}, valid, {PortCode: "AEAUH"}}}
+		result, err := service.CreateOrUpdateFrom(context.Background(), src, ports.WithPartial())
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Created)
+		require.Equal(t, []ports.ImportFailure{
+			{Line: 1, Reason: "malformed line"},
+			{PortCode: "AEAUH", Line: 3, Reason: "invalid port: AEAUH.name: is required; AEAUH.country: is required"},
+		}, result.Failures)
+	})
+
+	t.Run("fail on malformed record, if not in partial mode", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		_, err := service.CreateOrUpdateFrom(context.Background(), &lineSource{ports: []ports.Port{{}}})
+
+		var recordErr *ports.RecordError
+		require.ErrorAs(t, err, &recordErr)
+		require.Equal(t, 1, recordErr.Line)
+	})
+
+	t.Run("return source error if source fails", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		_, err := service.CreateOrUpdateFrom(context.Background(), &sliceSource{err: errors.New("bad json")})
+
+		var sourceErr *ports.SourceError
+		require.ErrorAs(t, err, &sourceErr)
+		mockRepo.AssertNotCalled(t, "SaveMany", mock.Anything, mock.Anything)
+	})
+}
+
+func TestList(t *testing.T) {
+	t.Run("return next cursor if there are more ports", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("List", mock.Anything, ports.ListQuery{Limit: 3}).
+			Return([]ports.Port{{PortCode: "TPC-00001"}, {PortCode: "TPC-00002"}, {PortCode: "TPC-00003"}}, nil)
+
+		page, err := service.List(context.Background(), ports.ListQuery{Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Ports, 2)
+		require.Equal(t, "TPC-00002", page.NextCursor)
+	})
+
+	t.Run("return no cursor on the last page", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("List", mock.Anything, ports.ListQuery{After: "TPC-00002", Limit: 3}).
+			Return([]ports.Port{{PortCode: "TPC-00003"}}, nil)
+
+		page, err := service.List(context.Background(), ports.ListQuery{After: "TPC-00002", Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Ports, 1)
+		require.Empty(t, page.NextCursor)
+	})
+}
+
+func TestNormalizeCountries(t *testing.T) {
+	mockRepo := new(MockPortRepo)
+	service := ports.NewPortService(mockRepo)
+
+	missing, deleted := testPort("AEAJM"), testPort("AEAUH")
+	missing.CountryCode, deleted.CountryCode = "", ""
+	unknown := ports.Port{PortCode: "XXAAA", Country: "Atlantis", CountryCode: "AE"}
+
+	mockRepo.On("Each", mock.Anything, ports.ListQuery{}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			fn := args.Get(2).(func(ports.Port) error)
+			for _, port := range []ports.Port{missing, deleted, testPort("AEDXB"), unknown} {
+				if err := fn(port); err != nil {
+					return
+				}
+			}
+		}).
+		Return(nil)
+	mockRepo.On("Patch", mock.Anything, "AEAJM", ports.PortPatch{Set: ports.Port{CountryCode: "AE"}}).Return(nil)
+	mockRepo.On("Patch", mock.Anything, "AEAUH", ports.PortPatch{Set: ports.Port{CountryCode: "AE"}}).Return(storage.ErrNotFound)
+	mockRepo.On("Patch", mock.Anything, "XXAAA", ports.PortPatch{Unset: []string{"country_code"}}).Return(nil)
+
+	updated, err := service.NormalizeCountries(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, updated)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "Patch", mock.Anything, "AEDXB", mock.Anything)
+}
+
+func TestExport(t *testing.T) {
+	mockRepo := new(MockPortRepo)
+	service := ports.NewPortService(mockRepo)
+
+	filter := ports.Filter{CountryCode: "AE"}
+	mockRepo.On("Each", mock.Anything, ports.ListQuery{Filter: filter}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			fn := args.Get(2).(func(ports.Port) error)
+			for _, code := range []string{"AEAJM", "AEAUH"} {
+				if err := fn(testPort(code)); err != nil {
+					return
+				}
+			}
+		}).
+		Return(nil)
+
+	var exported []string
+	err := service.Export(context.Background(), filter, func(port ports.Port) error {
+		exported = append(exported, port.PortCode)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"AEAJM", "AEAUH"}, exported)
+}
+
+func TestNearby(t *testing.T) {
+	mockRepo := new(MockPortRepo)
+	service := ports.NewPortService(mockRepo)
+
+	query := ports.NearbyQuery{Lon: 55.27, Lat: 25.25, RadiusKm: 100, Limit: 10}
+	mockRepo.On("Near", mock.Anything, query).Return([]ports.Port{
+		{PortCode: "AEDXB", Coordinates: []float64{55.27, 25.25}},
+		{PortCode: "AEJEA", Coordinates: []float64{55.0272904, 24.9857145}},
+	}, nil)
+
+	nearby, err := service.Nearby(context.Background(), query)
+	require.NoError(t, err)
+	require.Len(t, nearby, 2)
+	require.Equal(t, "AEDXB", nearby[0].PortCode)
+	require.Zero(t, nearby[0].DistanceKm)
+	require.InDelta(t, 38.2, nearby[1].DistanceKm, 0.5)
 }
 
 func TestGetByCode(t *testing.T) {
@@ -84,3 +530,418 @@ func TestGetByCode(t *testing.T) {
 		mockRepo.AssertNumberOfCalls(t, "Find", 1)
 	})
 }
+
+func TestWithin(t *testing.T) {
+	mockRepo := new(MockPortRepo)
+	service := ports.NewPortService(mockRepo)
+
+	box := &storage.BBox{MinLon: 54, MinLat: 24, MaxLon: 56, MaxLat: 26}
+	mockRepo.On("Within", mock.Anything, ports.WithinQuery{Box: box, Limit: ports.DefaultWithinLimit}).
+		Return([]ports.Port{{PortCode: "AEDXB"}}, nil)
+
+	found, err := service.Within(context.Background(), ports.WithinQuery{Box: box})
+	require.NoError(t, err)
+	require.Equal(t, []ports.Port{{PortCode: "AEDXB"}}, found)
+}
+
+func TestSearch(t *testing.T) {
+	mockRepo := new(MockPortRepo)
+	service := ports.NewPortService(mockRepo)
+
+	mockRepo.On("Search", mock.Anything, ports.SearchQuery{Text: "abu dhabi", Limit: ports.DefaultSearchLimit}).
+		Return([]ports.Port{{PortCode: "AEAUH"}}, nil)
+
+	found, err := service.Search(context.Background(), ports.SearchQuery{Text: "abu dhabi"})
+	require.NoError(t, err)
+	require.Equal(t, []ports.Port{{PortCode: "AEAUH"}}, found)
+}
+
+func TestAutocomplete(t *testing.T) {
+	mockRepo := new(MockPortRepo)
+	service := ports.NewPortService(mockRepo)
+
+	mockRepo.On("Autocomplete", mock.Anything, ports.AutocompleteQuery{Prefix: "du", Limit: ports.DefaultAutocompleteLimit}).
+		Return([]ports.Port{{PortCode: "AEDXB"}}, nil)
+
+	found, err := service.Autocomplete(context.Background(), ports.AutocompleteQuery{Prefix: "du"})
+	require.NoError(t, err)
+	require.Equal(t, []ports.Port{{PortCode: "AEDXB"}}, found)
+}
+
+func TestDelete(t *testing.T) {
+	t.Run("remove port", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("Delete", mock.Anything, "AEDXB").Return(nil)
+
+		require.NoError(t, service.Delete(context.Background(), "AEDXB"))
+		mockRepo.AssertNotCalled(t, "SoftDelete", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("mark port as deleted if soft deletes are enabled", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo, ports.WithSoftDelete(true))
+
+		before := time.Now()
+		mockRepo.On("SoftDelete", mock.Anything, "AEDXB", mock.MatchedBy(func(at time.Time) bool {
+			return !at.Before(before.Truncate(time.Second)) && at.Location() == time.UTC
+		})).Return(nil)
+
+		require.NoError(t, service.Delete(context.Background(), "AEDXB"))
+		mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+}
+
+func TestRestore(t *testing.T) {
+	t.Run("return restored port", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo, ports.WithSoftDelete(true))
+
+		mockRepo.On("Restore", mock.Anything, "AEDXB").Return(nil)
+		mockRepo.On("Find", mock.Anything, "AEDXB").Return(ports.Port{PortCode: "AEDXB"}, nil)
+
+		port, err := service.Restore(context.Background(), "AEDXB")
+		require.NoError(t, err)
+		require.Equal(t, "AEDXB", port.PortCode)
+	})
+
+	t.Run("fail if port is not deleted", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo, ports.WithSoftDelete(true))
+
+		mockRepo.On("Restore", mock.Anything, "AEDXB").Return(storage.ErrNotFound)
+
+		_, err := service.Restore(context.Background(), "AEDXB")
+		require.ErrorIs(t, err, storage.ErrNotFound)
+		mockRepo.AssertNotCalled(t, "Find", mock.Anything, mock.Anything)
+	})
+}
+
+func TestReplace(t *testing.T) {
+	t.Run("report created port", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		port := ports.Port{PortCode: "AEDXB", Name: "Dubai", Country: "UAE"}
+		stored := port
+		stored.CountryCode = "AE"
+		mockRepo.On("SaveMany", mock.Anything, []ports.Port{stored}).Return(storage.BulkUpsertResult{Created: 1}, nil)
+
+		replaced, created, err := service.Replace(context.Background(), port)
+		require.NoError(t, err)
+		require.True(t, created)
+		require.Equal(t, stored, replaced)
+		mockRepo.AssertNotCalled(t, "Find", mock.Anything, mock.Anything)
+	})
+
+	t.Run("report replaced port", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		port := testPort("AEDXB")
+		mockRepo.On("SaveMany", mock.Anything, []ports.Port{port}).Return(storage.BulkUpsertResult{Updated: 1}, nil)
+
+		_, created, err := service.Replace(context.Background(), port)
+		require.NoError(t, err)
+		require.False(t, created)
+	})
+
+	t.Run("fail if port is not written", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		port := testPort("AEDXB")
+		mockRepo.On("SaveMany", mock.Anything, []ports.Port{port}).
+			Return(storage.BulkUpsertResult{Failures: []storage.BulkFailure{{Index: 0, Err: errors.New("write failed")}}}, nil)
+
+		_, _, err := service.Replace(context.Background(), port)
+		require.EqualError(t, err, "write failed")
+	})
+
+	t.Run("reject invalid port", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		port := testPort("AEDXB")
+		port.Timezone = "Asia/Atlantis"
+
+		_, _, err := service.Replace(context.Background(), port)
+		var errs ports.ValidationErrors
+		require.ErrorAs(t, err, &errs)
+		mockRepo.AssertNotCalled(t, "SaveMany", mock.Anything, mock.Anything)
+	})
+}
+
+func TestPatch(t *testing.T) {
+	t.Run("return patched port", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		patch := ports.PortPatch{Set: ports.Port{Timezone: "Asia/Dubai"}}
+		mockRepo.On("Patch", mock.Anything, "AEDXB", patch).Return(nil)
+		mockRepo.On("Find", mock.Anything, "AEDXB").Return(testPort("AEDXB"), nil).Once()
+		mockRepo.On("Find", mock.Anything, "AEDXB").Return(ports.Port{PortCode: "AEDXB", Timezone: "Asia/Dubai"}, nil)
+
+		port, err := service.Patch(context.Background(), "AEDXB", patch)
+		require.NoError(t, err)
+		require.Equal(t, "Asia/Dubai", port.Timezone)
+	})
+
+	t.Run("update country code with country", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("Find", mock.Anything, "AEDXB").Return(testPort("AEDXB"), nil)
+		mockRepo.On("Patch", mock.Anything, "AEDXB", ports.PortPatch{Set: ports.Port{Country: "Oman", CountryCode: "OM"}}).Return(nil)
+
+		_, err := service.Patch(context.Background(), "AEDXB", ports.PortPatch{Set: ports.Port{Country: "Oman"}})
+		require.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("reject patch that makes the port invalid", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("Find", mock.Anything, "AEDXB").Return(testPort("AEDXB"), nil)
+
+		_, err := service.Patch(context.Background(), "AEDXB", ports.PortPatch{Unset: []string{"name"}})
+		var errs ports.ValidationErrors
+		require.ErrorAs(t, err, &errs)
+		require.Equal(t, "name", errs[0].Field)
+		mockRepo.AssertNotCalled(t, "Patch", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("skip empty patch", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("Find", mock.Anything, "AEDXB").Return(ports.Port{PortCode: "AEDXB"}, nil)
+
+		_, err := service.Patch(context.Background(), "AEDXB", ports.PortPatch{})
+		require.NoError(t, err)
+		mockRepo.AssertNotCalled(t, "Patch", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestCreateOrUpdateFromReplace(t *testing.T) {
+	stored := []ports.Port{testPort("AEAUH"), testPort("AEDXB"), testPort("AEJEA")}
+	pts := []ports.Port{testPort("AEDXB"), testPort("AEKLF")}
+
+	t.Run("remove ports missing from source", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("SaveMany", mock.Anything, pts).Return(storage.BulkUpsertResult{Created: 1, Updated: 1}, nil)
+		mockRepo.On("List", mock.Anything, mock.Anything).Return(stored, nil)
+		mockRepo.On("Delete", mock.Anything, mock.Anything).Return(nil)
+
+		result, err := service.CreateOrUpdateFrom(context.Background(), &sliceSource{ports: pts}, ports.WithReplace())
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Created)
+		require.Equal(t, []string{"AEAUH", "AEJEA"}, result.Removed)
+		mockRepo.AssertCalled(t, "Delete", mock.Anything, "AEAUH")
+		mockRepo.AssertCalled(t, "Delete", mock.Anything, "AEJEA")
+	})
+
+	t.Run("soft delete ports missing from source if soft deletes are enabled", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo, ports.WithSoftDelete(true))
+
+		mockRepo.On("SaveMany", mock.Anything, pts).Return(storage.BulkUpsertResult{Created: 1, Updated: 1}, nil)
+		mockRepo.On("List", mock.Anything, mock.Anything).Return(stored, nil)
+		mockRepo.On("SoftDelete", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+		result, err := service.CreateOrUpdateFrom(context.Background(), &sliceSource{ports: pts}, ports.WithReplace())
+		require.NoError(t, err)
+		require.Equal(t, []string{"AEAUH", "AEJEA"}, result.Removed)
+		mockRepo.AssertNumberOfCalls(t, "SoftDelete", 2)
+	})
+
+	t.Run("scan stored ports page by page", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		var full []ports.Port
+		for i := 0; i < 1000; i++ {
+			full = append(full, testPort(testCode(i)))
+		}
+		mockRepo.On("SaveMany", mock.Anything, mock.Anything).Return(storage.BulkUpsertResult{}, nil)
+		mockRepo.On("List", mock.Anything, ports.ListQuery{Limit: 1000}).Return(full, nil)
+		mockRepo.On("List", mock.Anything, ports.ListQuery{After: testCode(999), Limit: 1000}).Return([]ports.Port{testPort(testCode(1000))}, nil)
+		mockRepo.On("Delete", mock.Anything, testCode(1000)).Return(nil)
+
+		result, err := service.CreateOrUpdateFrom(context.Background(), &sliceSource{ports: full}, ports.WithReplace())
+		require.NoError(t, err)
+		require.Equal(t, []string{testCode(1000)}, result.Removed)
+		mockRepo.AssertNumberOfCalls(t, "List", 2)
+	})
+
+	t.Run("only report ports missing from source on dry run", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("List", mock.Anything, mock.Anything).Return(stored, nil)
+
+		result, err := service.CreateOrUpdateFrom(context.Background(), &sliceSource{ports: pts}, ports.WithReplace(), ports.WithDryRun())
+		require.NoError(t, err)
+		require.Equal(t, []string{"AEAUH", "AEJEA"}, result.Removed)
+		mockRepo.AssertNotCalled(t, "SaveMany", mock.Anything, mock.Anything)
+		mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+
+	t.Run("remove nothing if source fails", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("SaveMany", mock.Anything, mock.Anything).Return(storage.BulkUpsertResult{}, nil)
+
+		_, err := service.CreateOrUpdateFrom(context.Background(), &sliceSource{ports: pts, err: errors.New("bad json")}, ports.WithReplace())
+		require.Error(t, err)
+		mockRepo.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+		mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+
+	t.Run("remove nothing if some ports fail", func(t *testing.T) {
+		invalid := append([]ports.Port{{PortCode: "AEAUH"}}, pts...)
+		for _, opts := range [][]ports.ImportOption{
+			{ports.WithReplace()},
+			{ports.WithReplace(), ports.WithDryRun()},
+		} {
+			mockRepo := new(MockPortRepo)
+			service := ports.NewPortService(mockRepo)
+
+			mockRepo.On("SaveMany", mock.Anything, pts).Return(storage.BulkUpsertResult{Created: 1, Updated: 1}, nil)
+
+			result, err := service.CreateOrUpdateFrom(context.Background(), &sliceSource{ports: invalid}, opts...)
+			require.NoError(t, err)
+			require.Equal(t, 1, result.Failed)
+			require.True(t, result.RemovalSkipped)
+			require.Empty(t, result.Removed)
+			mockRepo.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+			mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+		}
+	})
+
+	t.Run("fail if source is empty", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		_, err := service.CreateOrUpdateFrom(context.Background(), &sliceSource{}, ports.WithReplace())
+		require.ErrorIs(t, err, ports.ErrEmptyReplace)
+		mockRepo.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+		mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	mockRepo := new(MockPortRepo)
+	service := ports.NewPortService(mockRepo, ports.WithBatchSize(2))
+
+	mockRepo.On("FindMany", mock.Anything, []string{"AEAJM", "AEDXB"}).Return([]ports.Port{
+		{PortCode: "AEDXB", Name: "Dubai", Country: "United Arab Emirates", Timezone: "Asia/Dubai"},
+		testPort("AEAJM"),
+	}, nil)
+	mockRepo.On("FindMany", mock.Anything, []string{"AEKLF"}).Return([]ports.Port{}, nil)
+
+	report, err := service.Validate(context.Background(), &sliceSource{ports: []ports.Port{
+		testPort("AEAJM"),
+		{PortCode: "AEQIW", Country: "United Arab Emirates"},
+		{PortCode: "AEDXB", Name: "Dubai", Country: "United Arab Emirates", Timezone: "Asia/Muscat"},
+		testPort("AEKLF"),
+	}})
+	require.NoError(t, err)
+	require.False(t, report.Valid())
+	require.Equal(t, []string{"AEKLF"}, report.New)
+	require.Equal(t, []string{"AEAJM"}, report.Unchanged)
+	require.Equal(t, []ports.PortChange{{
+		PortCode: "AEDXB",
+		Diffs:    []ports.FieldDiff{{Field: "timezone", Old: "Asia/Dubai", New: "Asia/Muscat"}},
+	}}, report.Changed)
+	require.Equal(t, []ports.ValidationError{{PortCode: "AEQIW", Field: "name", Message: "is required"}}, report.Errors)
+	mockRepo.AssertNotCalled(t, "SaveMany", mock.Anything, mock.Anything)
+}
+
+func TestValidateMalformedRecords(t *testing.T) {
+	t.Run("report malformed records by line, and read past them", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("FindMany", mock.Anything, []string{"AEAJM", "AEDXB"}).Return([]ports.Port{}, nil)
+
+		report, err := service.Validate(context.Background(), &lineSource{ports: []ports.Port{
+			testPort("AEAJM"),
+			{},
+			{PortCode: "AEQIW", Country: "United Arab Emirates"},
+			testPort("AEDXB"),
+		}})
+		require.NoError(t, err)
+		require.False(t, report.Valid())
+		require.Equal(t, 2, report.Invalid)
+		require.Equal(t, []string{"AEAJM", "AEDXB"}, report.New)
+		require.Equal(t, []ports.ValidationError{
+			{Line: 2, Message: "malformed line"},
+			{PortCode: "AEQIW", Line: 3, Field: "name", Message: "is required"},
+		}, report.Errors)
+	})
+
+	t.Run("fail if the source can't be read", func(t *testing.T) {
+		service := ports.NewPortService(new(MockPortRepo))
+
+		_, err := service.Validate(context.Background(), &sliceSource{err: errors.New("unexpected EOF")})
+		var sourceErr *ports.SourceError
+		require.ErrorAs(t, err, &sourceErr)
+	})
+
+	t.Run("cap the listed errors", func(t *testing.T) {
+		service := ports.NewPortService(new(MockPortRepo))
+
+		invalid := make([]ports.Port, 0, ports.MaxImportFailures+5)
+		for i := 0; i < cap(invalid); i++ {
+			invalid = append(invalid, ports.Port{PortCode: testCode(i), Country: "United Arab Emirates"})
+		}
+
+		report, err := service.Validate(context.Background(), &sliceSource{ports: invalid})
+		require.NoError(t, err)
+		require.Equal(t, ports.MaxImportFailures+5, report.Invalid)
+		require.Len(t, report.Errors, ports.MaxImportFailures)
+		require.Equal(t, 5, report.OmittedErrors)
+	})
+
+	t.Run("report repeated port codes, and leave them out of the changes", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo)
+
+		mockRepo.On("FindMany", mock.Anything, []string{"AEAJM", "AEDXB"}).Return([]ports.Port{}, nil)
+
+		report, err := service.Validate(context.Background(), &lineSource{ports: []ports.Port{
+			testPort("AEAJM"),
+			testPort("AEDXB"),
+			testPort("AEAJM"),
+		}})
+		require.NoError(t, err)
+		require.False(t, report.Valid())
+		require.Equal(t, []string{"AEAJM", "AEDXB"}, report.New)
+		require.Equal(t, []ports.ValidationError{
+			{PortCode: "AEAJM", Line: 3, Field: "port_code", Message: "is repeated, first found at line 1"},
+		}, report.Errors)
+	})
+
+	t.Run("cap the listed ports", func(t *testing.T) {
+		mockRepo := new(MockPortRepo)
+		service := ports.NewPortService(mockRepo, ports.WithBatchSize(ports.MaxImportFailures+5))
+
+		added := make([]ports.Port, 0, ports.MaxImportFailures+5)
+		for i := 0; i < cap(added); i++ {
+			added = append(added, testPort(testCode(i)))
+		}
+		mockRepo.On("FindMany", mock.Anything, mock.Anything).Return([]ports.Port{}, nil)
+
+		report, err := service.Validate(context.Background(), &sliceSource{ports: added})
+		require.NoError(t, err)
+		require.True(t, report.Valid())
+		require.Len(t, report.New, ports.MaxImportFailures)
+		require.Equal(t, 5, report.OmittedNew)
+	})
+}
@@ -0,0 +1,93 @@
+package ports
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// unlocodePattern matches a UN/LOCODE: the ISO 3166 country code, followed by 3 letters or digits from 2 to 9
+var unlocodePattern = regexp.MustCompile(`^[A-Z]{2}[A-Z2-9]{3}$`)
+
+// ValidationError describes a field of a port, that breaks a validation rule
+type ValidationError struct {
+	PortCode string
+	// Line is the line of the port in the source, if it is known
+	Line    int
+	Field   string
+	Message string
+}
+
+func (ve ValidationError) Error() string {
+	return fmt.Sprintf("%s.%s: %s", ve.PortCode, ve.Field, ve.Message)
+}
+
+// ValidationErrors is returned by the writes of ports, that break validation rules, and lists all the broken rules
+type ValidationErrors []ValidationError
+
+func (ve ValidationErrors) Error() string {
+	messages := make([]string, 0, len(ve))
+	for _, err := range ve {
+		messages = append(messages, err.Error())
+	}
+	return "invalid port: " + strings.Join(messages, "; ")
+}
+
+/*
+Validate checks the port against the validation rules, and returns all the broken ones:
+  - the port code, name and country are required
+  - the port code and the unlocs are UN/LOCODEs
+  - the coordinates, if set, are a [longitude, latitude] pair
+  - the timezone, if set, is a name from the tz database
+*/
+func Validate(port Port) ValidationErrors {
+	var errs ValidationErrors
+	fail := func(field, message string) {
+		errs = append(errs, ValidationError{PortCode: port.PortCode, Field: field, Message: message})
+	}
+
+	if port.PortCode == "" {
+		fail("port_code", "is required")
+	} else if !unlocodePattern.MatchString(port.PortCode) {
+		fail("port_code", "should be a 5 character UN/LOCODE")
+	}
+	if port.Name == "" {
+		fail("name", "is required")
+	}
+	if port.Country == "" {
+		fail("country", "is required")
+	}
+
+	for i, unloc := range port.Unlocs {
+		if !unlocodePattern.MatchString(unloc) {
+			fail(fmt.Sprintf("unlocs[%d]", i), "should be a 5 character UN/LOCODE")
+		}
+	}
+
+	if coords := port.Coordinates; len(coords) > 0 {
+		switch {
+		case len(coords) != 2:
+			fail("coordinates", "should be a [longitude, latitude] pair")
+		case coords[0] < -180 || coords[0] > 180:
+			fail("coordinates", "longitude should be between -180 and 180")
+		case coords[1] < -90 || coords[1] > 90:
+			fail("coordinates", "latitude should be between -90 and 90")
+		}
+	}
+
+	if port.Timezone != "" && !validTimezone(port.Timezone) {
+		fail("timezone", "is not a known time zone")
+	}
+
+	return errs
+}
+
+// validTimezone checks the name against the tz database; "UTC" and "Local" are special names of LoadLocation, and only the first one is in the database
+func validTimezone(name string) bool {
+	if name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
@@ -0,0 +1,57 @@
+package ports
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	valid := Port{
+		PortCode:    "AEDXB",
+		Name:        "Dubai",
+		Country:     "United Arab Emirates",
+		Coordinates: []float64{55.27, 25.25},
+		Timezone:    "Asia/Dubai",
+		Unlocs:      []string{"AEDXB"},
+	}
+
+	t.Run("accept valid port", func(t *testing.T) {
+		require.Empty(t, Validate(valid))
+		require.Empty(t, Validate(Port{PortCode: "US2NY", Name: "New York", Country: "United States"}))
+	})
+
+	tests := []struct {
+		name   string
+		change func(*Port)
+		field  string
+	}{
+		{"require port code", func(p *Port) { p.PortCode = "" }, "port_code"},
+		{"require UN/LOCODE port code", func(p *Port) { p.PortCode = "aedxb" }, "port_code"},
+		{"reject digits 0 and 1 in port code", func(p *Port) { p.PortCode = "AED01" }, "port_code"},
+		{"require name", func(p *Port) { p.Name = "" }, "name"},
+		{"require country", func(p *Port) { p.Country = "" }, "country"},
+		{"require UN/LOCODE unlocs", func(p *Port) { p.Unlocs = []string{"AEDXB", "DXB"} }, "unlocs[1]"},
+		{"require coordinates pair", func(p *Port) { p.Coordinates = []float64{55.27} }, "coordinates"},
+		{"require longitude in range", func(p *Port) { p.Coordinates = []float64{255.27, 25.25} }, "coordinates"},
+		{"require latitude in range", func(p *Port) { p.Coordinates = []float64{55.27, -95} }, "coordinates"},
+		{"require known timezone", func(p *Port) { p.Timezone = "Asia/Atlantis" }, "timezone"},
+		{"reject local timezone", func(p *Port) { p.Timezone = "Local" }, "timezone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := valid
+			tt.change(&port)
+
+			errs := Validate(port)
+			require.Len(t, errs, 1)
+			require.Equal(t, tt.field, errs[0].Field)
+		})
+	}
+
+	t.Run("report all broken rules", func(t *testing.T) {
+		errs := Validate(Port{PortCode: "AEDXB", Timezone: "Dubai"})
+		require.Len(t, errs, 3)
+		require.EqualError(t, errs, "invalid port: AEDXB.name: is required; AEDXB.country: is required; AEDXB.timezone: is not a known time zone")
+	})
+}
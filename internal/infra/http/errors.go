@@ -3,4 +3,6 @@ package http
 type ApiError struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// Details lists the causes of the error, when there are several of them, ie. the broken validation rules
+	Details interface{} `json:"details,omitempty"`
 }
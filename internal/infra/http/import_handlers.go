@@ -0,0 +1,171 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/imports"
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/gin-gonic/gin"
+)
+
+func ImportHandlers(jobs *imports.Manager) DomainHandler {
+	return DomainHandler{
+		Path: "/",
+		Middlewares: []gin.HandlerFunc{
+			requestLogMiddleware,
+		},
+		Routes: []Route{
+			{
+				Path:    "/imports/:id",
+				Method:  http.MethodGet,
+				Handler: getImportJobHandler(jobs),
+			},
+			{
+				Path:    "/imports/:id",
+				Method:  http.MethodDelete,
+				Handler: cancelImportJobHandler(jobs),
+			},
+		},
+	}
+}
+
+func getImportJobHandler(jobs *imports.Manager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		job, err := jobs.Get(ctx.Param("id"))
+		if err != nil {
+			ctx.SecureJSON(http.StatusNotFound, ApiError{
+				Code:    "not_found",
+				Message: "No import job found with the specified id",
+			})
+			return
+		}
+
+		ctx.SecureJSON(http.StatusOK, importJob(job))
+	}
+}
+
+func cancelImportJobHandler(jobs *imports.Manager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		job, err := jobs.Cancel(ctx.Param("id"))
+		if errors.Is(err, imports.ErrJobNotFound) {
+			ctx.SecureJSON(http.StatusNotFound, ApiError{
+				Code:    "not_found",
+				Message: "No import job found with the specified id",
+			})
+			return
+		}
+		if errors.Is(err, imports.ErrJobFinished) {
+			ctx.SecureJSON(http.StatusConflict, ApiError{
+				Code:    "job_finished",
+				Message: "The import job is already finished, and can't be cancelled",
+			})
+			return
+		}
+
+		ctx.SecureJSON(http.StatusAccepted, importJob(job))
+	}
+}
+
+/*
+startImportJob spools the uploaded file to a temporary file, since the request body
+is not available after the handler returns, and imports it in background.
+*/
+func startImportJob(ctx *gin.Context, service ports.PortService, jobs *imports.Manager, file io.Reader, format portsFormat, opts []ports.ImportOption) {
+	if jobs == nil {
+		ctx.SecureJSON(http.StatusBadRequest, ApiError{
+			Code:    "async_not_supported",
+			Message: "Asynchronous imports are not enabled on this server",
+		})
+		return
+	}
+
+	spoolPath, err := spoolUpload(file)
+	if status, apiErr, found := uploadFailure(err); found {
+		log.Printf("PORTS[CREATE][file.decompress], error=%q\n", err)
+		ctx.SecureJSON(status, apiErr)
+		return
+	}
+	if err != nil {
+		log.Printf("PORTS[CREATE][file.spool], error=%q\n", err)
+		ctx.SecureJSON(http.StatusInternalServerError, ApiError{
+			Code:    "internal_error",
+			Message: "Please check with the administrator",
+		})
+		return
+	}
+
+	job, err := jobs.Start(func(jobCtx context.Context, progress func(ports.ImportResult)) (ports.ImportResult, error) {
+		defer os.Remove(spoolPath)
+
+		spool, err := os.Open(spoolPath)
+		if err != nil {
+			return ports.ImportResult{}, err
+		}
+		defer spool.Close()
+
+		return service.CreateOrUpdateFrom(jobCtx, format(spool), append(opts, ports.WithProgress(progress))...)
+	})
+	if err != nil {
+		os.Remove(spoolPath)
+		log.Printf("PORTS[CREATE][jobs.start], error=%q\n", err)
+		ctx.SecureJSON(http.StatusInternalServerError, ApiError{
+			Code:    "internal_error",
+			Message: "Please check with the administrator",
+		})
+		return
+	}
+
+	ctx.Header("Location", "/imports/"+job.ID)
+	ctx.SecureJSON(http.StatusAccepted, importJob(job))
+}
+
+func spoolUpload(file io.Reader) (string, error) {
+	spool, err := os.CreateTemp("", "ports-import-*")
+	if err != nil {
+		return "", err
+	}
+	defer spool.Close()
+
+	if _, err := io.Copy(spool, file); err != nil {
+		os.Remove(spool.Name())
+		return "", err
+	}
+	return spool.Name(), nil
+}
+
+type importJobResponse struct {
+	ID         string               `json:"id"`
+	State      imports.State        `json:"state"`
+	Processed  int                  `json:"processed"`
+	Progress   importReportResponse `json:"progress"`
+	Error      string               `json:"error,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	StartedAt  *time.Time           `json:"started_at,omitempty"`
+	FinishedAt *time.Time           `json:"finished_at,omitempty"`
+}
+
+func importJob(job imports.Job) importJobResponse {
+	return importJobResponse{
+		ID:         job.ID,
+		State:      job.State,
+		Processed:  job.Progress.Stored() + job.Progress.Failed,
+		Progress:   importReport(job.Progress),
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  optionalTime(job.StartedAt),
+		FinishedAt: optionalTime(job.FinishedAt),
+	}
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,145 @@
+package http
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultMaxDecompressedSize is the default limit of the size of a compressed upload, once it is decompressed
+const DefaultMaxDecompressedSize = 1 << 30
+
+// maxZstdWindow is the largest window a zstd upload may declare, as the decoder allocates its window upfront
+const maxZstdWindow = 1 << 23
+
+var (
+	errUnsupportedEncoding  = errors.New("unsupported encoding")
+	errDecompressedTooLarge = errors.New("the decompressed upload is too large")
+)
+
+// compressionError is a failure to decompress an upload, that is not compressed as declared, or is corrupted
+type compressionError struct {
+	encoding string
+	err      error
+}
+
+func (ce *compressionError) Error() string {
+	return fmt.Sprintf("the upload is not valid %s: %s", ce.encoding, ce.err)
+}
+
+func (ce *compressionError) Unwrap() error {
+	return ce.err
+}
+
+// decompressors are the supported encodings of the uploads, by the names used in the Content-Encoding header
+var decompressors = map[string]func(r io.Reader) (io.ReadCloser, error){
+	"gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"zstd": func(r io.Reader) (io.ReadCloser, error) {
+		dec, err := zstd.NewReader(r,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderLowmem(true),
+			zstd.WithDecoderMaxWindow(maxZstdWindow),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	},
+}
+
+// fileEncodings are the encodings of the uploaded files, by their extension, or by their media type
+var fileEncodings = map[string]string{
+	".gz":                "gzip",
+	".zst":               "zstd",
+	"application/gzip":   "gzip",
+	"application/x-gzip": "gzip",
+	"application/zstd":   "zstd",
+}
+
+// fileEncoding returns the encoding of the uploaded file, or "" if it is not compressed
+func fileEncoding(header *multipart.FileHeader) string {
+	if encoding, found := fileEncodings[strings.ToLower(filepath.Ext(header.Filename))]; found {
+		return encoding
+	}
+	return fileEncodings[mediaType(header.Header.Get("Content-Type"))]
+}
+
+// decompressBody decompresses the request body on the fly, as declared by the Content-Encoding header
+func decompressBody(ctx *gin.Context, maxSize int64) error {
+	body, err := decompress(ctx.Request.Body, ctx.GetHeader("Content-Encoding"), maxSize)
+	if err != nil {
+		return err
+	}
+	ctx.Request.Body = body
+	return nil
+}
+
+/*
+decompress wraps the reader with the decompressor of the encoding, that fails with
+errDecompressedTooLarge after maxSize decompressed bytes, so that a small upload can't expand
+without bounds. Closing the returned reader closes the given one too; if decompress fails,
+the given reader is left open.
+*/
+func decompress(r io.ReadCloser, encoding string, maxSize int64) (io.ReadCloser, error) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" || encoding == "identity" {
+		return r, nil
+	}
+
+	decompressor, found := decompressors[encoding]
+	if !found {
+		return nil, fmt.Errorf("%w %q, it should be gzip or zstd", errUnsupportedEncoding, encoding)
+	}
+	decoder, err := decompressor(r)
+	if err != nil {
+		return nil, &compressionError{encoding: encoding, err: err}
+	}
+	return &decompressedReader{encoding: encoding, decoder: decoder, source: r, remaining: maxSize}, nil
+}
+
+type decompressedReader struct {
+	encoding  string
+	decoder   io.ReadCloser
+	source    io.Closer
+	remaining int64
+}
+
+func (dr *decompressedReader) Read(p []byte) (int, error) {
+	if dr.remaining <= 0 {
+		var next [1]byte
+		if n, err := dr.decoder.Read(next[:]); n > 0 {
+			return 0, errDecompressedTooLarge
+		} else if err != nil {
+			return 0, dr.wrap(err)
+		}
+		return 0, nil
+	}
+
+	if int64(len(p)) > dr.remaining {
+		p = p[:dr.remaining]
+	}
+	n, err := dr.decoder.Read(p)
+	dr.remaining -= int64(n)
+	return n, dr.wrap(err)
+}
+
+func (dr *decompressedReader) wrap(err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	return &compressionError{encoding: dr.encoding, err: err}
+}
+
+func (dr *decompressedReader) Close() error {
+	dr.decoder.Close()
+	return dr.source.Close()
+}
@@ -0,0 +1,94 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func compressed(t *testing.T, encoding string, data []byte) []byte {
+	out := &bytes.Buffer{}
+	switch encoding {
+	case "gzip":
+		writer := gzip.NewWriter(out)
+		_, err := writer.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+	case "zstd":
+		encoder, err := zstd.NewWriter(nil)
+		require.NoError(t, err)
+		out.Write(encoder.EncodeAll(data, nil))
+	}
+	return out.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	data := []byte(strings.Repeat(`{"port_code": "AEAJM", "name": "Ajman"}`+"\n", 100))
+
+	for _, encoding := range []string{"gzip", "zstd"} {
+		t.Run("decompress "+encoding, func(t *testing.T) {
+			r, err := decompress(io.NopCloser(bytes.NewReader(compressed(t, encoding, data))), strings.ToUpper(encoding), int64(len(data)))
+			require.NoError(t, err)
+			defer r.Close()
+
+			decompressed, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, data, decompressed)
+		})
+
+		t.Run("fail if "+encoding+" decompresses over the limit", func(t *testing.T) {
+			r, err := decompress(io.NopCloser(bytes.NewReader(compressed(t, encoding, data))), encoding, int64(len(data)-1))
+			require.NoError(t, err)
+			defer r.Close()
+
+			_, err = io.ReadAll(r)
+			require.ErrorIs(t, err, errDecompressedTooLarge)
+		})
+
+		t.Run("fail if it is not "+encoding, func(t *testing.T) {
+			r, err := decompress(io.NopCloser(bytes.NewReader(data)), encoding, int64(len(data)))
+			if err == nil {
+				defer r.Close()
+				_, err = io.ReadAll(r)
+			}
+
+			var compressionErr *compressionError
+			require.True(t, errors.As(err, &compressionErr), err)
+		})
+	}
+
+	t.Run("fail if zstd declares a window over the limit", func(t *testing.T) {
+		// a frame without content size, that declares a 128MiB window (exponent 17), with a raw block of "{}"
+		frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 17 << 3, 0x11, 0x00, 0x00, '{', '}'}
+
+		r, err := decompress(io.NopCloser(bytes.NewReader(frame)), "zstd", DefaultMaxDecompressedSize)
+		if err == nil {
+			defer r.Close()
+			_, err = io.ReadAll(r)
+		}
+
+		var compressionErr *compressionError
+		require.True(t, errors.As(err, &compressionErr), err)
+		require.ErrorIs(t, err, zstd.ErrWindowSizeExceeded)
+	})
+
+	t.Run("pass through uncompressed readers", func(t *testing.T) {
+		for _, encoding := range []string{"", "identity"} {
+			source := io.NopCloser(bytes.NewReader(data))
+			r, err := decompress(source, encoding, 1)
+			require.NoError(t, err)
+			require.Equal(t, source, r)
+		}
+	})
+
+	t.Run("reject unsupported encodings", func(t *testing.T) {
+		_, err := decompress(io.NopCloser(bytes.NewReader(data)), "br", int64(len(data)))
+		require.ErrorIs(t, err, errUnsupportedEncoding)
+	})
+}
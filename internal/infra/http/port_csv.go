@@ -0,0 +1,328 @@
+package http
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/countries"
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+)
+
+// csvListSeparator separates the values of the list fields, ie. alias or unlocs, in a CSV cell
+const csvListSeparator = "|"
+
+// csvMapping turns a CSV record into a port; skip is set for the records, that are not ports, ie. the UN/LOCODE country rows
+type csvMapping func(record []string) (port ports.Port, skip bool, err error)
+
+/*
+csvDecoder reads a port per CSV record, converting the records with a column mapping. The mapping
+is built by the start function, which may read the header. A malformed record is reported as a
+ports.RecordError, with its line number, and the decoder can go on with the next record.
+*/
+type csvDecoder struct {
+	r       *csv.Reader
+	start   func(r *csv.Reader) (csvMapping, error)
+	mapping csvMapping
+	line    int
+}
+
+// headerError is a CSV header, that can't be mapped to the port fields, so that none of the records can be read
+type headerError struct {
+	line int
+	err  error
+}
+
+func (he *headerError) Error() string {
+	return fmt.Sprintf("line %d: %s", he.line, he.err)
+}
+
+func (he *headerError) Unwrap() error {
+	return he.err
+}
+
+func newCSVDecoder(r io.Reader, start func(r *csv.Reader) (csvMapping, error)) *csvDecoder {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return &csvDecoder{r: reader, start: start}
+}
+
+func (d *csvDecoder) Next() (ports.Port, error) {
+	if d.mapping == nil {
+		mapping, err := d.start(d.r)
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return ports.Port{}, &headerError{line: parseErr.StartLine, err: parseErr.Err}
+		}
+		if err != nil {
+			return ports.Port{}, err
+		}
+		d.mapping = mapping
+	}
+
+	for {
+		record, err := d.r.Read()
+		if err == io.EOF {
+			return ports.Port{}, io.EOF
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			d.line = parseErr.StartLine
+			return ports.Port{}, &ports.RecordError{Line: d.line, Err: parseErr.Err}
+		}
+		if err != nil {
+			return ports.Port{}, err
+		}
+		d.line, _ = d.r.FieldPos(0)
+
+		port, skip, err := d.mapping(record)
+		if err != nil {
+			return ports.Port{}, &ports.RecordError{Line: d.line, PortCode: port.PortCode, Err: err}
+		}
+		if !skip {
+			return port, nil
+		}
+	}
+}
+
+// Line returns the line of the last port returned by Next
+func (d *csvDecoder) Line() int {
+	return d.line
+}
+
+/*
+headerMapping maps the columns by the header, which names the port fields: port_code, name, city,
+country, code, alias, regions, province, timezone, unlocs, and the decimal latitude and longitude.
+The lists are separated by "|", and the columns with other names are ignored.
+*/
+func headerMapping(r *csv.Reader) (csvMapping, error) {
+	header, err := r.Read()
+	if err == io.EOF {
+		return func([]string) (ports.Port, bool, error) { return ports.Port{}, true, nil }, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	line, _ := r.FieldPos(0)
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, found := columns[name]; found {
+			return nil, &headerError{line: line, err: fmt.Errorf("the column %q is repeated in the header", name)}
+		}
+		columns[name] = i
+	}
+	if _, found := columns["port_code"]; !found {
+		return nil, &headerError{line: line, err: errors.New("the header should have a port_code column")}
+	}
+
+	return func(record []string) (ports.Port, bool, error) {
+		value := func(column string) string {
+			if i, found := columns[column]; found && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		list := func(column string) []string {
+			if value(column) == "" {
+				return nil
+			}
+			values := strings.Split(value(column), csvListSeparator)
+			for i := range values {
+				values[i] = strings.TrimSpace(values[i])
+			}
+			return values
+		}
+
+		port := ports.Port{
+			PortCode: value("port_code"),
+			Name:     value("name"),
+			City:     value("city"),
+			Country:  value("country"),
+			Code:     value("code"),
+			Alias:    list("alias"),
+			Regions:  list("regions"),
+			Province: value("province"),
+			Timezone: value("timezone"),
+			Unlocs:   list("unlocs"),
+		}
+
+		lat, lon := value("latitude"), value("longitude")
+		if lat == "" && lon == "" {
+			return port, false, nil
+		}
+		latitude, latErr := strconv.ParseFloat(lat, 64)
+		longitude, lonErr := strconv.ParseFloat(lon, 64)
+		if latErr != nil || lonErr != nil {
+			return port, false, fmt.Errorf("the latitude %q and longitude %q should be decimal numbers", lat, lon)
+		}
+		port.Coordinates = []float64{longitude, latitude}
+		return port, false, nil
+	}, nil
+}
+
+// csvColumns are the columns of the CSV exports, which are read back by headerMapping
+var csvColumns = []string{
+	"port_code", "name", "city", "country", "code", "alias", "regions",
+	"province", "timezone", "unlocs", "latitude", "longitude",
+}
+
+// csvWriter writes a port per CSV record, under the csvColumns header
+type csvWriter struct {
+	w       *csv.Writer
+	started bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (cw *csvWriter) Write(port ports.Port) error {
+	if err := cw.start(); err != nil {
+		return err
+	}
+
+	var latitude, longitude string
+	if len(port.Coordinates) == 2 {
+		longitude = strconv.FormatFloat(port.Coordinates[0], 'f', -1, 64)
+		latitude = strconv.FormatFloat(port.Coordinates[1], 'f', -1, 64)
+	}
+	return cw.w.Write([]string{
+		port.PortCode,
+		port.Name,
+		port.City,
+		port.Country,
+		port.Code,
+		strings.Join(port.Alias, csvListSeparator),
+		strings.Join(port.Regions, csvListSeparator),
+		port.Province,
+		port.Timezone,
+		strings.Join(port.Unlocs, csvListSeparator),
+		latitude,
+		longitude,
+	})
+}
+
+// Close writes the header, if no port was written, and flushes the buffered records
+func (cw *csvWriter) Close() error {
+	if err := cw.start(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) start() error {
+	if cw.started {
+		return nil
+	}
+	cw.started = true
+	return cw.w.Write(csvColumns)
+}
+
+// The columns of the official UN/LOCODE CSV files, that have no header
+const (
+	unlocodeChange = iota
+	unlocodeCountry
+	unlocodeLocation
+	unlocodeName
+	unlocodeNameWoDiacritics
+	unlocodeSubdivision
+	unlocodeStatus
+	unlocodeFunction
+	unlocodeDate
+	unlocodeIATA
+	unlocodeCoordinates
+	unlocodeRemarks
+	unlocodeColumns
+)
+
+// unlocodeCoordinatesPattern matches the degrees and minutes notation of UN/LOCODE, ie. "2523N 05518E"
+var unlocodeCoordinatesPattern = regexp.MustCompile(`^(\d{2})(\d{2})([NS])\s+(\d{3})(\d{2})([EW])$`)
+
+/*
+unlocodeMapping maps the columns of the official UN/LOCODE CSV layout. Only the locations with the
+port function are imported; the country rows, and the entries marked for removal are skipped. The
+country name is taken from the ISO 3166-1 table, the subdivision code is kept as the province, and the
+name without diacritics is kept as an alias. The files are published in Latin-1, so the cells, that are
+not valid UTF-8, are read as Latin-1.
+*/
+func unlocodeMapping(*csv.Reader) (csvMapping, error) {
+	return func(record []string) (ports.Port, bool, error) {
+		if len(record) < unlocodeColumns {
+			return ports.Port{}, false, fmt.Errorf("the record has %d columns, instead of %d", len(record), unlocodeColumns)
+		}
+		for i := range record {
+			record[i] = strings.TrimSpace(latin1(record[i]))
+		}
+
+		function := record[unlocodeFunction]
+		if record[unlocodeLocation] == "" || record[unlocodeChange] == "X" || !strings.HasPrefix(function, "1") {
+			return ports.Port{}, true, nil
+		}
+
+		code := record[unlocodeCountry] + record[unlocodeLocation]
+		port := ports.Port{
+			PortCode: code,
+			Name:     record[unlocodeName],
+			Province: record[unlocodeSubdivision],
+			Unlocs:   []string{code},
+		}
+		if country, found := countries.ByCode(record[unlocodeCountry]); found {
+			port.Country = country.Name
+		}
+		if alias := record[unlocodeNameWoDiacritics]; alias != "" && alias != port.Name {
+			port.Alias = []string{alias}
+		}
+
+		coordinates, err := parseUnlocodeCoordinates(record[unlocodeCoordinates])
+		if err != nil {
+			return port, false, err
+		}
+		port.Coordinates = coordinates
+		return port, false, nil
+	}, nil
+}
+
+// parseUnlocodeCoordinates converts the degrees and minutes of UN/LOCODE to the decimal [longitude, latitude] pair
+func parseUnlocodeCoordinates(value string) ([]float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	match := unlocodeCoordinatesPattern.FindStringSubmatch(value)
+	if match == nil {
+		return nil, fmt.Errorf("the coordinates %q should be in the DDMM[NS] DDDMM[EW] notation", value)
+	}
+
+	degrees := func(deg, min, hemisphere string) float64 {
+		d, _ := strconv.Atoi(deg)
+		m, _ := strconv.Atoi(min)
+		value := float64(d) + float64(m)/60
+		if hemisphere == "S" || hemisphere == "W" {
+			return -value
+		}
+		return value
+	}
+	latitude := degrees(match[1], match[2], match[3])
+	longitude := degrees(match[4], match[5], match[6])
+	return []float64{longitude, latitude}, nil
+}
+
+// latin1 reads the value as Latin-1, if it is not valid UTF-8
+func latin1(value string) string {
+	if utf8.ValidString(value) {
+		return value
+	}
+	runes := make([]rune, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		runes = append(runes, rune(value[i]))
+	}
+	return string(runes)
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVDecoder(t *testing.T) {
+	t.Run("map columns by header", func(t *testing.T) {
+		dec := newCSVDecoder(strings.NewReader(
+			"\ufeffName,Port_Code,Country,alias,latitude,longitude,remarks\n"+
+				"Ajman,AEAJM,United Arab Emirates,Ajman Port | Ajman Creek,25.4052165,55.5136433,none\n"+
+				"Dubai,AEDXB,United Arab Emirates,,,\n",
+		), headerMapping)
+
+		port, err := dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, ports.Port{
+			PortCode:    "AEAJM",
+			Name:        "Ajman",
+			Country:     "United Arab Emirates",
+			Alias:       []string{"Ajman Port", "Ajman Creek"},
+			Coordinates: []float64{55.5136433, 25.4052165},
+		}, port)
+		require.Equal(t, 2, dec.Line())
+
+		port, err = dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, ports.Port{PortCode: "AEDXB", Name: "Dubai", Country: "United Arab Emirates"}, port)
+
+		_, err = dec.Next()
+		require.Equal(t, io.EOF, err)
+	})
+
+	t.Run("report malformed records, and go on with the next record", func(t *testing.T) {
+		dec := newCSVDecoder(strings.NewReader(
+			"port_code,name,country,latitude,longitude\n"+
+				"AEAJM,Ajman,United Arab Emirates,north,55.51\n"+
+				"AEAUH,\"Abu \"Dhabi\",United Arab Emirates,24.47,54.37\n"+
+				"AEDXB,Dubai,United Arab Emirates,25.25,55.27\n",
+		), headerMapping)
+
+		var recordErr *ports.RecordError
+		_, err := dec.Next()
+		require.True(t, errors.As(err, &recordErr))
+		require.Equal(t, 2, recordErr.Line)
+		require.Equal(t, "AEAJM", recordErr.PortCode)
+
+		_, err = dec.Next()
+		require.True(t, errors.As(err, &recordErr))
+		require.Equal(t, 3, recordErr.Line)
+
+		port, err := dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, "AEDXB", port.PortCode)
+	})
+
+	t.Run("fail if header has no port code", func(t *testing.T) {
+		_, err := newCSVDecoder(strings.NewReader("code,name\nAEAJM,Ajman\n"), headerMapping).Next()
+		require.Error(t, err)
+
+		var recordErr *ports.RecordError
+		require.False(t, errors.As(err, &recordErr))
+		var headerErr *headerError
+		require.ErrorAs(t, err, &headerErr)
+		require.Equal(t, 1, headerErr.line)
+	})
+
+	t.Run("fail if header is malformed", func(t *testing.T) {
+		_, err := newCSVDecoder(strings.NewReader("\nport_code,\"name\n"), headerMapping).Next()
+
+		var headerErr *headerError
+		require.ErrorAs(t, err, &headerErr)
+		require.Equal(t, 2, headerErr.line)
+	})
+}
+
+func TestUNLOCODEDecoder(t *testing.T) {
+	dec := newCSVDecoder(strings.NewReader(strings.Join([]string{
+		`,"AE",,".UNITED ARAB EMIRATES",,,,,,,,`,
+		`,"AE","AJM","Ajman","Ajman","AJ","AI","1-------","9307",,"2525N 05530E",`,
+		`,"AE","ZZA","Inland Depot","Inland Depot","DU","RL","--3-----","0401",,"2515N 05516E",`,
+		`X,"AE","XXX","Removed","Removed","DU","AI","1-------","0401",,,`,
+		",\"BR\",\"SSO\",\"S\xe3o Sebasti\xe3o\",\"Sao Sebastiao\",\"SP\",\"AI\",\"1-------\",\"0001\",,\"2348S 04524W\",",
+		`,"AE","QIW","Umm al Qaiwain","Umm al Qaiwain","UQ","AI","1-------","0001",,"25N 55E",`,
+		`,"XZ","AAA","High Seas","High Seas",,"AI","1-------","0001",,,`,
+	}, "\n")), unlocodeMapping)
+
+	port, err := dec.Next()
+	require.NoError(t, err)
+	require.Equal(t, ports.Port{
+		PortCode:    "AEAJM",
+		Name:        "Ajman",
+		Country:     "United Arab Emirates",
+		Province:    "AJ",
+		Coordinates: []float64{55.5, 25 + 25.0/60},
+		Unlocs:      []string{"AEAJM"},
+	}, port)
+	require.Equal(t, 2, dec.Line())
+
+	port, err = dec.Next()
+	require.NoError(t, err)
+	require.Equal(t, "BRSSO", port.PortCode)
+	require.Equal(t, "São Sebastião", port.Name)
+	require.Equal(t, []string{"Sao Sebastiao"}, port.Alias)
+	require.Equal(t, "Brazil", port.Country)
+	require.Equal(t, "SP", port.Province)
+	require.Equal(t, []float64{-(45 + 24.0/60), -(23 + 48.0/60)}, port.Coordinates)
+
+	var recordErr *ports.RecordError
+	_, err = dec.Next()
+	require.True(t, errors.As(err, &recordErr))
+	require.Equal(t, "AEQIW", recordErr.PortCode)
+	require.Equal(t, 6, recordErr.Line)
+
+	port, err = dec.Next()
+	require.NoError(t, err)
+	require.Equal(t, "XZAAA", port.PortCode)
+	require.Empty(t, port.Country)
+
+	_, err = dec.Next()
+	require.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+)
+
+/*
+portsDecoder walks the top level JSON object of an upload key by key, and
+decodes a single port at a time, so that memory usage does not depend on the
+size of the uploaded file. It implements ports.PortSource.
+
+The errors are located by a *jsonError; a port with a field of the wrong type is reported as a
+ports.RecordError, and the decoder can go on with the next port.
+*/
+type portsDecoder struct {
+	pos     *positionReader
+	dec     *json.Decoder
+	started bool
+	done    bool
+}
+
+func newPortsDecoder(r io.Reader) *portsDecoder {
+	pos := newPositionReader(r)
+	return &portsDecoder{pos: pos, dec: json.NewDecoder(pos)}
+}
+
+func (d *portsDecoder) Next() (ports.Port, error) {
+	if d.done {
+		return ports.Port{}, io.EOF
+	}
+
+	if !d.started {
+		if err := d.expectDelim('{'); err != nil {
+			return ports.Port{}, err
+		}
+		d.started = true
+	}
+
+	if !d.dec.More() {
+		if err := d.expectDelim('}'); err != nil {
+			return ports.Port{}, err
+		}
+		if _, err := d.dec.Token(); err != io.EOF {
+			return ports.Port{}, d.unexpected(errors.New("unexpected data after top-level object"))
+		}
+		d.done = true
+		return ports.Port{}, io.EOF
+	}
+
+	token, err := d.dec.Token()
+	if err != nil {
+		return ports.Port{}, d.pos.syntaxError(unexpectedEOF(err))
+	}
+	code, ok := token.(string)
+	if !ok {
+		return ports.Port{}, d.unexpected(fmt.Errorf("expected port code key, got %v", token))
+	}
+
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		located := d.pos.syntaxError(unexpectedEOF(err))
+		if jsonErr, ok := located.(*jsonError); ok {
+			jsonErr.PortCode = code
+		}
+		return ports.Port{}, located
+	}
+
+	var body portRequest
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return ports.Port{}, d.recordError(code, raw, err)
+	}
+	return body.toPort(code), nil
+}
+
+/*
+recordError locates a value of the wrong type, in the raw port, that ends at the offset of the
+decoder, and names it by its path, ie. `AEAJM.coordinates[0]`.
+*/
+func (d *portsDecoder) recordError(code string, raw json.RawMessage, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		return &ports.RecordError{PortCode: code, Err: err}
+	}
+
+	field := code
+	path, at, found := jsonPath(raw, typeErr.Offset)
+	switch {
+	case !found:
+		at = 0
+	case strings.HasPrefix(path, "["):
+		field += path
+	case path != "":
+		field += "." + path
+	}
+
+	start := d.dec.InputOffset() - int64(len(raw))
+	located := d.pos.locate(typeMismatch(field, typeErr), start+at)
+	located.PortCode = code
+	located.Field = field
+	return &ports.RecordError{Line: located.Line, PortCode: code, Err: located}
+}
+
+func (d *portsDecoder) expectDelim(delim json.Delim) error {
+	token, err := d.dec.Token()
+	if err != nil {
+		return d.pos.syntaxError(unexpectedEOF(err))
+	}
+	if token != delim {
+		return d.unexpected(fmt.Errorf("expected %q, got %v", delim, token))
+	}
+	return nil
+}
+
+// unexpected locates an error about the last read token
+func (d *portsDecoder) unexpected(err error) error {
+	return d.pos.locate(err, d.dec.InputOffset()-1)
+}
+
+// unexpectedEOF makes sure that a truncated file is not mistaken for the end of the ports stream
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
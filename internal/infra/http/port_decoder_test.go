@@ -0,0 +1,207 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortsDecoder(t *testing.T) {
+	t.Run("decode ports one by one", func(t *testing.T) {
+		dec := newPortsDecoder(strings.NewReader(`{
+			"AEAJM": {"name": "Ajman", "coordinates": [55.5136433, 25.4052165], "unlocs": ["AEAJM"]},
+			"AEAUH": {"name": "Abu Dhabi", "code": "52001"}
+		}`))
+
+		port, err := dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, "AEAJM", port.PortCode)
+		require.Equal(t, "Ajman", port.Name)
+		require.Equal(t, []float64{55.5136433, 25.4052165}, port.Coordinates)
+
+		port, err = dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, "AEAUH", port.PortCode)
+		require.Equal(t, "52001", port.Code)
+
+		_, err = dec.Next()
+		require.Equal(t, io.EOF, err)
+	})
+
+	t.Run("fail if data is an array", func(t *testing.T) {
+		_, err := newPortsDecoder(strings.NewReader(`[{"AEAJM": {}}]`)).Next()
+		require.Error(t, err)
+	})
+
+	t.Run("fail if file is truncated", func(t *testing.T) {
+		dec := newPortsDecoder(strings.NewReader(`{"AEAJM": {"name": "Ajman"}, "AEAUH": {"na`))
+
+		_, err := dec.Next()
+		require.NoError(t, err)
+
+		_, err = dec.Next()
+		require.Error(t, err)
+		require.NotEqual(t, io.EOF, err)
+	})
+
+	t.Run("locate syntax errors", func(t *testing.T) {
+		dec := newPortsDecoder(strings.NewReader("{\n  \"AEAJM\": {\"name\": \"Ajman\"},\n  \"AEAUH\": {\"name\": \"Abu Dhabi\",, \"code\": \"52001\"}\n}"))
+
+		_, err := dec.Next()
+		require.NoError(t, err)
+
+		_, err = dec.Next()
+		var jsonErr *jsonError
+		require.ErrorAs(t, err, &jsonErr)
+		require.Equal(t, int64(64), jsonErr.Offset)
+		require.Equal(t, 3, jsonErr.Line)
+		require.Equal(t, 33, jsonErr.Column)
+		require.Equal(t, "AEAUH", jsonErr.PortCode)
+		require.Contains(t, jsonErr.Context, `"Abu Dhabi",, "code"`)
+	})
+
+	t.Run("locate the end of a truncated file", func(t *testing.T) {
+		dec := newPortsDecoder(strings.NewReader(`{"AEAJM": {"name": "Ajman"}, "AEAUH": {"na`))
+
+		_, err := dec.Next()
+		require.NoError(t, err)
+
+		_, err = dec.Next()
+		var jsonErr *jsonError
+		require.ErrorAs(t, err, &jsonErr)
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		require.Equal(t, int64(42), jsonErr.Offset)
+		require.Equal(t, 43, jsonErr.Column)
+	})
+
+	t.Run("report fields of the wrong type by their path, and go on", func(t *testing.T) {
+		dec := newPortsDecoder(strings.NewReader(`{
+			"AEAJM": {"name": "Ajman", "coordinates": ["55.5136433", 25.4052165]},
+			"AEAUH": {"name": "Abu Dhabi"}
+		}`))
+
+		_, err := dec.Next()
+		var recordErr *ports.RecordError
+		require.ErrorAs(t, err, &recordErr)
+		require.Equal(t, "AEAJM", recordErr.PortCode)
+		require.Equal(t, 2, recordErr.Line)
+
+		var jsonErr *jsonError
+		require.ErrorAs(t, err, &jsonErr)
+		require.Equal(t, "AEAJM.coordinates[0]", jsonErr.Field)
+		require.Equal(t, 47, jsonErr.Column)
+		require.EqualError(t, jsonErr.Err, "AEAJM.coordinates[0] should be a number, got string")
+
+		port, err := dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, "AEAUH", port.PortCode)
+	})
+
+	t.Run("report a port of the wrong type by its code", func(t *testing.T) {
+		_, err := newPortsDecoder(strings.NewReader(`{"AEAJM": ["Ajman"]}`)).Next()
+
+		var jsonErr *jsonError
+		require.ErrorAs(t, err, &jsonErr)
+		require.Equal(t, "AEAJM", jsonErr.Field)
+		require.Equal(t, int64(10), jsonErr.Offset)
+	})
+
+	t.Run("fail if there is data after the object", func(t *testing.T) {
+		dec := newPortsDecoder(strings.NewReader(`{"AEAJM": {"name": "Ajman"}} {}`))
+
+		_, err := dec.Next()
+		require.NoError(t, err)
+
+		_, err = dec.Next()
+		require.Error(t, err)
+		require.NotEqual(t, io.EOF, err)
+	})
+}
+
+// syntheticPorts lazily generates a ports file with n entries, without holding it in memory
+func syntheticPorts(n int) io.Reader {
+	readers := make(chan io.Reader)
+	go func() {
+		defer close(readers)
+		readers <- strings.NewReader("{")
+		for i := 0; i < n; i++ {
+			sep := ","
+			if i == n-1 {
+				sep = ""
+			}
+			readers <- strings.NewReader(fmt.Sprintf(`"P%07d": {
+				"name": "Port %[1]d", "city": "City %[1]d", "country": "Country", "alias": [], "regions": [],
+				"coordinates": [55.5136433, 25.4052165], "province": "Province", "timezone": "Asia/Dubai",
+				"unlocs": ["P%07[1]d"], "code": "%[1]d"
+			}%s`, i, sep))
+		}
+		readers <- strings.NewReader("}")
+	}()
+	return &chanReader{readers: readers}
+}
+
+type chanReader struct {
+	readers <-chan io.Reader
+	current io.Reader
+}
+
+func (cr *chanReader) Read(p []byte) (int, error) {
+	for {
+		if cr.current == nil {
+			r, ok := <-cr.readers
+			if !ok {
+				return 0, io.EOF
+			}
+			cr.current = r
+		}
+		n, err := cr.current.Read(p)
+		if err == io.EOF {
+			cr.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// BenchmarkPortsDecoder reports the peak heap while decoding inputs of growing size;
+// `peak-heap-bytes` is expected to stay flat, regardless of the number of ports
+func BenchmarkPortsDecoder(b *testing.B) {
+	for _, size := range []int{1_000, 10_000, 100_000} {
+		b.Run(fmt.Sprintf("ports=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+
+			var peak uint64
+			var stats runtime.MemStats
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				dec := newPortsDecoder(syntheticPorts(size))
+
+				for decoded := 0; ; decoded++ {
+					_, err := dec.Next()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					if decoded%1000 == 0 {
+						runtime.ReadMemStats(&stats)
+						if stats.HeapInuse > peak {
+							peak = stats.HeapInuse
+						}
+					}
+				}
+			}
+			b.ReportMetric(float64(peak), "peak-heap-bytes")
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/gin-gonic/gin"
+)
+
+// portsWriter writes the exported ports one at a time; Close completes the document
+type portsWriter interface {
+	Write(port ports.Port) error
+	Close() error
+}
+
+type exportFormat struct {
+	mediaType string
+	extension string
+	writer    func(w io.Writer) portsWriter
+}
+
+// exportFormats are the formats of the exported ports files, by the names used in the `format` query param
+var exportFormats = map[string]exportFormat{
+	"json": {
+		mediaType: jsonMediaType,
+		extension: "json",
+		writer: func(w io.Writer) portsWriter {
+			return newJSONWriter(w)
+		},
+	},
+	"ndjson": {
+		mediaType: ndjsonMediaType,
+		extension: "ndjson",
+		writer: func(w io.Writer) portsWriter {
+			return newNDJSONWriter(w)
+		},
+	},
+	"csv": {
+		mediaType: csvMediaType,
+		extension: "csv",
+		writer: func(w io.Writer) portsWriter {
+			return newCSVWriter(w)
+		},
+	},
+	"geojson": {
+		mediaType: geojsonMediaType,
+		extension: "geojson",
+		writer: func(w io.Writer) portsWriter {
+			return newGeoJSONWriter(w)
+		},
+	},
+}
+
+// exportMediaTypes are offered to the Accept header in this order, so the map-keyed JSON is the default
+var exportMediaTypes = []string{jsonMediaType, ndjsonMediaType, csvMediaType, geojsonMediaType}
+
+/*
+exportPortsHandler streams the stored ports, that match the same filters as `GET /ports`, in the
+format given by the `format` query param, or else negotiated with the Accept header. The response
+headers are sent along with the first bytes of the file, so a failure before that is still reported
+as an ApiError; a later one cuts the file short.
+*/
+func exportPortsHandler(service ports.PortService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		name := ctx.Query("format")
+		if name != "" {
+			if _, found := exportFormats[name]; !found {
+				ctx.SecureJSON(http.StatusBadRequest, ApiError{
+					Code:    "bad_format",
+					Message: fmt.Sprintf("Unknown format %q, it should be one of json, ndjson, csv or geojson", name),
+				})
+				return
+			}
+		} else if name = acceptedExportFormat(ctx); name == "" {
+			ctx.SecureJSON(http.StatusNotAcceptable, ApiError{
+				Code:    "not_acceptable",
+				Message: "The ports can be exported as " + strings.Join(exportMediaTypes, ", "),
+			})
+			return
+		}
+		format := exportFormats[name]
+
+		out := bufio.NewWriter(&exportResponse{ctx: ctx, format: format})
+		writer := format.writer(out)
+		err := service.Export(ctx, portsFilter(ctx), writer.Write)
+		if err == nil {
+			err = writer.Close()
+		}
+		if err == nil {
+			err = out.Flush()
+		}
+		if err != nil && !ctx.Writer.Written() {
+			log.Printf("PORTS[EXPORT][service.export], error=%q\n", err)
+			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
+				Code:    "internal_error",
+				Message: "Please check with the administrator",
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("PORTS[EXPORT][response.write], error=%q\n", err)
+		}
+	}
+}
+
+// acceptedExportFormat returns the name of the export format, that is negotiated with the Accept header, or "" if none is accepted
+func acceptedExportFormat(ctx *gin.Context) string {
+	accepted := ctx.NegotiateFormat(exportMediaTypes...)
+	for name, format := range exportFormats {
+		if format.mediaType == accepted {
+			return name
+		}
+	}
+	return ""
+}
+
+// exportResponse sets the headers of the exported file before its first bytes are written
+type exportResponse struct {
+	ctx    *gin.Context
+	format exportFormat
+}
+
+func (er *exportResponse) Write(data []byte) (int, error) {
+	if !er.ctx.Writer.Written() {
+		er.ctx.Header("Content-Type", er.format.mediaType)
+		er.ctx.Header("Content-Disposition", `attachment; filename="ports.`+er.format.extension+`"`)
+		er.ctx.Status(http.StatusOK)
+	}
+	return er.ctx.Writer.Write(data)
+}
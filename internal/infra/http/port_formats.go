@@ -0,0 +1,358 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	jsonMediaType    = "application/json"
+	ndjsonMediaType  = "application/x-ndjson"
+	csvMediaType     = "text/csv"
+	geojsonMediaType = "application/geo+json"
+)
+
+// portsFormat decodes an uploaded ports file, as a stream of ports
+type portsFormat func(r io.Reader) ports.PortSource
+
+// portsFormats are the formats of the uploaded ports files, by the names used in the `format` form field
+var portsFormats = map[string]portsFormat{
+	"json": func(r io.Reader) ports.PortSource {
+		return newPortsDecoder(r)
+	},
+	"ndjson": func(r io.Reader) ports.PortSource {
+		return newNDJSONDecoder(r)
+	},
+	"csv": func(r io.Reader) ports.PortSource {
+		return newCSVDecoder(r, headerMapping)
+	},
+	"unlocode": func(r io.Reader) ports.PortSource {
+		return newCSVDecoder(r, unlocodeMapping)
+	},
+	"geojson": func(r io.Reader) ports.PortSource {
+		return newGeoJSONDecoder(r)
+	},
+}
+
+// mediaTypeFormats are the names of the formats by their media type, used both for the request body and for the uploaded files
+var mediaTypeFormats = map[string]string{
+	jsonMediaType:    "json",
+	ndjsonMediaType:  "ndjson",
+	csvMediaType:     "csv",
+	geojsonMediaType: "geojson",
+}
+
+const multipartMediaType = "multipart/form-data"
+
+var (
+	errNoUpload             = errors.New("no ports were sent")
+	errBadForm              = errors.New("the multipart form could not be read")
+	errUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+/*
+uploadedPorts returns the uploaded ports file, along with its format: a JSON, NDJSON, CSV or GeoJSON
+file can be sent as the request body, with its Content-Type, and any file can be sent as the `ports`
+form field, where its format is given by the `format` form field, or by the Content-Type of the file.
+The request body is decompressed as declared by its Content-Encoding, and the file by its extension
+or Content-Type.
+*/
+func uploadedPorts(ctx *gin.Context, maxDecompressedSize int64) (io.ReadCloser, portsFormat, error) {
+	if err := decompressBody(ctx, maxDecompressedSize); err != nil {
+		return nil, nil, err
+	}
+	if err := requireBody(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	contentType := mediaType(ctx.ContentType())
+	if name, found := mediaTypeFormats[contentType]; found {
+		return ctx.Request.Body, portsFormats[name], nil
+	}
+	if contentType != multipartMediaType {
+		return nil, nil, fmt.Errorf("%w %q", errUnsupportedMediaType, ctx.ContentType())
+	}
+
+	file, header, err := ctx.Request.FormFile("ports")
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, nil, errNoUpload
+	}
+	if _, _, found := uploadFailure(err); found {
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", errBadForm, err)
+	}
+
+	format, err := fileFormat(ctx, header)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	decompressed, err := decompress(file, fileEncoding(header), maxDecompressedSize)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return decompressed, format, nil
+}
+
+// requireBody fails with errNoUpload if the request body is empty; the length of the body is not always known ahead
+func requireBody(ctx *gin.Context) error {
+	if ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+		return errNoUpload
+	}
+
+	body := bufio.NewReader(ctx.Request.Body)
+	if _, err := body.Peek(1); err == io.EOF {
+		return errNoUpload
+	} else if err != nil {
+		return err
+	}
+	ctx.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, ctx.Request.Body}
+	return nil
+}
+
+// uploadFailure returns the response to a failure of reading the upload, or false for the errors of its content
+func uploadFailure(err error) (int, ApiError, bool) {
+	var compressionErr *compressionError
+	switch {
+	case errors.Is(err, errNoUpload):
+		return http.StatusBadRequest, ApiError{
+			Code:    "no_file",
+			Message: "Please send the ports as the request body, or upload the ports file as the `ports` form field",
+		}, true
+	case errors.Is(err, errBadForm):
+		return http.StatusBadRequest, ApiError{
+			Code:    "bad_form",
+			Message: err.Error(),
+		}, true
+	case errors.Is(err, errUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType, ApiError{
+			Code:    "unsupported_media_type",
+			Message: "The request body should be application/json, application/x-ndjson, text/csv, application/geo+json, or a multipart/form-data form with the `ports` file",
+		}, true
+	case errors.Is(err, errUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType, ApiError{
+			Code:    "unsupported_encoding",
+			Message: err.Error(),
+		}, true
+	case errors.Is(err, errDecompressedTooLarge):
+		return http.StatusRequestEntityTooLarge, ApiError{
+			Code:    "upload_too_large",
+			Message: "The upload is larger than the server accepts, once it is decompressed",
+		}, true
+	case errors.As(err, &compressionErr):
+		return http.StatusBadRequest, ApiError{
+			Code:    "bad_compressed_file",
+			Message: compressionErr.Error(),
+		}, true
+	default:
+		return 0, ApiError{}, false
+	}
+}
+
+// fileFormat returns the format of the uploaded file, which is the map-keyed JSON, unless the `format` form field, or the Content-Type of the file is set
+func fileFormat(ctx *gin.Context, header *multipart.FileHeader) (portsFormat, error) {
+	if name := ctx.PostForm("format"); name != "" {
+		format, found := portsFormats[name]
+		if !found {
+			return nil, fmt.Errorf("unknown format %q, it should be one of json, ndjson, csv, unlocode or geojson", name)
+		}
+		return format, nil
+	}
+
+	if header != nil {
+		if name, found := mediaTypeFormats[mediaType(header.Header.Get("Content-Type"))]; found {
+			return portsFormats[name], nil
+		}
+	}
+	return portsFormats["json"], nil
+}
+
+func mediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// maxNDJSONLineSize limits a single NDJSON line, so that a file without line breaks is not read into memory at once
+const maxNDJSONLineSize = 1 << 20
+
+var errLineTooLong = fmt.Errorf("the line is longer than %d bytes", maxNDJSONLineSize)
+
+/*
+ndjsonDecoder reads a port per line, from newline delimited JSON, where every line is a port
+object, that includes its port_code. A malformed line is reported as a ports.RecordError, with
+its line number, and the decoder can go on with the next line. Blank lines are skipped.
+*/
+type ndjsonDecoder struct {
+	r    *bufio.Reader
+	line int
+}
+
+// portRecord is a port object, that includes its port_code, as sent in the NDJSON lines, or in the GeoJSON feature properties
+type portRecord struct {
+	PortCode string `json:"port_code"`
+	portRequest
+}
+
+func newNDJSONDecoder(r io.Reader) *ndjsonDecoder {
+	return &ndjsonDecoder{r: bufio.NewReader(r)}
+}
+
+func (d *ndjsonDecoder) Next() (ports.Port, error) {
+	for {
+		data, tooLong, err := d.readLine()
+		if err != nil && err != io.EOF {
+			return ports.Port{}, err
+		}
+		if len(data) == 0 && !tooLong {
+			return ports.Port{}, io.EOF
+		}
+		d.line++
+		if tooLong {
+			return ports.Port{}, &ports.RecordError{Line: d.line, Err: errLineTooLong}
+		}
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		var body portRecord
+		if err := json.Unmarshal(data, &body); err != nil {
+			return ports.Port{}, &ports.RecordError{Line: d.line, PortCode: body.PortCode, Err: err}
+		}
+		return body.toPort(body.PortCode), nil
+	}
+}
+
+// readLine reads the next line; the bytes past maxNDJSONLineSize are discarded, and reported as tooLong
+func (d *ndjsonDecoder) readLine() (line []byte, tooLong bool, err error) {
+	for {
+		chunk, err := d.r.ReadSlice('\n')
+		if tooLong || len(line)+len(chunk) > maxNDJSONLineSize {
+			tooLong, line = true, nil
+		} else {
+			line = append(line, chunk...)
+		}
+		if err != bufio.ErrBufferFull {
+			return line, tooLong, err
+		}
+	}
+}
+
+// Line returns the line of the last port returned by Next
+func (d *ndjsonDecoder) Line() int {
+	return d.line
+}
+
+// exportedPort is a port object of the JSON and NDJSON exports, in the same shape as the uploads
+type exportedPort struct {
+	PortCode    string    `json:"port_code,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	City        string    `json:"city,omitempty"`
+	Country     string    `json:"country,omitempty"`
+	Code        string    `json:"code,omitempty"`
+	Alias       []string  `json:"alias,omitempty"`
+	Regions     []string  `json:"regions,omitempty"`
+	Coordinates []float64 `json:"coordinates,omitempty"`
+	Province    string    `json:"province,omitempty"`
+	Timezone    string    `json:"timezone,omitempty"`
+	Unlocs      []string  `json:"unlocs,omitempty"`
+}
+
+func newExportedPort(port ports.Port) exportedPort {
+	return exportedPort{
+		PortCode:    port.PortCode,
+		Name:        port.Name,
+		City:        port.City,
+		Country:     port.Country,
+		Code:        port.Code,
+		Alias:       port.Alias,
+		Regions:     port.Regions,
+		Coordinates: port.Coordinates,
+		Province:    port.Province,
+		Timezone:    port.Timezone,
+		Unlocs:      port.Unlocs,
+	}
+}
+
+/*
+jsonWriter writes the ports as the map-keyed JSON of the uploads, with a port per line. The start
+of the object is written along with the first port, and the end of it by Close, so a failed export
+leaves an incomplete document, rather than a valid one with missing ports.
+*/
+type jsonWriter struct {
+	w       io.Writer
+	written int
+}
+
+func newJSONWriter(w io.Writer) *jsonWriter {
+	return &jsonWriter{w: w}
+}
+
+func (jw *jsonWriter) Write(port ports.Port) error {
+	key, err := json.Marshal(port.PortCode)
+	if err != nil {
+		return err
+	}
+	body := newExportedPort(port)
+	body.PortCode = ""
+	value, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n"
+	if jw.written == 0 {
+		separator = "{\n"
+	}
+	jw.written++
+
+	_, err = fmt.Fprintf(jw.w, "%s%s:%s", separator, key, value)
+	return err
+}
+
+// Close writes the end of the object, or an empty one, if no port was written
+func (jw *jsonWriter) Close() error {
+	end := "\n}\n"
+	if jw.written == 0 {
+		end = "{}\n"
+	}
+	_, err := io.WriteString(jw.w, end)
+	return err
+}
+
+// ndjsonWriter writes a port object per line, that includes its port_code
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	return &ndjsonWriter{enc: json.NewEncoder(w)}
+}
+
+func (nw *ndjsonWriter) Write(port ports.Port) error {
+	return nw.enc.Encode(newExportedPort(port))
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
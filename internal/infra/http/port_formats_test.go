@@ -0,0 +1,122 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNDJSONDecoder(t *testing.T) {
+	t.Run("decode a port per line, skipping blank lines", func(t *testing.T) {
+		dec := newNDJSONDecoder(strings.NewReader(
+			`{"port_code": "AEAJM", "name": "Ajman", "coordinates": [55.5136433, 25.4052165]}` + "\n\n" +
+				`{"port_code": "AEAUH", "name": "Abu Dhabi", "code": "52001"}`,
+		))
+
+		port, err := dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, "AEAJM", port.PortCode)
+		require.Equal(t, []float64{55.5136433, 25.4052165}, port.Coordinates)
+		require.Equal(t, 1, dec.Line())
+
+		port, err = dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, "AEAUH", port.PortCode)
+		require.Equal(t, "52001", port.Code)
+		require.Equal(t, 3, dec.Line())
+
+		_, err = dec.Next()
+		require.Equal(t, io.EOF, err)
+	})
+
+	t.Run("report malformed lines, and go on with the next line", func(t *testing.T) {
+		dec := newNDJSONDecoder(strings.NewReader(
+			`{"port_code": "AEAJM", "name": 5}` + "\r\n" +
+				`{"port_code": "AEAUH", "na` + "\r\n" +
+				`{"port_code": "AEDXB", "name": "Dubai"}` + "\r\n",
+		))
+
+		var recordErr *ports.RecordError
+		_, err := dec.Next()
+		require.True(t, errors.As(err, &recordErr))
+		require.Equal(t, 1, recordErr.Line)
+		require.Equal(t, "AEAJM", recordErr.PortCode)
+
+		_, err = dec.Next()
+		require.True(t, errors.As(err, &recordErr))
+		require.Equal(t, 2, recordErr.Line)
+
+		port, err := dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, "AEDXB", port.PortCode)
+
+		_, err = dec.Next()
+		require.Equal(t, io.EOF, err)
+	})
+
+	t.Run("report lines that are too long, and go on with the next line", func(t *testing.T) {
+		long := `{"port_code": "AEAJM", "name": "` + strings.Repeat("x", maxNDJSONLineSize) + `"}`
+		dec := newNDJSONDecoder(strings.NewReader(long + "\n" + `{"port_code": "AEDXB", "name": "Dubai"}` + "\n" + long))
+
+		var recordErr *ports.RecordError
+		_, err := dec.Next()
+		require.True(t, errors.As(err, &recordErr))
+		require.Equal(t, 1, recordErr.Line)
+		require.ErrorIs(t, err, errLineTooLong)
+
+		port, err := dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, "AEDXB", port.PortCode)
+		require.Equal(t, 2, dec.Line())
+
+		_, err = dec.Next()
+		require.ErrorIs(t, err, errLineTooLong)
+
+		_, err = dec.Next()
+		require.Equal(t, io.EOF, err)
+	})
+}
+
+func TestExportWriters(t *testing.T) {
+	exported := []ports.Port{
+		{PortCode: "AEAJM", Name: "Ajman", Country: "United Arab Emirates", Alias: []string{"Ajman Port"}, Coordinates: []float64{55.5136433, 25.4052165}, Unlocs: []string{"AEAJM"}, CountryCode: "AE"},
+		{PortCode: "AEAUH", Name: "Abu Dhabi", Country: "United Arab Emirates", Code: "52001"},
+	}
+	decoded := []ports.Port{
+		{PortCode: "AEAJM", Name: "Ajman", Country: "United Arab Emirates", Alias: []string{"Ajman Port"}, Coordinates: []float64{55.5136433, 25.4052165}, Unlocs: []string{"AEAJM"}},
+		{PortCode: "AEAUH", Name: "Abu Dhabi", Country: "United Arab Emirates", Code: "52001"},
+	}
+
+	for _, name := range []string{"json", "ndjson", "csv", "geojson"} {
+		t.Run("read back the "+name+" export", func(t *testing.T) {
+			out := &bytes.Buffer{}
+			writer := exportFormats[name].writer(out)
+			for _, port := range exported {
+				require.NoError(t, writer.Write(port))
+			}
+			require.NoError(t, writer.Close())
+
+			src := portsFormats[name](out)
+			for _, want := range decoded {
+				port, err := src.Next()
+				require.NoError(t, err)
+				require.Equal(t, want, port)
+			}
+			_, err := src.Next()
+			require.Equal(t, io.EOF, err)
+		})
+
+		t.Run("read back the empty "+name+" export", func(t *testing.T) {
+			out := &bytes.Buffer{}
+			require.NoError(t, exportFormats[name].writer(out).Close())
+
+			_, err := portsFormats[name](out).Next()
+			require.Equal(t, io.EOF, err)
+		})
+	}
+}
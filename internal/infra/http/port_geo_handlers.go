@@ -0,0 +1,210 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultNearbyRadiusKm = 100
+	// maxNearbyRadiusKm is half of the Earth circumference, which covers the whole globe
+	maxNearbyRadiusKm = 20038
+	maxNearbyLimit    = 100
+	maxWithinLimit    = 5000
+)
+
+func nearbyPortsHandler(service ports.PortService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		query, err := nearbyQuery(ctx)
+		if err != nil {
+			ctx.SecureJSON(http.StatusBadRequest, ApiError{
+				Code:    "bad_location",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		nearby, err := service.Nearby(ctx, query)
+		if err != nil {
+			log.Printf("PORTS[NEARBY][service.nearby], error=%q\n", err)
+			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
+				Code:    "internal_error",
+				Message: "Please check with the administrator",
+			})
+			return
+		}
+
+		data := make([]nearbyPortResponse, 0, len(nearby))
+		for _, port := range nearby {
+			data = append(data, nearbyPortResponse{
+				portResponse: portResponse(port.Port),
+				DistanceKm:   port.DistanceKm,
+			})
+		}
+		ctx.SecureJSON(http.StatusOK, gin.H{"data": data})
+	}
+}
+
+func nearbyQuery(ctx *gin.Context) (ports.NearbyQuery, error) {
+	query := ports.NearbyQuery{
+		RadiusKm: defaultNearbyRadiusKm,
+		Limit:    ports.DefaultNearbyLimit,
+	}
+
+	var err error
+	if query.Lat, err = floatParam(ctx, "lat", -90, 90); err != nil {
+		return query, err
+	}
+	if query.Lon, err = floatParam(ctx, "lon", -180, 180); err != nil {
+		return query, err
+	}
+	if ctx.Query("radius_km") != "" {
+		query.RadiusKm, err = floatParam(ctx, "radius_km", 0, maxNearbyRadiusKm)
+		// a zero radius would be no distance limit for the storages, so it is rejected, instead of searching the whole globe
+		if err == nil && query.RadiusKm == 0 {
+			err = fmt.Errorf("the radius_km should be a number greater than 0 and up to %v", maxNearbyRadiusKm)
+		}
+		if err != nil {
+			return query, err
+		}
+	}
+	if value := ctx.Query("limit"); value != "" {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil || query.Limit <= 0 || query.Limit > maxNearbyLimit {
+			return query, fmt.Errorf("the limit should be a number between 1 and %d", maxNearbyLimit)
+		}
+	}
+
+	return query, nil
+}
+
+func floatParam(ctx *gin.Context, name string, min, max float64) (float64, error) {
+	value, err := strconv.ParseFloat(ctx.Query(name), 64)
+	if err != nil || value < min || value > max {
+		return 0, fmt.Errorf("the %s should be a number between %v and %v", name, min, max)
+	}
+	return value, nil
+}
+
+type nearbyPortResponse struct {
+	portResponse
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// withinPortsHandler returns the ports inside the area, which is parsed from the request by the query function
+func withinPortsHandler(service ports.PortService, query func(*gin.Context) (ports.WithinQuery, error)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		within, err := query(ctx)
+		if err == nil {
+			within.Limit, err = withinLimit(ctx)
+		}
+		if err != nil {
+			ctx.SecureJSON(http.StatusBadRequest, ApiError{
+				Code:    "bad_area",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		found, err := service.Within(ctx, within)
+		if err != nil {
+			log.Printf("PORTS[WITHIN][service.within], error=%q\n", err)
+			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
+				Code:    "internal_error",
+				Message: "Please check with the administrator",
+			})
+			return
+		}
+
+		data := make([]portResponse, 0, len(found))
+		for _, port := range found {
+			data = append(data, portResponse(port))
+		}
+		ctx.SecureJSON(http.StatusOK, gin.H{"data": data})
+	}
+}
+
+func withinLimit(ctx *gin.Context) (int, error) {
+	value := ctx.Query("limit")
+	if value == "" {
+		return ports.DefaultWithinLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 || limit > maxWithinLimit {
+		return 0, fmt.Errorf("the limit should be a number between 1 and %d", maxWithinLimit)
+	}
+	return limit, nil
+}
+
+// bboxQuery parses `bbox=minLon,minLat,maxLon,maxLat`; a minLon greater than maxLon selects a box crossing the antimeridian
+func bboxQuery(ctx *gin.Context) (ports.WithinQuery, error) {
+	parts := strings.Split(ctx.Query("bbox"), ",")
+	if len(parts) != 4 {
+		return ports.WithinQuery{}, errors.New("the bbox should be minLon,minLat,maxLon,maxLat")
+	}
+
+	var values [4]float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return ports.WithinQuery{}, errors.New("the bbox should be minLon,minLat,maxLon,maxLat")
+		}
+		values[i] = value
+	}
+
+	box := storage.BBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	if !validLocation(box.MinLon, box.MinLat) || !validLocation(box.MaxLon, box.MaxLat) {
+		return ports.WithinQuery{}, errors.New("the bbox longitudes should be between -180 and 180, and latitudes between -90 and 90")
+	}
+	if box.MinLat >= box.MaxLat {
+		return ports.WithinQuery{}, errors.New("the bbox minLat should be less than maxLat")
+	}
+	if box.MinLon == box.MaxLon {
+		return ports.WithinQuery{}, errors.New("the bbox minLon should not be equal to maxLon")
+	}
+	return ports.WithinQuery{Box: &box}, nil
+}
+
+// polygonQuery parses a GeoJSON polygon from the request body
+func polygonQuery(ctx *gin.Context) (ports.WithinQuery, error) {
+	var body struct {
+		Type        string          `json:"type"`
+		Coordinates storage.Polygon `json:"coordinates"`
+	}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		return ports.WithinQuery{}, fmt.Errorf("the body should be a GeoJSON polygon: %w", err)
+	}
+	if body.Type != "Polygon" {
+		return ports.WithinQuery{}, errors.New("the body should be a GeoJSON geometry of Polygon type")
+	}
+	if len(body.Coordinates) == 0 {
+		return ports.WithinQuery{}, errors.New("the polygon should have at least one ring")
+	}
+	for _, ring := range body.Coordinates {
+		if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+			return ports.WithinQuery{}, errors.New("the polygon rings should be closed, with at least 4 points")
+		}
+		for _, point := range ring {
+			if !validLocation(point[0], point[1]) {
+				return ports.WithinQuery{}, errors.New("the polygon longitudes should be between -180 and 180, and latitudes between -90 and 90")
+			}
+		}
+	}
+	if !body.Coordinates.Gnomonic().Projected() {
+		return ports.WithinQuery{}, errors.New("the polygon should be smaller than a hemisphere")
+	}
+	return ports.WithinQuery{Polygon: body.Coordinates}, nil
+}
+
+func validLocation(lon, lat float64) bool {
+	return lon >= -180 && lon <= 180 && lat >= -90 && lat <= 90
+}
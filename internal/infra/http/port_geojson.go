@@ -0,0 +1,266 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+)
+
+type geojsonFeature struct {
+	Type       string           `json:"type"`
+	ID         interface{}      `json:"id,omitempty"`
+	Geometry   *geojsonGeometry `json:"geometry"`
+	Properties json.RawMessage  `json:"properties"`
+}
+
+type geojsonGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+/*
+geojsonDecoder walks a GeoJSON FeatureCollection, and decodes a single feature at a time, so that
+memory usage does not depend on the size of the uploaded file. Every feature is a Point, with the
+[longitude, latitude] coordinates of the port, and the port fields as properties; the port code is
+the port_code property, or the feature id. A malformed feature is reported as a ports.RecordError,
+and the decoder can go on with the next feature. The syntax errors are located by a *jsonError.
+The "type" member is required, and it should come before the "features" member, so that no port
+is read from a file, that turns out not to be a FeatureCollection.
+*/
+type geojsonDecoder struct {
+	pos *positionReader
+	dec *json.Decoder
+	// inFeatures is set while the decoder is inside the features array
+	inFeatures bool
+	// typed is set once the type member is read
+	typed   bool
+	started bool
+	done    bool
+}
+
+func newGeoJSONDecoder(r io.Reader) *geojsonDecoder {
+	pos := newPositionReader(r)
+	return &geojsonDecoder{pos: pos, dec: json.NewDecoder(pos)}
+}
+
+func (d *geojsonDecoder) Next() (ports.Port, error) {
+	if d.done {
+		return ports.Port{}, io.EOF
+	}
+
+	if !d.started {
+		if err := d.expectDelim('{'); err != nil {
+			return ports.Port{}, err
+		}
+		d.started = true
+	}
+
+	for !d.inFeatures {
+		if !d.dec.More() {
+			return ports.Port{}, d.end()
+		}
+		if err := d.member(); err != nil {
+			return ports.Port{}, err
+		}
+	}
+
+	if !d.dec.More() {
+		if err := d.expectDelim(']'); err != nil {
+			return ports.Port{}, err
+		}
+		d.inFeatures = false
+		return d.Next()
+	}
+
+	var feature geojsonFeature
+	if err := d.dec.Decode(&feature); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return ports.Port{}, &ports.RecordError{Err: err}
+		}
+		return ports.Port{}, d.pos.syntaxError(unexpectedEOF(err))
+	}
+
+	port, err := feature.toPort()
+	if err != nil {
+		return ports.Port{}, &ports.RecordError{PortCode: port.PortCode, Err: err}
+	}
+	return port, nil
+}
+
+// member reads a member of the top level object; the features array is entered, and the other members are skipped
+func (d *geojsonDecoder) member() error {
+	token, err := d.dec.Token()
+	if err != nil {
+		return d.pos.syntaxError(unexpectedEOF(err))
+	}
+
+	switch token {
+	case "type":
+		var kind string
+		if err := d.dec.Decode(&kind); err != nil {
+			return d.pos.syntaxError(unexpectedEOF(err))
+		}
+		if kind != "FeatureCollection" {
+			return d.unexpected(fmt.Errorf("expected a FeatureCollection, got %q", kind))
+		}
+		d.typed = true
+	case "features":
+		if !d.typed {
+			return d.unexpected(errors.New(`the "type" member should come before the "features" member`))
+		}
+		if err := d.expectDelim('['); err != nil {
+			return err
+		}
+		d.inFeatures = true
+	default:
+		var skipped json.RawMessage
+		if err := d.dec.Decode(&skipped); err != nil {
+			return d.pos.syntaxError(unexpectedEOF(err))
+		}
+	}
+	return nil
+}
+
+func (d *geojsonDecoder) end() error {
+	if err := d.expectDelim('}'); err != nil {
+		return err
+	}
+	if !d.typed {
+		return d.unexpected(errors.New(`the "type" member is missing`))
+	}
+	if _, err := d.dec.Token(); err != io.EOF {
+		return d.unexpected(errors.New("unexpected data after top-level object"))
+	}
+	d.done = true
+	return io.EOF
+}
+
+func (d *geojsonDecoder) expectDelim(delim json.Delim) error {
+	token, err := d.dec.Token()
+	if err != nil {
+		return d.pos.syntaxError(unexpectedEOF(err))
+	}
+	if token != delim {
+		return d.unexpected(fmt.Errorf("expected %q, got %v", delim, token))
+	}
+	return nil
+}
+
+// unexpected locates an error about the last read token
+func (d *geojsonDecoder) unexpected(err error) error {
+	return d.pos.locate(err, d.dec.InputOffset()-1)
+}
+
+func (f geojsonFeature) toPort() (ports.Port, error) {
+	var record portRecord
+	if len(f.Properties) > 0 {
+		if err := json.Unmarshal(f.Properties, &record); err != nil {
+			return ports.Port{}, fmt.Errorf("the properties should be the port fields: %w", err)
+		}
+	}
+	if id, ok := f.ID.(string); ok && record.PortCode == "" {
+		record.PortCode = id
+	}
+	record.Coordinates = nil
+	port := record.toPort(record.PortCode)
+
+	if f.Type != "Feature" {
+		return port, fmt.Errorf("expected a Feature, got %q", f.Type)
+	}
+	if f.Geometry == nil {
+		return port, nil
+	}
+	if f.Geometry.Type != "Point" {
+		return port, fmt.Errorf("the geometry should be a Point, got %q", f.Geometry.Type)
+	}
+	if err := json.Unmarshal(f.Geometry.Coordinates, &port.Coordinates); err != nil {
+		return port, errors.New("the Point coordinates should be a [longitude, latitude] pair")
+	}
+	return port, nil
+}
+
+/*
+geojsonWriter writes the ports as the Point features of a FeatureCollection, one at a time. The
+start of the collection is written along with the first port, and the end of it by Close, so a
+failed export leaves an incomplete document, rather than a valid one with missing ports.
+*/
+type geojsonWriter struct {
+	w       io.Writer
+	enc     *json.Encoder
+	written int
+}
+
+type geojsonProperties struct {
+	PortCode    string   `json:"port_code"`
+	Name        string   `json:"name,omitempty"`
+	City        string   `json:"city,omitempty"`
+	Country     string   `json:"country,omitempty"`
+	Code        string   `json:"code,omitempty"`
+	Alias       []string `json:"alias,omitempty"`
+	Regions     []string `json:"regions,omitempty"`
+	Province    string   `json:"province,omitempty"`
+	Timezone    string   `json:"timezone,omitempty"`
+	Unlocs      []string `json:"unlocs,omitempty"`
+	CountryCode string   `json:"country_code,omitempty"`
+}
+
+type geojsonPoint struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+func newGeoJSONWriter(w io.Writer) *geojsonWriter {
+	return &geojsonWriter{w: w, enc: json.NewEncoder(w)}
+}
+
+func (gw *geojsonWriter) Write(port ports.Port) error {
+	separator := ","
+	if gw.written == 0 {
+		separator = `{"type":"FeatureCollection","features":[`
+	}
+	if _, err := io.WriteString(gw.w, separator); err != nil {
+		return err
+	}
+	gw.written++
+
+	feature := struct {
+		Type       string            `json:"type"`
+		ID         string            `json:"id"`
+		Geometry   *geojsonPoint     `json:"geometry"`
+		Properties geojsonProperties `json:"properties"`
+	}{
+		Type: "Feature",
+		ID:   port.PortCode,
+		Properties: geojsonProperties{
+			PortCode:    port.PortCode,
+			Name:        port.Name,
+			City:        port.City,
+			Country:     port.Country,
+			Code:        port.Code,
+			Alias:       port.Alias,
+			Regions:     port.Regions,
+			Province:    port.Province,
+			Timezone:    port.Timezone,
+			Unlocs:      port.Unlocs,
+			CountryCode: port.CountryCode,
+		},
+	}
+	if len(port.Coordinates) == 2 {
+		feature.Geometry = &geojsonPoint{Type: "Point", Coordinates: port.Coordinates}
+	}
+	return gw.enc.Encode(feature)
+}
+
+// Close writes the end of the FeatureCollection, or an empty one, if no port was written
+func (gw *geojsonWriter) Close() error {
+	end := "]}\n"
+	if gw.written == 0 {
+		end = `{"type":"FeatureCollection","features":[]}` + "\n"
+	}
+	_, err := io.WriteString(gw.w, end)
+	return err
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoJSONDecoder(t *testing.T) {
+	t.Run("decode a port per feature, skipping the other members", func(t *testing.T) {
+		dec := newGeoJSONDecoder(strings.NewReader(`{
+			"bbox": [55, 25, 56, 26],
+			"type": "FeatureCollection",
+			"features": [
+				{"type": "Feature", "id": "AEAJM", "geometry": {"type": "Point", "coordinates": [55.5136433, 25.4052165]}, "properties": {"name": "Ajman"}},
+				{"type": "Feature", "geometry": null, "properties": {"port_code": "AEAUH", "code": "52001", "coordinates": [1, 2]}}
+			],
+			"name": "ports"
+		}`))
+
+		port, err := dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, ports.Port{PortCode: "AEAJM", Name: "Ajman", Coordinates: []float64{55.5136433, 25.4052165}}, port)
+
+		port, err = dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, ports.Port{PortCode: "AEAUH", Code: "52001"}, port)
+
+		_, err = dec.Next()
+		require.Equal(t, io.EOF, err)
+	})
+
+	t.Run("report malformed features, and go on with the next feature", func(t *testing.T) {
+		dec := newGeoJSONDecoder(strings.NewReader(`{"type": "FeatureCollection", "features": [
+			{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}, "properties": {"port_code": "AEAJM"}},
+			{"type": "Feature", "geometry": {"type": "Point", "coordinates": ["55", "25"]}, "properties": {"port_code": "AEAUH"}},
+			{"type": "Feature", "geometry": null, "properties": {"port_code": "AEDXB", "name": 5}},
+			{"type": "Feature", "geometry": null, "properties": {"port_code": "AEJEA"}}
+		]}`))
+
+		var recordErr *ports.RecordError
+		for _, code := range []string{"AEAJM", "AEAUH", ""} {
+			_, err := dec.Next()
+			require.True(t, errors.As(err, &recordErr))
+			require.Equal(t, code, recordErr.PortCode)
+		}
+
+		port, err := dec.Next()
+		require.NoError(t, err)
+		require.Equal(t, "AEJEA", port.PortCode)
+
+		_, err = dec.Next()
+		require.Equal(t, io.EOF, err)
+	})
+
+	t.Run("fail if it is not a FeatureCollection", func(t *testing.T) {
+		for _, body := range []string{
+			`{"type": "Feature", "geometry": null, "properties": {}}`,
+			`[{"type": "Feature"}]`,
+			`{"type": "FeatureCollection", "features": [`,
+			`{}`,
+			`{"name": "ports", "features": []}`,
+			`{"features": [{"type": "Feature", "id": "AEAJM", "geometry": null, "properties": {}}], "type": "FeatureCollection"}`,
+			`{"features": [{"type": "Feature", "id": "AEAJM", "geometry": null, "properties": {}}], "type": "Feature"}`,
+		} {
+			_, err := newGeoJSONDecoder(strings.NewReader(body)).Next()
+			require.Error(t, err, body)
+			require.NotEqual(t, io.EOF, err, body)
+
+			var recordErr *ports.RecordError
+			require.False(t, errors.As(err, &recordErr), body)
+		}
+	})
+}
+
+func TestGeoJSONWriter(t *testing.T) {
+	t.Run("write ports as Point features", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		writer := newGeoJSONWriter(out)
+		require.NoError(t, writer.Write(ports.Port{PortCode: "AEAJM", Name: "Ajman", Coordinates: []float64{55.5136433, 25.4052165}}))
+		require.NoError(t, writer.Write(ports.Port{PortCode: "AEAUH", CountryCode: "AE"}))
+		require.NoError(t, writer.Close())
+
+		require.JSONEq(t, `{"type": "FeatureCollection", "features": [
+			{"type": "Feature", "id": "AEAJM", "geometry": {"type": "Point", "coordinates": [55.5136433, 25.4052165]}, "properties": {"port_code": "AEAJM", "name": "Ajman"}},
+			{"type": "Feature", "id": "AEAUH", "geometry": null, "properties": {"port_code": "AEAUH", "country_code": "AE"}}
+		]}`, out.String())
+	})
+
+	t.Run("write an empty collection", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, newGeoJSONWriter(out).Close())
+		require.JSONEq(t, `{"type": "FeatureCollection", "features": []}`, out.String())
+	})
+}
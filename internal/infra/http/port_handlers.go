@@ -1,18 +1,71 @@
 package http
 
 import (
-	"bytes"
-	"encoding/json"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/CristianCurteanu/koken-api/internal/domains/countries"
+	"github.com/CristianCurteanu/koken-api/internal/domains/imports"
 	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
 	"github.com/gin-gonic/gin"
 )
 
-func PortHandlers(service ports.PortService) DomainHandler {
+const DefaultMaxPageSize = 500
+
+type portHandlersConfig struct {
+	jobs                *imports.Manager
+	pageSize            int
+	maxPageSize         int
+	maxDecompressedSize int64
+}
+
+// PortHandlersOption configures the port handlers, created with PortHandlers
+type PortHandlersOption func(*portHandlersConfig)
+
+// WithImportJobs enables asynchronous uploads, ie. `POST /ports?async=true`, tracked by the jobs manager
+func WithImportJobs(jobs *imports.Manager) PortHandlersOption {
+	return func(config *portHandlersConfig) {
+		config.jobs = jobs
+	}
+}
+
+// WithPageSize sets the default and the maximum number of ports, returned by `GET /ports`
+func WithPageSize(pageSize, maxPageSize int) PortHandlersOption {
+	return func(config *portHandlersConfig) {
+		if pageSize > 0 {
+			config.pageSize = pageSize
+		}
+		if maxPageSize > 0 {
+			config.maxPageSize = maxPageSize
+		}
+	}
+}
+
+// WithMaxDecompressedSize sets the maximum size of the gzip or zstd compressed uploads, once they are decompressed
+func WithMaxDecompressedSize(size int64) PortHandlersOption {
+	return func(config *portHandlersConfig) {
+		if size > 0 {
+			config.maxDecompressedSize = size
+		}
+	}
+}
+
+func PortHandlers(service ports.PortService, opts ...PortHandlersOption) DomainHandler {
+	config := portHandlersConfig{
+		pageSize:            ports.DefaultPageSize,
+		maxPageSize:         DefaultMaxPageSize,
+		maxDecompressedSize: DefaultMaxDecompressedSize,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
 	return DomainHandler{
 		Path: "/",
 		Middlewares: []gin.HandlerFunc{
@@ -25,13 +78,73 @@ func PortHandlers(service ports.PortService) DomainHandler {
 				Middlewares: []gin.HandlerFunc{
 					requestLogMiddleware,
 				},
-				Handler: createPortsHandler(service),
+				Handler: createPortsHandler(service, config),
+			},
+			{
+				Path:    "/ports/validate",
+				Method:  http.MethodPost,
+				Handler: validatePortsHandler(service, config),
+			},
+			{
+				Path:    "/ports",
+				Method:  http.MethodGet,
+				Handler: listPortsHandler(service, config),
+			},
+			{
+				Path:    "/ports/nearby",
+				Method:  http.MethodGet,
+				Handler: nearbyPortsHandler(service),
+			},
+			{
+				Path:    "/ports/within",
+				Method:  http.MethodGet,
+				Handler: withinPortsHandler(service, bboxQuery),
+			},
+			{
+				Path:    "/ports/within",
+				Method:  http.MethodPost,
+				Handler: withinPortsHandler(service, polygonQuery),
+			},
+			{
+				Path:    "/ports/search",
+				Method:  http.MethodGet,
+				Handler: searchPortsHandler(service),
+			},
+			{
+				Path:    "/ports/autocomplete",
+				Method:  http.MethodGet,
+				Handler: autocompletePortsHandler(service),
+			},
+			{
+				Path:    "/ports/export",
+				Method:  http.MethodGet,
+				Handler: exportPortsHandler(service),
 			},
 			{
 				Path:    "/ports/:port_code",
 				Method:  http.MethodGet,
 				Handler: getPortByPortCodeHandler(service),
 			},
+			{
+				Path:    "/ports/:port_code",
+				Method:  http.MethodDelete,
+				Handler: deletePortHandler(service),
+			},
+			{
+				Path:    "/ports/:port_code",
+				Method:  http.MethodPut,
+				Handler: replacePortHandler(service),
+			},
+			{
+				Path:    "/ports/:port_code",
+				Method:  http.MethodPatch,
+				Handler: patchPortHandler(service),
+			},
+			{
+				Path:    "/ports/:port_code/restore",
+				Method:  http.MethodPost,
+				Handler: restorePortHandler(service),
+			},
 		},
 	}
 }
@@ -64,24 +177,96 @@ func getPortByPortCodeHandler(service ports.PortService) gin.HandlerFunc {
 	}
 }
 
-func createPortsHandler(service ports.PortService) gin.HandlerFunc {
+func deletePortHandler(service ports.PortService) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		file, header, _ := ctx.Request.FormFile("ports")
+		err := service.Delete(ctx, ctx.Param("port_code"))
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.SecureJSON(http.StatusNotFound, ApiError{
+				Code:    "not_found",
+				Message: "No port found with the specified port code",
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("PORTS[DELETE][service.delete], error=%q\n", err)
+			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
+				Code:    "err_data_store",
+				Message: "Please check with the administrator",
+			})
+			return
+		}
 
-		// file_buf.copy
-		buf := bytes.NewBuffer(nil)
-		copied, err := io.Copy(buf, file)
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+func restorePortHandler(service ports.PortService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		port, err := service.Restore(ctx, ctx.Param("port_code"))
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.SecureJSON(http.StatusNotFound, ApiError{
+				Code:    "not_found",
+				Message: "No deleted port found with the specified port code",
+			})
+			return
+		}
 		if err != nil {
-			log.Printf("PORTS[CREATE][file_buf.copy], error=%q\n", err)
+			log.Printf("PORTS[RESTORE][service.restore], error=%q\n", err)
 			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
-				Code:    "internal_error",
+				Code:    "err_data_store",
 				Message: "Please check with the administrator",
 			})
 			return
 		}
 
-		if copied != header.Size {
-			log.Printf("PORTS[CREATE][file_buf.copy], error=%q\n", fmt.Errorf("copied `%d`, while header-size is: `%d`", copied, header.Size))
+		ctx.SecureJSON(http.StatusOK, portResponse(port))
+	}
+}
+
+func listPortsHandler(service ports.PortService, config portHandlersConfig) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit := config.pageSize
+		if value := ctx.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 || parsed > config.maxPageSize {
+				ctx.SecureJSON(http.StatusBadRequest, ApiError{
+					Code:    "bad_limit",
+					Message: fmt.Sprintf("The limit should be a number between 1 and %d", config.maxPageSize),
+				})
+				return
+			}
+			limit = parsed
+		}
+
+		after, err := decodeCursor(ctx.Query("cursor"))
+		if err != nil {
+			ctx.SecureJSON(http.StatusBadRequest, ApiError{
+				Code:    "bad_cursor",
+				Message: "The cursor is not valid, please use the next_cursor value of the previous page",
+			})
+			return
+		}
+
+		includeDeleted := false
+		if value := ctx.Query("include_deleted"); value != "" {
+			includeDeleted, err = strconv.ParseBool(value)
+			if err != nil {
+				ctx.SecureJSON(http.StatusBadRequest, ApiError{
+					Code:    "bad_filter",
+					Message: "The include_deleted should be either true or false",
+				})
+				return
+			}
+		}
+
+		page, err := service.List(ctx, ports.ListQuery{
+			Filter:         portsFilter(ctx),
+			After:          after,
+			Limit:          limit,
+			IncludeDeleted: includeDeleted,
+		})
+		if err != nil {
+			log.Printf("PORTS[LIST][service.list], error=%q\n", err)
 			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
 				Code:    "internal_error",
 				Message: "Please check with the administrator",
@@ -89,22 +274,72 @@ func createPortsHandler(service ports.PortService) gin.HandlerFunc {
 			return
 		}
 
-		// file_buf.decode
-		ports, err := decodePortsBody(buf.Bytes())
+		ctx.SecureJSON(http.StatusOK, portsPage(page))
+	}
+}
+
+func createPortsHandler(service ports.PortService, config portHandlersConfig) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		file, format, err := uploadedPorts(ctx, config.maxDecompressedSize)
+		if status, apiErr, found := uploadFailure(err); found {
+			ctx.SecureJSON(status, apiErr)
+			return
+		}
 		if err != nil {
-			log.Printf("PORTS[CREATE][file_buf.unmarshal], error=%q\n", err)
+			ctx.SecureJSON(http.StatusBadRequest, ApiError{
+				Code:    "bad_format",
+				Message: err.Error(),
+			})
+			return
+		}
+		defer file.Close()
 
+		opts, dryRun, err := importOptions(ctx)
+		if err != nil {
 			ctx.SecureJSON(http.StatusBadRequest, ApiError{
-				Code:    "bad_json_file",
-				Message: "Please check your json file, there might be syntax issues",
+				Code:    "bad_mode",
+				Message: err.Error(),
 			})
 			return
 		}
 
-		// service.create_or_update_many
-		err = service.CreateOrUpdateMany(ctx, ports)
+		async := false
+		if value := ctx.Query("async"); value != "" {
+			if async, err = strconv.ParseBool(value); err != nil {
+				ctx.SecureJSON(http.StatusBadRequest, ApiError{
+					Code:    "bad_mode",
+					Message: "the async should be either true or false",
+				})
+				return
+			}
+		}
+		if async {
+			startImportJob(ctx, service, config.jobs, file, format, opts)
+			return
+		}
+
+		// service.create_or_update_from
+		result, err := service.CreateOrUpdateFrom(ctx, format(file), opts...)
+		if status, apiErr, found := uploadFailure(err); found {
+			log.Printf("PORTS[CREATE][file.decompress], error=%q\n", err)
+			ctx.SecureJSON(status, apiErr)
+			return
+		}
+		if errors.Is(err, ports.ErrEmptyReplace) {
+			ctx.SecureJSON(http.StatusBadRequest, ApiError{
+				Code:    "empty_file",
+				Message: "The file has no ports; replacing with it would remove all the stored ports",
+			})
+			return
+		}
+		var sourceErr *ports.SourceError
+		if errors.As(err, &sourceErr) {
+			log.Printf("PORTS[CREATE][file.decode], error=%q\n", err)
+			ctx.SecureJSON(http.StatusBadRequest, badFileError(err))
+			return
+		}
 		if err != nil {
-			log.Printf("PORTS[CREATE][service.create_or_update_many], error=%q\n", err)
+			log.Printf("PORTS[CREATE][service.create_or_update_from], error=%q\n", err)
 			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
 				Code:    "err_data_store",
 				Message: "Error while storing the data; please contact administrator to check the reason of failure",
@@ -112,8 +347,65 @@ func createPortsHandler(service ports.PortService) gin.HandlerFunc {
 			return
 		}
 
-		ctx.SecureJSON(http.StatusCreated, "{}")
+		status := http.StatusCreated
+		if result.Failed > 0 {
+			log.Printf("PORTS[CREATE][service.create_or_update_from], failed=%d\n", result.Failed)
+			status = http.StatusMultiStatus
+		}
+		if dryRun {
+			status = http.StatusOK
+		}
+		report := importReport(result)
+		report.DryRun = dryRun
+		ctx.SecureJSON(status, report)
+	}
+}
+
+/*
+importOptions reads the upload mode: with `mode=replace`, the ports missing from the file are
+deleted after the import, and with `dry_run=true` too, they are only reported, and nothing is written.
+With `partial=true`, the malformed records are reported as failures, and skipped, ie. the lines of an
+NDJSON file, or the ports of a JSON file with fields of the wrong type; it can't be used with `mode=replace`.
+*/
+func importOptions(ctx *gin.Context) ([]ports.ImportOption, bool, error) {
+	var opts []ports.ImportOption
+	switch mode := ctx.Query("mode"); mode {
+	case "", "upsert":
+	case "replace":
+		opts = append(opts, ports.WithReplace())
+	default:
+		return nil, false, fmt.Errorf("unknown mode %q, it should be either upsert or replace", mode)
+	}
+
+	dryRun := false
+	if value := ctx.Query("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			return nil, false, errors.New("the dry_run should be either true or false")
+		}
+	}
+	if dryRun {
+		if len(opts) == 0 {
+			return nil, false, errors.New("the dry_run is supported only with mode=replace")
+		}
+		opts = append(opts, ports.WithDryRun())
+	}
+
+	if value := ctx.Query("partial"); value != "" {
+		partial, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, false, errors.New("the partial should be either true or false")
+		}
+		if partial && len(opts) > 0 {
+			// a malformed record may hide the code of a stored port, that replace mode would then delete
+			return nil, false, errors.New("the partial is not supported with mode=replace")
+		}
+		if partial {
+			opts = append(opts, ports.WithPartial())
+		}
 	}
+
+	return opts, dryRun, nil
 }
 
 type portRequest struct {
@@ -129,42 +421,193 @@ type portRequest struct {
 	Unlocs      []string  `json:"unlocs"`
 }
 
-func decodePortsBody(data []byte) (res []ports.Port, err error) {
-	var portsReq map[string]portRequest
-	err = json.Unmarshal(data, &portsReq)
-	if err != nil {
-		return res, err
-	}
-
-	for code, portBody := range portsReq {
-		res = append(res, ports.Port{
-			PortCode:    code,
-			Name:        portBody.Name,
-			City:        portBody.City,
-			Country:     portBody.Country,
-			Code:        portBody.Code,
-			Alias:       portBody.Alias,
-			Regions:     portBody.Regions,
-			Coordinates: portBody.Coordinates,
-			Province:    portBody.Province,
-			Timezone:    portBody.Timezone,
-			Unlocs:      portBody.Unlocs,
-		})
+func (pr portRequest) toPort(code string) ports.Port {
+	return ports.Port{
+		PortCode:    code,
+		Name:        pr.Name,
+		City:        pr.City,
+		Country:     pr.Country,
+		Code:        pr.Code,
+		Alias:       pr.Alias,
+		Regions:     pr.Regions,
+		Coordinates: pr.Coordinates,
+		Province:    pr.Province,
+		Timezone:    pr.Timezone,
+		Unlocs:      pr.Unlocs,
+	}
+}
+
+/*
+badFileError describes a malformed upload; a malformed JSON is located in the details, by its
+byte offset, line and column, along with the port code, the path of a field of the wrong type,
+and a snippet of the file around it.
+*/
+func badFileError(err error) ApiError {
+	apiErr := ApiError{
+		Code:    "bad_json_file",
+		Message: "Please check your file, there might be syntax issues",
+	}
+
+	var jsonErr *jsonError
+	var recordErr *ports.RecordError
+	var headerErr *headerError
+	var sourceErr *ports.SourceError
+	switch {
+	case errors.As(err, &jsonErr):
+		apiErr.Message = fmt.Sprintf("Please check the byte %d of your file: %s", jsonErr.Offset, jsonErr.Err)
+		if jsonErr.Line > 0 {
+			apiErr.Message = fmt.Sprintf("Please check the line %d, column %d of your file: %s", jsonErr.Line, jsonErr.Column, jsonErr.Err)
+		}
+		apiErr.Details = jsonErrorResponse{
+			Offset:   jsonErr.Offset,
+			Line:     jsonErr.Line,
+			Column:   jsonErr.Column,
+			PortCode: jsonErr.PortCode,
+			Field:    jsonErr.Field,
+			Context:  jsonErr.Context,
+		}
+	case errors.As(err, &recordErr):
+		apiErr.Message = recordErrorMessage(recordErr)
+	case errors.As(err, &headerErr):
+		apiErr.Message = fmt.Sprintf("Please check the header at line %d of your file: %s", headerErr.line, headerErr.err)
+	case errors.As(err, &sourceErr):
+		apiErr.Message = fmt.Sprintf("Please check your file: %s", sourceErr.Err)
 	}
+	return apiErr
+}
+
+// jsonErrorResponse locates a malformed JSON upload; the offset is 0-based, and the line and column are 1-based
+type jsonErrorResponse struct {
+	Offset   int64  `json:"offset"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	PortCode string `json:"port_code,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Context  string `json:"context,omitempty"`
+}
 
-	return res, nil
+// recordErrorMessage points to the malformed record by its line, or by its port code, for the formats without lines
+func recordErrorMessage(err *ports.RecordError) string {
+	switch {
+	case err.Line > 0:
+		return fmt.Sprintf("Please check the line %d of your file: %s", err.Line, err.Err)
+	case err.PortCode != "":
+		return fmt.Sprintf("Please check the port %s in your file: %s", err.PortCode, err.Err)
+	default:
+		return fmt.Sprintf("Please check your file: %s", err.Err)
+	}
 }
 
 type portResponse struct {
-	PortCode    string    `json:"port_code,omitempty"`
-	Name        string    `json:"name,omitempty"`
-	City        string    `json:"city,omitempty"`
-	Country     string    `json:"country,omitempty"`
-	Code        string    `json:"code,omitempty"`
-	Alias       []string  `json:"alias,omitempty"`
-	Regions     []string  `json:"regions,omitempty"`
-	Coordinates []float64 `json:"coordinates,omitempty"`
-	Province    string    `json:"province,omitempty"`
-	Timezone    string    `json:"timezone,omitempty"`
-	Unlocs      []string  `json:"unlocs,omitempty"`
+	PortCode    string     `json:"port_code,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	City        string     `json:"city,omitempty"`
+	Country     string     `json:"country,omitempty"`
+	Code        string     `json:"code,omitempty"`
+	Alias       []string   `json:"alias,omitempty"`
+	Regions     []string   `json:"regions,omitempty"`
+	Coordinates []float64  `json:"coordinates,omitempty"`
+	Province    string     `json:"province,omitempty"`
+	Timezone    string     `json:"timezone,omitempty"`
+	Unlocs      []string   `json:"unlocs,omitempty"`
+	CountryCode string     `json:"country_code,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+type importReportResponse struct {
+	Created   int                     `json:"created"`
+	Updated   int                     `json:"updated"`
+	Unchanged int                     `json:"unchanged"`
+	Failed    int                     `json:"failed"`
+	Failures  []importFailureResponse `json:"failures"`
+	// FailuresOmitted is the number of failures, that are not listed, past the first ports.MaxImportFailures
+	FailuresOmitted int `json:"failures_omitted,omitempty"`
+	// Warnings are the issues of the stored ports, that are likely mistakes in the data
+	Warnings []validationErrorResponse `json:"warnings,omitempty"`
+	// WarningsOmitted is the number of warnings, that are not listed, past the first ports.MaxImportFailures
+	WarningsOmitted int `json:"warnings_omitted,omitempty"`
+	// Removed is the number of ports removed in replace mode, or that would be removed in a dry run
+	Removed      int      `json:"removed"`
+	RemovedPorts []string `json:"removed_ports,omitempty"`
+	// RemovalSkipped is set in replace mode, if nothing was removed, because some ports failed
+	RemovalSkipped bool `json:"removal_skipped,omitempty"`
+	DryRun         bool `json:"dry_run,omitempty"`
+}
+
+type importFailureResponse struct {
+	PortCode string `json:"port_code"`
+	Line     int    `json:"line,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+func importReport(result ports.ImportResult) importReportResponse {
+	failures := make([]importFailureResponse, 0, len(result.Failures))
+	for _, failure := range result.Failures {
+		failures = append(failures, importFailureResponse(failure))
+	}
+	var warnings []validationErrorResponse
+	for _, warning := range result.Warnings {
+		warnings = append(warnings, validationErrorResponse(warning))
+	}
+
+	return importReportResponse{
+		Created:         result.Created,
+		Updated:         result.Updated,
+		Unchanged:       result.Unchanged,
+		Failed:          result.Failed,
+		Failures:        failures,
+		FailuresOmitted: result.OmittedFailures,
+		Warnings:        warnings,
+		WarningsOmitted: result.OmittedWarnings,
+		Removed:         len(result.Removed),
+		RemovedPorts:    result.Removed,
+		RemovalSkipped:  result.RemovalSkipped,
+	}
+}
+
+func portsFilter(ctx *gin.Context) ports.Filter {
+	return ports.Filter{
+		Country:     ctx.Query("country"),
+		CountryCode: countryCode(ctx.Query("country_code")),
+		Province:    ctx.Query("province"),
+		City:        ctx.Query("city"),
+		Timezone:    ctx.Query("timezone"),
+		Regions:     ctx.QueryArray("regions"),
+		Unlocs:      ctx.QueryArray("unlocs"),
+	}
+}
+
+// countryCode turns an alpha-2 or alpha-3 country code into the alpha-2 code, that is stored
+func countryCode(code string) string {
+	if country, found := countries.ByCode(code); found {
+		return country.Alpha2
+	}
+	return code
+}
+
+type portsPageResponse struct {
+	Data       []portResponse `json:"data"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+func portsPage(page ports.Page) portsPageResponse {
+	data := make([]portResponse, 0, len(page.Ports))
+	for _, port := range page.Ports {
+		data = append(data, portResponse(port))
+	}
+
+	return portsPageResponse{
+		Data:       data,
+		NextCursor: encodeCursor(page.NextCursor),
+	}
+}
+
+// encodeCursor makes the cursor opaque for the clients, so that they don't rely on it being a port code
+func encodeCursor(after string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(after))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	after, err := base64.RawURLEncoding.DecodeString(cursor)
+	return string(after), err
 }
@@ -0,0 +1,231 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// jsonWindowSize is how much of the latest read input is kept to locate the errors; it only has to cover the decoder buffer
+	jsonWindowSize = 64 << 10
+	// jsonContextSize is the number of bytes of the context snippet, on each side of the malformed byte
+	jsonContextSize = 24
+)
+
+/*
+jsonError locates a malformed JSON upload: Offset is the position of the malformed byte in the
+(decompressed) file, and Line and Column are 1-based, or 0 if they could not be computed. Field
+is the path of a value of the wrong type, ie. `AEAJM.coordinates[0]`.
+*/
+type jsonError struct {
+	Offset   int64
+	Line     int
+	Column   int
+	PortCode string
+	Field    string
+	Context  string
+	Err      error
+}
+
+func (je *jsonError) Error() string {
+	if je.Line > 0 {
+		return fmt.Sprintf("%s, at line %d, column %d", je.Err, je.Line, je.Column)
+	}
+	return fmt.Sprintf("%s, at offset %d", je.Err, je.Offset)
+}
+
+func (je *jsonError) Unwrap() error {
+	return je.Err
+}
+
+/*
+positionReader keeps a window of the latest bytes read from an upload, along with the number of
+lines before it, so that an offset reported by the JSON decoder can be turned into a line, a
+column and a snippet, without holding the whole file in memory.
+*/
+type positionReader struct {
+	r      io.Reader
+	window []byte
+	// start is the offset of the first byte of the window
+	start int64
+	// lines is the number of line breaks before the window, and lineStart the offset of the line, the window starts in
+	lines     int
+	lineStart int64
+}
+
+func newPositionReader(r io.Reader) *positionReader {
+	return &positionReader{r: r}
+}
+
+func (pr *positionReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.window = append(pr.window, p[:n]...)
+	if len(pr.window) > 2*jsonWindowSize {
+		dropped := pr.window[:len(pr.window)-jsonWindowSize]
+		pr.lines += bytes.Count(dropped, []byte{'\n'})
+		if i := bytes.LastIndexByte(dropped, '\n'); i >= 0 {
+			pr.lineStart = pr.start + int64(i) + 1
+		}
+		pr.start += int64(len(dropped))
+		pr.window = append(pr.window[:0], pr.window[len(dropped):]...)
+	}
+	return n, err
+}
+
+// read returns the number of bytes read so far
+func (pr *positionReader) read() int64 {
+	return pr.start + int64(len(pr.window))
+}
+
+// locate wraps err with the position of the byte at offset; past the end of the input, it points right after the last byte
+func (pr *positionReader) locate(err error, offset int64) *jsonError {
+	if offset > pr.read() {
+		offset = pr.read()
+	}
+	located := &jsonError{Offset: offset, Err: err}
+	if offset < pr.start {
+		return located
+	}
+
+	i := int(offset - pr.start)
+	before := pr.window[:i]
+	located.Line = pr.lines + bytes.Count(before, []byte{'\n'}) + 1
+	lineStart := pr.lineStart
+	if nl := bytes.LastIndexByte(before, '\n'); nl >= 0 {
+		lineStart = pr.start + int64(nl) + 1
+	}
+	located.Column = int(offset-lineStart) + 1
+
+	from := i - jsonContextSize
+	if begin := int(lineStart - pr.start); from < begin {
+		from = begin
+	}
+	if from < 0 {
+		from = 0
+	}
+	to := i + jsonContextSize
+	if to > len(pr.window) {
+		to = len(pr.window)
+	}
+	if nl := bytes.IndexByte(pr.window[i:to], '\n'); nl >= 0 {
+		to = i + nl
+	}
+	located.Context = strings.TrimSpace(strings.ToValidUTF8(string(pr.window[from:to]), string(utf8.RuneError)))
+	return located
+}
+
+// syntaxError locates a JSON syntax error, or the end of a truncated file; the other errors, ie. of the upload itself, are returned as they are
+func (pr *positionReader) syntaxError(err error) error {
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &syntaxErr):
+		// the decoder reports the offset right after the malformed byte
+		return pr.locate(err, syntaxErr.Offset-1)
+	case err == io.ErrUnexpectedEOF:
+		return pr.locate(err, pr.read())
+	}
+	return err
+}
+
+/*
+jsonPath finds the value of data, that ends at offset, as reported by a json.UnmarshalTypeError,
+and returns its path, ie. `coordinates[0]`, along with the offset of its first byte. The path of
+the top level value is "".
+*/
+func jsonPath(data []byte, offset int64) (string, int64, bool) {
+	var stack []*jsonFrame
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var end int64
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return "", 0, false
+		}
+		start := end
+		for start < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[start]) >= 0 {
+			start++
+		}
+		end = dec.InputOffset()
+
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		if delim, ok := token.(json.Delim); ok && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 {
+				stack[len(stack)-1].advance()
+			}
+			continue
+		}
+		if top != nil && top.wantKey {
+			top.key, top.wantKey = token.(string), false
+			continue
+		}
+
+		path := ""
+		switch {
+		case top == nil:
+		case top.array:
+			path = top.path + "[" + strconv.Itoa(top.index) + "]"
+		case top.path == "":
+			path = top.key
+		default:
+			path = top.path + "." + top.key
+		}
+		if end == offset {
+			return path, start, true
+		}
+
+		if delim, ok := token.(json.Delim); ok {
+			stack = append(stack, &jsonFrame{path: path, array: delim == '[', wantKey: delim == '{'})
+		} else if top != nil {
+			top.advance()
+		}
+	}
+}
+
+// jsonFrame is an array or an object, that jsonPath is inside of
+type jsonFrame struct {
+	path  string
+	array bool
+	// index is the index of the current array item, and key the key of the current object member
+	index   int
+	key     string
+	wantKey bool
+}
+
+// advance moves the frame past its current item, or member
+func (f *jsonFrame) advance() {
+	if f.array {
+		f.index++
+		return
+	}
+	f.wantKey = true
+}
+
+// typeMismatch describes a json.UnmarshalTypeError by the kind of JSON value, that is expected at the field
+func typeMismatch(field string, err *json.UnmarshalTypeError) error {
+	expected := "a string"
+	switch err.Type.Kind() {
+	case reflect.Bool:
+		expected = "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		expected = "a number"
+	case reflect.Slice, reflect.Array:
+		expected = "an array"
+	case reflect.Struct, reflect.Map:
+		expected = "an object"
+	}
+	return fmt.Errorf("%s should be %s, got %s", field, expected, err.Value)
+}
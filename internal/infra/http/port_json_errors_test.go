@@ -0,0 +1,72 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPositionReader(t *testing.T) {
+	t.Run("locate a byte by its line and column", func(t *testing.T) {
+		pos := newPositionReader(strings.NewReader("{\n  \"AEAJM\": {\"name\": \"Ajman\",, \"city\": \"Ajman\"}\n}"))
+		_, err := io.ReadAll(pos)
+		require.NoError(t, err)
+
+		located := pos.locate(errors.New("malformed"), 31)
+		require.Equal(t, int64(31), located.Offset)
+		require.Equal(t, 2, located.Line)
+		require.Equal(t, 30, located.Column)
+		require.Equal(t, `AJM": {"name": "Ajman",, "city": "Ajman"}`, located.Context)
+		require.Equal(t, "malformed, at line 2, column 30", located.Error())
+	})
+
+	t.Run("keep counting lines past the window", func(t *testing.T) {
+		line := strings.Repeat("x", 99) + "\n"
+		lines := 3 * jsonWindowSize / len(line)
+		pos := newPositionReader(strings.NewReader(strings.Repeat(line, lines) + "end"))
+		_, err := io.Copy(io.Discard, pos)
+		require.NoError(t, err)
+
+		located := pos.locate(errors.New("malformed"), pos.read()-1)
+		require.Equal(t, lines+1, located.Line)
+		require.Equal(t, 3, located.Column)
+		require.Equal(t, "end", located.Context)
+
+		located = pos.locate(errors.New("malformed"), 0)
+		require.Equal(t, 0, located.Line)
+		require.Equal(t, "malformed, at offset 0", located.Error())
+	})
+}
+
+func TestJSONPath(t *testing.T) {
+	data := []byte(`{"name": "Ajman", "coordinates": [55.5, "25.4"], "alias": [], "extra": {"list": [{"a": 1}, {"b": true}]}}`)
+	cases := []struct {
+		value string
+		path  string
+	}{
+		{value: `{"name"`, path: ""},
+		{value: `"Ajman"`, path: "name"},
+		{value: `"25.4"`, path: "coordinates[1]"},
+		{value: `[]`, path: "alias"},
+		{value: `true`, path: "extra.list[1].b"},
+	}
+	for _, c := range cases {
+		start := strings.Index(string(data), c.value)
+		end := start + len(c.value)
+		if c.path == "" || c.value == "[]" {
+			// the containers are reported right after their opening delimiter
+			end = start + 1
+		}
+
+		path, at, found := jsonPath(data, int64(end))
+		require.True(t, found, c.value)
+		require.Equal(t, c.path, path)
+		require.Equal(t, int64(start), at)
+	}
+
+	_, _, found := jsonPath(data, 3)
+	require.False(t, found)
+}
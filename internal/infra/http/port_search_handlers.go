@@ -0,0 +1,117 @@
+package http
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxSearchLimit      = 100
+	maxSearchTextLength = 200
+
+	maxAutocompleteLimit = 50
+)
+
+func searchPortsHandler(service ports.PortService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		query, err := searchQuery(ctx)
+		if err != nil {
+			ctx.SecureJSON(http.StatusBadRequest, ApiError{
+				Code:    "bad_query",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		found, err := service.Search(ctx, query)
+		if err != nil {
+			log.Printf("PORTS[SEARCH][service.search], error=%q\n", err)
+			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
+				Code:    "internal_error",
+				Message: "Please check with the administrator",
+			})
+			return
+		}
+
+		data := make([]portResponse, 0, len(found))
+		for _, port := range found {
+			data = append(data, portResponse(port))
+		}
+		ctx.SecureJSON(http.StatusOK, gin.H{"data": data})
+	}
+}
+
+func searchQuery(ctx *gin.Context) (ports.SearchQuery, error) {
+	query := ports.SearchQuery{
+		Text:  strings.TrimSpace(ctx.Query("q")),
+		Limit: ports.DefaultSearchLimit,
+	}
+	if query.Text == "" || len(query.Text) > maxSearchTextLength {
+		return query, fmt.Errorf("the q should be a text of 1 to %d characters", maxSearchTextLength)
+	}
+
+	if value := ctx.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxSearchLimit {
+			return query, fmt.Errorf("the limit should be a number between 1 and %d", maxSearchLimit)
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
+
+func autocompletePortsHandler(service ports.PortService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		query, err := autocompleteQuery(ctx)
+		if err != nil {
+			ctx.SecureJSON(http.StatusBadRequest, ApiError{
+				Code:    "bad_query",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		found, err := service.Autocomplete(ctx, query)
+		if err != nil {
+			log.Printf("PORTS[AUTOCOMPLETE][service.autocomplete], error=%q\n", err)
+			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
+				Code:    "internal_error",
+				Message: "Please check with the administrator",
+			})
+			return
+		}
+
+		data := make([]portResponse, 0, len(found))
+		for _, port := range found {
+			data = append(data, portResponse(port))
+		}
+		ctx.SecureJSON(http.StatusOK, gin.H{"data": data})
+	}
+}
+
+func autocompleteQuery(ctx *gin.Context) (ports.AutocompleteQuery, error) {
+	query := ports.AutocompleteQuery{
+		Prefix: strings.TrimLeft(ctx.Query("prefix"), " "),
+		Limit:  ports.DefaultAutocompleteLimit,
+	}
+	if query.Prefix == "" || len(query.Prefix) > maxSearchTextLength {
+		return query, fmt.Errorf("the prefix should be a text of 1 to %d characters", maxSearchTextLength)
+	}
+
+	if value := ctx.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxAutocompleteLimit {
+			return query, fmt.Errorf("the limit should be a number between 1 and %d", maxAutocompleteLimit)
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
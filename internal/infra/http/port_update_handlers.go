@@ -0,0 +1,176 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// replacePortHandler creates or replaces the port with the JSON body; the fields missing from the body are removed
+func replacePortHandler(service ports.PortService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		code := ctx.Param("port_code")
+		_, body, err := decodePortFields(ctx.Request.Body, code)
+		if err != nil {
+			ctx.SecureJSON(http.StatusBadRequest, ApiError{
+				Code:    "bad_json",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		port, created, err := service.Replace(ctx, body.toPort(code))
+		var invalid ports.ValidationErrors
+		if errors.As(err, &invalid) {
+			ctx.SecureJSON(http.StatusUnprocessableEntity, invalidPortError(invalid))
+			return
+		}
+		if err != nil {
+			log.Printf("PORTS[REPLACE][service.replace], error=%q\n", err)
+			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
+				Code:    "err_data_store",
+				Message: "Please check with the administrator",
+			})
+			return
+		}
+
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		ctx.SecureJSON(status, writtenPortResponse(port))
+	}
+}
+
+// patchPortHandler applies a JSON Merge Patch (RFC 7396) to the port: the given fields are replaced, and the null ones are removed
+func patchPortHandler(service ports.PortService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		code := ctx.Param("port_code")
+		patch, err := decodePortPatch(ctx.Request.Body, code)
+		if err != nil {
+			ctx.SecureJSON(http.StatusBadRequest, ApiError{
+				Code:    "bad_json",
+				Message: err.Error(),
+			})
+			return
+		}
+
+		port, err := service.Patch(ctx, code, patch)
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.SecureJSON(http.StatusNotFound, ApiError{
+				Code:    "not_found",
+				Message: "No port found with the specified port code",
+			})
+			return
+		}
+		var invalid ports.ValidationErrors
+		if errors.As(err, &invalid) {
+			ctx.SecureJSON(http.StatusUnprocessableEntity, invalidPortError(invalid))
+			return
+		}
+		if err != nil {
+			log.Printf("PORTS[PATCH][service.patch], error=%q\n", err)
+			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
+				Code:    "err_data_store",
+				Message: "Please check with the administrator",
+			})
+			return
+		}
+
+		ctx.SecureJSON(http.StatusOK, writtenPortResponse(port))
+	}
+}
+
+// portWarningsResponse is a written port, along with the issues of its data, that are likely mistakes
+type portWarningsResponse struct {
+	portResponse
+	Warnings []validationErrorResponse `json:"warnings,omitempty"`
+}
+
+func writtenPortResponse(port ports.Port) portWarningsResponse {
+	response := portWarningsResponse{portResponse: portResponse(port)}
+	for _, warning := range ports.Warn(port) {
+		response.Warnings = append(response.Warnings, validationErrorResponse(warning))
+	}
+	return response
+}
+
+// invalidPortError lists the broken validation rules of a port, that was not written
+func invalidPortError(errs ports.ValidationErrors) ApiError {
+	details := make([]validationErrorResponse, 0, len(errs))
+	for _, err := range errs {
+		details = append(details, validationErrorResponse(err))
+	}
+	return ApiError{
+		Code:    "invalid_port",
+		Message: "The port breaks some validation rules, that are listed in the details",
+		Details: details,
+	}
+}
+
+/*
+decodePortPatch turns a merge patch into the port fields to set, and the fields to remove. Ports
+have no nested objects, so the patch is flat: a null field is removed, and any other field
+replaces the stored one, including the lists. Empty strings and lists are removed too, as
+they are not stored.
+*/
+func decodePortPatch(r io.Reader, code string) (ports.PortPatch, error) {
+	fields, body, err := decodePortFields(r, code)
+	if err != nil {
+		return ports.PortPatch{}, err
+	}
+
+	patch := ports.PortPatch{Set: body.toPort(code)}
+	set := patch.Set.AsBson()
+	for field := range fields {
+		if _, found := set[field]; !found && field != "port_code" {
+			patch.Unset = append(patch.Unset, field)
+		}
+	}
+	sort.Strings(patch.Unset)
+
+	return patch, nil
+}
+
+// decodePortFields decodes a single port JSON object, and returns the fields that are present in it, along with their values
+func decodePortFields(r io.Reader, code string) (map[string]json.RawMessage, portRequest, error) {
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&fields); err != nil || fields == nil {
+		return nil, portRequest{}, errors.New("the body should be a JSON object of port fields")
+	}
+
+	writable := make(map[string]bool, len(ports.PortFields))
+	for _, field := range ports.PortFields {
+		writable[field] = true
+	}
+
+	values := make(map[string]json.RawMessage, len(fields))
+	for field, value := range fields {
+		if field == "port_code" {
+			var bodyCode string
+			if json.Unmarshal(value, &bodyCode) != nil || bodyCode != code {
+				return nil, portRequest{}, fmt.Errorf("the port_code should be %q, as in the URL", code)
+			}
+			continue
+		}
+		if !writable[field] {
+			return nil, portRequest{}, fmt.Errorf("unknown port field %q", field)
+		}
+		values[field] = value
+	}
+
+	var body portRequest
+	data, _ := json.Marshal(values)
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, portRequest{}, fmt.Errorf("the port fields are not valid: %w", err)
+	}
+	return fields, body, nil
+}
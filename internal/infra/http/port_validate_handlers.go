@@ -0,0 +1,134 @@
+package http
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/gin-gonic/gin"
+)
+
+// validatePortsHandler checks an uploaded ports file, and reports what its import would change, without writing anything
+func validatePortsHandler(service ports.PortService, config portHandlersConfig) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		file, format, err := uploadedPorts(ctx, config.maxDecompressedSize)
+		if status, apiErr, found := uploadFailure(err); found {
+			ctx.SecureJSON(status, apiErr)
+			return
+		}
+		if err != nil {
+			ctx.SecureJSON(http.StatusBadRequest, ApiError{
+				Code:    "bad_format",
+				Message: err.Error(),
+			})
+			return
+		}
+		defer file.Close()
+
+		report, err := service.Validate(ctx, format(file))
+		if status, apiErr, found := uploadFailure(err); found {
+			log.Printf("PORTS[VALIDATE][file.decompress], error=%q\n", err)
+			ctx.SecureJSON(status, apiErr)
+			return
+		}
+		var sourceErr *ports.SourceError
+		if errors.As(err, &sourceErr) {
+			log.Printf("PORTS[VALIDATE][file.decode], error=%q\n", err)
+			ctx.SecureJSON(http.StatusBadRequest, badFileError(err))
+			return
+		}
+		if err != nil {
+			log.Printf("PORTS[VALIDATE][service.validate], error=%q\n", err)
+			ctx.SecureJSON(http.StatusInternalServerError, ApiError{
+				Code:    "err_data_store",
+				Message: "Error while reading the stored ports; please contact administrator to check the reason of failure",
+			})
+			return
+		}
+
+		ctx.SecureJSON(http.StatusOK, validationReport(report))
+	}
+}
+
+type validationReportResponse struct {
+	Valid     bool                      `json:"valid"`
+	Summary   validationSummaryResponse `json:"summary"`
+	New       []string                  `json:"new"`
+	Changed   []portChangeResponse      `json:"changed"`
+	Unchanged []string                  `json:"unchanged"`
+	Errors    []validationErrorResponse `json:"errors"`
+	Warnings  []validationErrorResponse `json:"warnings"`
+	// ErrorsOmitted and WarningsOmitted are the numbers of errors and warnings, that are not listed, past the first ports.MaxImportFailures
+	ErrorsOmitted   int `json:"errors_omitted,omitempty"`
+	WarningsOmitted int `json:"warnings_omitted,omitempty"`
+	// NewOmitted, ChangedOmitted and UnchangedOmitted are the numbers of ports, that are not listed, past the first ports.MaxImportFailures
+	NewOmitted       int `json:"new_omitted,omitempty"`
+	ChangedOmitted   int `json:"changed_omitted,omitempty"`
+	UnchangedOmitted int `json:"unchanged_omitted,omitempty"`
+}
+
+type validationSummaryResponse struct {
+	New       int `json:"new"`
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+	Invalid   int `json:"invalid"`
+}
+
+type portChangeResponse struct {
+	PortCode string              `json:"port_code"`
+	Diffs    []fieldDiffResponse `json:"diffs"`
+}
+
+type fieldDiffResponse struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+type validationErrorResponse struct {
+	PortCode string `json:"port_code"`
+	Line     int    `json:"line,omitempty"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+func validationReport(report ports.ValidationReport) validationReportResponse {
+	changed := make([]portChangeResponse, 0, len(report.Changed))
+	for _, change := range report.Changed {
+		diffs := make([]fieldDiffResponse, 0, len(change.Diffs))
+		for _, diff := range change.Diffs {
+			diffs = append(diffs, fieldDiffResponse(diff))
+		}
+		changed = append(changed, portChangeResponse{PortCode: change.PortCode, Diffs: diffs})
+	}
+
+	errs := make([]validationErrorResponse, 0, len(report.Errors))
+	for _, err := range report.Errors {
+		errs = append(errs, validationErrorResponse(err))
+	}
+	warnings := make([]validationErrorResponse, 0, len(report.Warnings))
+	for _, warning := range report.Warnings {
+		warnings = append(warnings, validationErrorResponse(warning))
+	}
+
+	return validationReportResponse{
+		Valid: report.Valid(),
+		Summary: validationSummaryResponse{
+			New:       len(report.New) + report.OmittedNew,
+			Changed:   len(report.Changed) + report.OmittedChanged,
+			Unchanged: len(report.Unchanged) + report.OmittedUnchanged,
+			Invalid:   report.Invalid,
+		},
+		New:              append([]string{}, report.New...),
+		Changed:          changed,
+		Unchanged:        append([]string{}, report.Unchanged...),
+		Errors:           errs,
+		Warnings:         warnings,
+		ErrorsOmitted:    report.OmittedErrors,
+		WarningsOmitted:  report.OmittedWarnings,
+		NewOmitted:       report.OmittedNew,
+		ChangedOmitted:   report.OmittedChanged,
+		UnchangedOmitted: report.OmittedUnchanged,
+	}
+}
@@ -2,31 +2,90 @@ package database
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
 
 	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const DefaultBulkChunkSize = 1000
+
+const (
+	// keyField is the field, that identifies the records, and that has a unique index
+	keyField = "port_code"
+	// duplicateKeyCode is the code of the write errors, that break a unique index
+	duplicateKeyCode = 11000
+	// maxUpsertRetries is the number of times an upsert, that lost an insert race, is sent again
+	maxUpsertRetries = 2
+	// maxReportedDuplicates is the number of duplicated keys, reported when the unique index can't be created
+	maxReportedDuplicates = 10
+)
+
 type MongoDB struct {
-	client     *mongo.Client
-	dbName     string
-	collection *mongo.Collection
+	client        *mongo.Client
+	dbName        string
+	collection    *mongo.Collection
+	bulkChunkSize int
+	// indexes keeps track of the indexes, that are already created by ensureIndex
+	indexes *sync.Map
+}
+
+// Option configures the MongoDB storage, created with NewMongoDB
+type Option func(*MongoDB)
+
+// WithBulkChunkSize sets the maximum number of writes, sent in a single BulkWrite request
+func WithBulkChunkSize(n int) Option {
+	return func(m *MongoDB) {
+		if n > 0 {
+			m.bulkChunkSize = n
+		}
+	}
 }
 
-func NewMongoDB(ctx context.Context, url, dbName, collectionName string) (storage.Storage, error) {
+func NewMongoDB(ctx context.Context, url, dbName, collectionName string, opts ...Option) (storage.Storage, error) {
 	clientOptions := options.Client().ApplyURI(url)
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	return &MongoDB{
-		client:     client,
-		dbName:     dbName,
-		collection: client.Database(dbName).Collection(collectionName),
-	}, nil
+	m := &MongoDB{
+		client:        client,
+		dbName:        dbName,
+		collection:    client.Database(dbName).Collection(collectionName),
+		bulkChunkSize: DefaultBulkChunkSize,
+		indexes:       &sync.Map{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	/*
+		Without a unique index, two upserts of the same record, that run at the same time, can both miss
+		the filter and both insert a document; with it, the one that loses the race fails with a duplicate
+		key error, and it is sent again, when it matches the document of the other one.
+	*/
+	if err := m.ensureIndex(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: keyField, Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, m.duplicatesError(ctx, err)
+		}
+		return nil, fmt.Errorf("failed to create the unique %s index: %w", keyField, err)
+	}
+
+	return m, nil
 }
 
 func (m *MongoDB) Find(ctx context.Context, filter map[string]interface{}, result interface{}) error {
@@ -44,6 +103,371 @@ func (m *MongoDB) Insert(ctx context.Context, document interface{}) error {
 }
 
 func (m *MongoDB) Update(ctx context.Context, filter interface{}, update interface{}) error {
-	_, err := m.collection.UpdateOne(ctx, filter, update)
+	result, err := m.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// Upsert sends the upsert again when it fails with a duplicate key error, as another upsert inserted the record meanwhile
+func (m *MongoDB) Upsert(ctx context.Context, filter interface{}, update interface{}) error {
+	var err error
+	for attempt := 0; attempt <= maxUpsertRetries; attempt++ {
+		_, err = m.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
 	return err
 }
+
+func (m *MongoDB) Delete(ctx context.Context, filter interface{}) error {
+	result, err := m.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+/*
+BulkUpsert sends the records as unordered UpdateOne upserts, using BulkWrite requests of
+at most bulkChunkSize records. A failed write does not stop the rest of the records
+from being written; it is reported in the result failures, by its index in the input.
+The writes, that fail with a duplicate key error, lost an insert race with another upsert
+of the same record, so they are sent again, like Upsert does, instead of being failures.
+Any other error, ie. the server is not reachable, is returned, along with the records written so far.
+*/
+func (m *MongoDB) BulkUpsert(ctx context.Context, records []storage.UpsertRecord) (storage.BulkUpsertResult, error) {
+	var result storage.BulkUpsertResult
+
+	for offset := 0; offset < len(records); offset += m.bulkChunkSize {
+		end := offset + m.bulkChunkSize
+		if end > len(records) {
+			end = len(records)
+		}
+
+		models := make([]mongo.WriteModel, 0, end-offset)
+		indexes := make([]int, 0, end-offset)
+		for i, record := range records[offset:end] {
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(record.ID).
+				SetUpdate(record.Obj).
+				SetUpsert(true))
+			indexes = append(indexes, offset+i)
+		}
+
+		if err := m.bulkWrite(ctx, models, indexes, &result); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// bulkWrite sends the models, that are the records at indexes of the input, and sends again the ones that fail with a duplicate key error
+func (m *MongoDB) bulkWrite(ctx context.Context, models []mongo.WriteModel, indexes []int, result *storage.BulkUpsertResult) error {
+	for attempt := 0; len(models) > 0; attempt++ {
+		res, err := m.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if res != nil {
+			result.Created += int(res.UpsertedCount)
+			result.Updated += int(res.ModifiedCount)
+			result.Unchanged += int(res.MatchedCount - res.ModifiedCount)
+		}
+		if err == nil {
+			return nil
+		}
+
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+			return err
+		}
+
+		var retryModels []mongo.WriteModel
+		var retryIndexes []int
+		for _, writeErr := range bulkErr.WriteErrors {
+			if writeErr.Code == duplicateKeyCode && attempt < maxUpsertRetries {
+				retryModels = append(retryModels, models[writeErr.Index])
+				retryIndexes = append(retryIndexes, indexes[writeErr.Index])
+				continue
+			}
+			result.Failures = append(result.Failures, storage.BulkFailure{
+				Index: indexes[writeErr.Index],
+				Err:   writeErr,
+			})
+		}
+		models, indexes = retryModels, retryIndexes
+	}
+
+	return nil
+}
+
+func (m *MongoDB) List(ctx context.Context, opts storage.ListOptions, results interface{}) error {
+	cursor, err := m.find(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+// Stream returns the driver cursor, which fetches the documents from the server in batches, while they are read
+func (m *MongoDB) Stream(ctx context.Context, opts storage.ListOptions) (storage.Cursor, error) {
+	cursor, err := m.find(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+func (m *MongoDB) find(ctx context.Context, opts storage.ListOptions) (*mongo.Cursor, error) {
+	if err := m.ensureIndex(ctx, mongo.IndexModel{Keys: bson.D{{Key: opts.SortField, Value: 1}}}); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{}
+	for key, value := range opts.Filter {
+		filter[key] = value
+	}
+	if opts.After != "" {
+		filter[opts.SortField] = bson.M{"$gt": opts.After}
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: opts.SortField, Value: 1}})
+	if opts.Limit > 0 {
+		findOptions.SetLimit(int64(opts.Limit))
+	}
+
+	return m.collection.Find(ctx, filter, findOptions)
+}
+
+// Near uses `$nearSphere` on a 2dsphere index of the field, which returns the documents ordered by distance
+func (m *MongoDB) Near(ctx context.Context, query storage.NearQuery, results interface{}) error {
+	if err := m.ensureIndex(ctx, mongo.IndexModel{Keys: bson.D{{Key: query.Field, Value: "2dsphere"}}}); err != nil {
+		return err
+	}
+
+	nearSphere := bson.M{
+		"$geometry": bson.M{
+			"type":        "Point",
+			"coordinates": bson.A{query.Lon, query.Lat},
+		},
+	}
+	if query.MaxDistance > 0 {
+		nearSphere["$maxDistance"] = query.MaxDistance
+	}
+
+	filter := bson.M{}
+	for key, value := range query.Filter {
+		filter[key] = value
+	}
+	filter[query.Field] = bson.M{"$nearSphere": nearSphere}
+
+	findOptions := options.Find()
+	if query.Limit > 0 {
+		findOptions.SetLimit(int64(query.Limit))
+	}
+
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+/*
+Within uses `$geoWithin` with `$geometry` polygons, that the 2dsphere index of the field serves, and
+that treat the edges as great-circle arcs; a box is searched as the polygons of BBox.Polygons.
+*/
+func (m *MongoDB) Within(ctx context.Context, query storage.WithinQuery, results interface{}) error {
+	if err := m.ensureIndex(ctx, mongo.IndexModel{Keys: bson.D{{Key: query.Field, Value: "2dsphere"}}}); err != nil {
+		return err
+	}
+
+	filter := bson.M{}
+	for key, value := range query.Filter {
+		filter[key] = value
+	}
+
+	within := func(polygon storage.Polygon) bson.M {
+		return bson.M{"$geoWithin": bson.M{
+			"$geometry": bson.M{"type": "Polygon", "coordinates": polygon},
+		}}
+	}
+	if query.Box != nil {
+		var polygons bson.A
+		for _, polygon := range query.Box.Polygons() {
+			polygons = append(polygons, bson.M{query.Field: within(polygon)})
+		}
+		filter["$or"] = polygons
+	} else {
+		filter[query.Field] = within(query.Polygon)
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "port_code", Value: 1}})
+	if query.Limit > 0 {
+		findOptions.SetLimit(int64(query.Limit))
+	}
+
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+/*
+Search uses a text index over the query fields, that is created with the query weights, and
+without a language, as names of places should not be stemmed. The index is not sensitive to
+case and diacritics, but, unlike the in-memory storage, it doesn't tolerate typos. A collection
+can have a single text index, so all the searches on a collection should use the same fields.
+*/
+func (m *MongoDB) Search(ctx context.Context, query storage.SearchQuery, results interface{}) error {
+	fields := make([]string, 0, len(query.Fields))
+	for field := range query.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	keys := bson.D{}
+	weights := bson.M{}
+	for _, field := range fields {
+		keys = append(keys, bson.E{Key: field, Value: "text"})
+		weights[field] = query.Fields[field]
+	}
+	if err := m.ensureIndex(ctx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetWeights(weights).SetDefaultLanguage("none"),
+	}); err != nil {
+		return err
+	}
+
+	filter := bson.M{"$text": bson.M{"$search": query.Text}}
+	for key, value := range query.Filter {
+		filter[key] = value
+	}
+
+	score := bson.M{"$meta": "textScore"}
+	findOptions := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "port_code", Value: 1}})
+	if query.Limit > 0 {
+		findOptions.SetLimit(int64(query.Limit))
+	}
+
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+/*
+SearchPrefix uses anchored regular expressions, which are resolved with an index on each field,
+ordered by name. Case insensitive expressions can't use the indexes, so the prefix is searched
+as it is, in upper case, and in title case, which covers the way codes and names are written.
+*/
+func (m *MongoDB) SearchPrefix(ctx context.Context, query storage.PrefixQuery, results interface{}) error {
+	for _, field := range query.Fields {
+		if err := m.ensureIndex(ctx, mongo.IndexModel{Keys: bson.D{{Key: field, Value: 1}}}); err != nil {
+			return err
+		}
+	}
+
+	var conditions bson.A
+	for _, variant := range prefixVariants(query.Prefix) {
+		pattern := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(variant)}
+		for _, field := range query.Fields {
+			conditions = append(conditions, bson.M{field: pattern})
+		}
+	}
+
+	filter := bson.M{"$or": conditions}
+	for key, value := range query.Filter {
+		filter[key] = value
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "port_code", Value: 1}})
+	if query.Limit > 0 {
+		findOptions.SetLimit(int64(query.Limit))
+	}
+
+	cursor, err := m.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
+
+func prefixVariants(prefix string) []string {
+	title := []rune(strings.ToLower(prefix))
+	for i := range title {
+		if i == 0 || title[i-1] == ' ' || title[i-1] == '-' {
+			title[i] = unicode.ToUpper(title[i])
+		}
+	}
+
+	var variants []string
+	seen := make(map[string]bool)
+	for _, variant := range []string{prefix, strings.ToUpper(prefix), string(title)} {
+		if !seen[variant] {
+			seen[variant] = true
+			variants = append(variants, variant)
+		}
+	}
+	return variants
+}
+
+// ensureIndex creates the index on the first query that needs it; creating an existing index is a no-op in MongoDB
+/*
+duplicatesError tells which keys are stored in more than one document, when the unique index can't
+be created over the documents written before it was introduced; the duplicates have to be removed,
+as described in the README, before the service can start.
+*/
+func (m *MongoDB) duplicatesError(ctx context.Context, indexErr error) error {
+	cursor, err := m.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$" + keyField}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: maxReportedDuplicates + 1}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return fmt.Errorf("failed to create the unique %s index, as some codes are stored more than once: %w", keyField, indexErr)
+	}
+
+	var groups []struct {
+		Key interface{} `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return fmt.Errorf("failed to create the unique %s index, as some codes are stored more than once: %w", keyField, indexErr)
+	}
+
+	codes := make([]string, 0, len(groups))
+	for i, group := range groups {
+		if i == maxReportedDuplicates {
+			codes = append(codes, "...")
+			break
+		}
+		codes = append(codes, fmt.Sprint(group.Key))
+	}
+	return fmt.Errorf("failed to create the unique %s index, as these codes are stored more than once: %s; remove the duplicates first: %w",
+		keyField, strings.Join(codes, ", "), indexErr)
+}
+
+func (m *MongoDB) ensureIndex(ctx context.Context, model mongo.IndexModel) error {
+	key := fmt.Sprint(model.Keys)
+	if _, created := m.indexes.Load(key); created {
+		return nil
+	}
+
+	if _, err := m.collection.Indexes().CreateOne(ctx, model); err != nil {
+		return err
+	}
+	m.indexes.Store(key, struct{}{})
+	return nil
+}
@@ -0,0 +1,300 @@
+package storage
+
+import "math"
+
+// EarthRadiusMeters is the radius used by MongoDB for the spherical geometry, so both storages report the same distances
+const EarthRadiusMeters = 6378100.0
+
+// NearQuery selects the records closest to a point; the Field should store the locations as [lon, lat] pairs
+type NearQuery struct {
+	Field  string
+	Filter map[string]interface{}
+	Lon    float64
+	Lat    float64
+	// MaxDistance is the maximum distance from the point, in meters
+	MaxDistance float64
+	Limit       int
+}
+
+// DistanceMeters returns the great-circle distance between two points, using the haversine formula
+func DistanceMeters(lon1, lat1, lon2, lat2 float64) float64 {
+	phi1, phi2 := radians(lat1), radians(lat2)
+	dPhi := phi2 - phi1
+	dLambda := radians(lon2 - lon1)
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// BBox is a box of longitudes and latitudes; if MinLon is greater than MaxLon, the box crosses the antimeridian
+type BBox struct {
+	MinLon float64
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+}
+
+// CrossesAntimeridian returns true if the box spans over the 180th meridian, ie. from 170 to -170 longitude
+func (b BBox) CrossesAntimeridian() bool {
+	return b.MinLon > b.MaxLon
+}
+
+// Split returns the box as boxes that don't cross the antimeridian
+func (b BBox) Split() []BBox {
+	if !b.CrossesAntimeridian() {
+		return []BBox{b}
+	}
+	return []BBox{
+		{MinLon: b.MinLon, MinLat: b.MinLat, MaxLon: 180, MaxLat: b.MaxLat},
+		{MinLon: -180, MinLat: b.MinLat, MaxLon: b.MaxLon, MaxLat: b.MaxLat},
+	}
+}
+
+// boxEdgeStep is the distance between the points added along the box edges, in degrees
+const boxEdgeStep = 1.0
+
+// maxBoxPart is the largest span of the box parts, in degrees, so that each part is smaller than a hemisphere
+const maxBoxPart = 90.0
+
+/*
+Polygons returns the box as polygons, that don't cross the antimeridian and are smaller than a hemisphere;
+the edges get a point every degree, so that their great-circle arcs follow the meridians and parallels
+*/
+func (b BBox) Polygons() []Polygon {
+	var polygons []Polygon
+	for _, part := range b.Split() {
+		for _, lons := range spans(part.MinLon, part.MaxLon) {
+			for _, lats := range spans(part.MinLat, part.MaxLat) {
+				polygons = append(polygons, boxPolygon(lons[0], lats[0], lons[1], lats[1]))
+			}
+		}
+	}
+	return polygons
+}
+
+// spans splits the range into equal spans, of up to maxBoxPart degrees
+func spans(min, max float64) [][2]float64 {
+	n := math.Max(1, math.Ceil((max-min)/maxBoxPart))
+	var parts [][2]float64
+	for i := 0.0; i < n; i++ {
+		parts = append(parts, [2]float64{min + (max-min)*i/n, min + (max-min)*(i+1)/n})
+	}
+	return parts
+}
+
+func boxPolygon(minLon, minLat, maxLon, maxLat float64) Polygon {
+	var ring [][2]float64
+	edge := func(fromLon, fromLat, toLon, toLat float64) {
+		// the edges along the poles collapse into a single point
+		if fromLat == toLat && math.Abs(fromLat) == 90 {
+			ring = append(ring, [2]float64{fromLon, fromLat})
+			return
+		}
+		steps := math.Max(1, math.Ceil(math.Max(math.Abs(toLon-fromLon), math.Abs(toLat-fromLat))/boxEdgeStep))
+		for i := 0.0; i < steps; i++ {
+			ring = append(ring, [2]float64{fromLon + (toLon-fromLon)*i/steps, fromLat + (toLat-fromLat)*i/steps})
+		}
+	}
+	edge(minLon, minLat, maxLon, minLat)
+	edge(maxLon, minLat, maxLon, maxLat)
+	edge(maxLon, maxLat, minLon, maxLat)
+	edge(minLon, maxLat, minLon, minLat)
+	return Polygon{append(ring, ring[0])}
+}
+
+// Polygon is a list of closed rings of [lon, lat] points, as in GeoJSON; the first ring is the exterior, and the rest are holes
+type Polygon [][][2]float64
+
+// Bounds returns the box of the exterior ring, with the great-circle arcs of its edges
+func (p Polygon) Bounds() BBox {
+	box := BBox{MinLon: 180, MinLat: 90, MaxLon: -180, MaxLat: -90}
+	if len(p) == 0 {
+		return box
+	}
+	ring := p[0]
+	for i, point := range ring {
+		box.MinLon = math.Min(box.MinLon, point[0])
+		box.MaxLon = math.Max(box.MaxLon, point[0])
+		box.MinLat = math.Min(box.MinLat, point[1])
+		box.MaxLat = math.Max(box.MaxLat, point[1])
+
+		if i == 0 {
+			continue
+		}
+		if math.Abs(point[0]-ring[i-1][0]) >= 180 {
+			box.MinLon, box.MaxLon = -180, 180
+		}
+		minLat, maxLat := arcLatitudes(ring[i-1], point)
+		box.MinLat = math.Min(box.MinLat, minLat)
+		box.MaxLat = math.Max(box.MaxLat, maxLat)
+	}
+
+	gnomonic := p.Gnomonic()
+	if gnomonic.Contains(0, 90) {
+		box.MinLon, box.MaxLat, box.MaxLon = -180, 90, 180
+	}
+	if gnomonic.Contains(0, -90) {
+		box.MinLon, box.MinLat, box.MaxLon = -180, -90, 180
+	}
+	return box
+}
+
+// arcLatitudes returns the lowest and the highest latitudes of the great-circle arc between the points
+func arcLatitudes(from, to [2]float64) (float64, float64) {
+	a, b := unitVector(from[0], from[1]), unitVector(to[0], to[1])
+	minLat, maxLat := math.Min(from[1], to[1]), math.Max(from[1], to[1])
+
+	normal := a.cross(b)
+	if normal.norm() == 0 {
+		return minLat, maxLat
+	}
+	for _, pole := range []vector{{0, 0, 1}, {0, 0, -1}} {
+		// the point of the great circle closest to the pole, that is an extreme if it is on the arc
+		extreme := pole.sub(normal.scale(pole.dot(normal) / normal.dot(normal)))
+		if extreme.norm() == 0 || a.cross(extreme).dot(normal) < 0 || extreme.cross(b).dot(normal) < 0 {
+			continue
+		}
+		lat := math.Asin(extreme.scale(1 / extreme.norm())[2]) * 180 / math.Pi
+		minLat, maxLat = math.Min(minLat, lat), math.Max(maxLat, lat)
+	}
+	return minLat, maxLat
+}
+
+// Contains checks if the point is inside the exterior ring, and outside of the holes, treating the edges as great-circle arcs
+func (p Polygon) Contains(lon, lat float64) bool {
+	return p.Gnomonic().Contains(lon, lat)
+}
+
+/*
+Gnomonic projects the polygon on the plane touching the sphere at the center of the exterior ring,
+where the great-circle arcs are straight lines, so the points can be checked with ray casting;
+as MongoDB does, the polygon should be smaller than a hemisphere.
+*/
+func (p Polygon) Gnomonic() GnomonicPolygon {
+	if len(p) == 0 {
+		return GnomonicPolygon{}
+	}
+
+	var center vector
+	for _, point := range p[0] {
+		center = center.add(unitVector(point[0], point[1]))
+	}
+	if center.norm() == 0 {
+		return GnomonicPolygon{}
+	}
+	g := GnomonicPolygon{center: center.scale(1 / center.norm())}
+
+	g.east = vector{0, 0, 1}.cross(g.center)
+	if g.east.norm() < 1e-9 {
+		g.east = vector{0, 1, 0}
+	}
+	g.east = g.east.scale(1 / g.east.norm())
+	g.north = g.center.cross(g.east)
+
+	for _, ring := range p {
+		projected := make([][2]float64, 0, len(ring))
+		for _, point := range ring {
+			x, y, ok := g.project(point[0], point[1])
+			if !ok {
+				return GnomonicPolygon{}
+			}
+			projected = append(projected, [2]float64{x, y})
+		}
+		g.rings = append(g.rings, projected)
+	}
+	return g
+}
+
+// GnomonicPolygon is a polygon projected by Polygon.Gnomonic
+type GnomonicPolygon struct {
+	center, east, north vector
+	rings               [][][2]float64
+}
+
+// Projected returns false if the polygon could not be projected, as it is not smaller than a hemisphere
+func (g GnomonicPolygon) Projected() bool {
+	return len(g.rings) > 0
+}
+
+func (g GnomonicPolygon) project(lon, lat float64) (float64, float64, bool) {
+	v := unitVector(lon, lat)
+	distance := v.dot(g.center)
+	if distance <= 1e-9 {
+		return 0, 0, false
+	}
+	return v.dot(g.east) / distance, v.dot(g.north) / distance, true
+}
+
+// Contains checks if the point is inside the exterior ring, and outside of the holes
+func (g GnomonicPolygon) Contains(lon, lat float64) bool {
+	if len(g.rings) == 0 {
+		return false
+	}
+	x, y, ok := g.project(lon, lat)
+	if !ok || !ringContains(g.rings[0], x, y) {
+		return false
+	}
+	for _, hole := range g.rings[1:] {
+		if ringContains(hole, x, y) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains uses ray casting, counting the ring edges crossed by a ray from the point
+func ringContains(ring [][2]float64, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > y) != (b[1] > y) && x < (b[0]-a[0])*(y-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// vector is a point of the unit sphere, in cartesian coordinates
+type vector [3]float64
+
+func unitVector(lon, lat float64) vector {
+	phi, lambda := radians(lat), radians(lon)
+	return vector{math.Cos(phi) * math.Cos(lambda), math.Cos(phi) * math.Sin(lambda), math.Sin(phi)}
+}
+
+func (v vector) add(w vector) vector {
+	return vector{v[0] + w[0], v[1] + w[1], v[2] + w[2]}
+}
+
+func (v vector) sub(w vector) vector {
+	return vector{v[0] - w[0], v[1] - w[1], v[2] - w[2]}
+}
+
+func (v vector) scale(k float64) vector {
+	return vector{v[0] * k, v[1] * k, v[2] * k}
+}
+
+func (v vector) dot(w vector) float64 {
+	return v[0]*w[0] + v[1]*w[1] + v[2]*w[2]
+}
+
+func (v vector) cross(w vector) vector {
+	return vector{v[1]*w[2] - v[2]*w[1], v[2]*w[0] - v[0]*w[2], v[0]*w[1] - v[1]*w[0]}
+}
+
+func (v vector) norm() float64 {
+	return math.Sqrt(v.dot(v))
+}
+
+// WithinQuery selects the records located inside the Box, or inside the Polygon, if there is no Box
+type WithinQuery struct {
+	Field   string
+	Filter  map[string]interface{}
+	Box     *BBox
+	Polygon Polygon
+	Limit   int
+}
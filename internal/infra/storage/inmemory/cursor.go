@@ -0,0 +1,76 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// streamPageSize is the number of records, that a cursor reads at a time
+const streamPageSize = 100
+
+// cursor walks the records of the storage, returned by InMemoryStorage.Stream, a page at a time
+type cursor struct {
+	storage *InMemoryStorage
+	// after is the last key checked by the cursor, so that the next page starts after it
+	after  string
+	filter map[string]interface{}
+	limit  int
+
+	page    []interface{}
+	done    bool
+	read    int
+	current interface{}
+	err     error
+}
+
+func (c *cursor) Next(ctx context.Context) bool {
+	if c.limit > 0 && c.read >= c.limit {
+		return false
+	}
+
+	for len(c.page) == 0 {
+		if c.done {
+			return false
+		}
+		if err := ctx.Err(); err != nil {
+			c.err = err
+			return false
+		}
+
+		var last string
+		c.page, last = c.storage.page(c.after, c.filter, streamPageSize)
+		if last == "" {
+			c.done = true
+		}
+		c.after = last
+	}
+
+	c.current = c.page[0]
+	c.page = c.page[1:]
+	c.read++
+	return true
+}
+
+func (c *cursor) Decode(result interface{}) error {
+	resultValue := reflect.ValueOf(result)
+	if resultValue.Kind() != reflect.Ptr {
+		return errors.New("result should be a pointer")
+	}
+	if c.current == nil {
+		return errors.New("the cursor has no current record")
+	}
+	resultValue.Elem().Set(reflect.ValueOf(c.current))
+	return nil
+}
+
+func (c *cursor) Err() error {
+	return c.err
+}
+
+func (c *cursor) Close(ctx context.Context) error {
+	c.page = nil
+	c.done = true
+	c.current = nil
+	return nil
+}
@@ -0,0 +1,213 @@
+package inmemory
+
+import (
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+toDocument converts a stored value into its bson representation, so that the filters
+can be evaluated against the same field names, that are used for MongoDB documents.
+Values that can't be represented as bson documents don't match any filter.
+*/
+func toDocument(value interface{}) bson.M {
+	data, err := bson.Marshal(value)
+	if err != nil {
+		return nil
+	}
+
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+	return doc
+}
+
+/*
+matches evaluates a MongoDB like filter against the document. The supported conditions are
+the field equality, that matches any element for array fields, and the `$eq`, `$ne`, `$in`,
+`$all`, `$gt`, `$gte`, `$lt`, `$lte` and `$exists` operators; all conditions should match.
+*/
+func matches(doc bson.M, filter map[string]interface{}) bool {
+	if doc == nil {
+		return len(filter) == 0
+	}
+
+	for field, condition := range filter {
+		value, exists := doc[field]
+		if !matchesCondition(value, exists, condition) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesCondition(value interface{}, exists bool, condition interface{}) bool {
+	operators, isOperators := asOperators(condition)
+	if !isOperators {
+		return exists && equalsAny(value, condition)
+	}
+
+	for operator, operand := range operators {
+		var ok bool
+		switch operator {
+		case "$eq":
+			ok = exists && equalsAny(value, operand)
+		case "$ne":
+			ok = !exists || !equalsAny(value, operand)
+		case "$in":
+			ok = false
+			for _, candidate := range asSlice(operand) {
+				if exists && equalsAny(value, candidate) {
+					ok = true
+					break
+				}
+			}
+		case "$all":
+			ok = exists
+			for _, candidate := range asSlice(operand) {
+				if !equalsAny(value, candidate) {
+					ok = false
+					break
+				}
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = exists && anyElement(value, func(element interface{}) bool {
+				cmp, comparable := compare(element, operand)
+				return comparable && compareOperator(operator, cmp)
+			})
+		case "$exists":
+			expected, _ := operand.(bool)
+			ok = exists == expected
+		default:
+			ok = false
+		}
+
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// asOperators returns the condition as a map of operators, if all its keys are operators, ie. `{"$gt": "AEAJM"}`
+func asOperators(condition interface{}) (map[string]interface{}, bool) {
+	var operators map[string]interface{}
+	switch typed := condition.(type) {
+	case bson.M:
+		operators = typed
+	case map[string]interface{}:
+		operators = typed
+	default:
+		return nil, false
+	}
+
+	for key := range operators {
+		if !strings.HasPrefix(key, "$") {
+			return nil, false
+		}
+	}
+	return operators, len(operators) > 0
+}
+
+// equalsAny checks the value equality, or if any of the elements are equal, for array values
+func equalsAny(value, expected interface{}) bool {
+	return anyElement(value, func(element interface{}) bool {
+		cmp, ok := compare(element, expected)
+		return ok && cmp == 0
+	})
+}
+
+// anyElement checks the predicate on the value itself, and on each of its elements, for array values
+func anyElement(value interface{}, predicate func(interface{}) bool) bool {
+	if predicate(value) {
+		return true
+	}
+
+	if !isSlice(value) {
+		return false
+	}
+	for _, element := range asSlice(value) {
+		if predicate(element) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare compares strings with strings and numbers with numbers; other values are only compared for equality
+func compare(a, b interface{}) (int, bool) {
+	if as, ok := a.(string); ok {
+		bs, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(as, bs), true
+	}
+
+	if af, ok := asFloat(a); ok {
+		bf, ok := asFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+	return 0, false
+}
+
+func compareOperator(operator string, cmp int) bool {
+	switch operator {
+	case "$gt":
+		return cmp > 0
+	case "$gte":
+		return cmp >= 0
+	case "$lt":
+		return cmp < 0
+	case "$lte":
+		return cmp <= 0
+	}
+	return false
+}
+
+func asFloat(value interface{}) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func isSlice(value interface{}) bool {
+	kind := reflect.ValueOf(value).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+func asSlice(value interface{}) []interface{} {
+	if !isSlice(value) {
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+	elements := make([]interface{}, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		elements = append(elements, rv.Index(i).Interface())
+	}
+	return elements
+}
@@ -0,0 +1,46 @@
+package inmemory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMatches(t *testing.T) {
+	type port struct {
+		PortCode string    `bson:"port_code"`
+		Country  string    `bson:"country"`
+		Regions  []string  `bson:"regions,omitempty"`
+		Coords   []float64 `bson:"coordinates"`
+	}
+	doc := toDocument(port{
+		PortCode: "AEJEA",
+		Country:  "United Arab Emirates",
+		Regions:  []string{"Middle East", "Asia"},
+		Coords:   []float64{55.02, 24.98},
+	})
+
+	for name, tc := range map[string]struct {
+		filter  bson.M
+		matches bool
+	}{
+		"empty filter":                {bson.M{}, true},
+		"equal field":                 {bson.M{"country": "United Arab Emirates"}, true},
+		"not equal field":             {bson.M{"country": "Fiji"}, false},
+		"array element":               {bson.M{"regions": "Asia"}, true},
+		"all array elements":          {bson.M{"regions": bson.M{"$all": []string{"Asia", "Middle East"}}}, true},
+		"missing array element":       {bson.M{"regions": bson.M{"$all": []string{"Asia", "Europe"}}}, false},
+		"in values":                   {bson.M{"port_code": bson.M{"$in": []string{"AEAJM", "AEJEA"}}}, true},
+		"greater than":                {bson.M{"port_code": bson.M{"$gt": "AEAJM"}}, true},
+		"not greater than":            {bson.M{"port_code": bson.M{"$gt": "AEJEA"}}, false},
+		"number comparison":           {bson.M{"coordinates": bson.M{"$gte": 55}}, true},
+		"missing field":               {bson.M{"deleted_at": bson.M{"$exists": false}}, true},
+		"existing field":              {bson.M{"country": bson.M{"$exists": false}}, false},
+		"all conditions should match": {bson.M{"country": "United Arab Emirates", "regions": "Europe"}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.matches, matches(doc, tc.filter))
+		})
+	}
+}
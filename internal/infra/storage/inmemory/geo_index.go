@@ -0,0 +1,210 @@
+package inmemory
+
+import (
+	"math"
+	"sort"
+
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// geoCellSize is the size of a grid cell, in degrees
+const geoCellSize = 1.0
+
+type geoCell struct {
+	lon, lat int
+}
+
+type geoPoint struct {
+	lon, lat float64
+}
+
+/*
+geoIndex is a grid spatial index over a field with [lon, lat] locations: each record is
+placed in the cell of its location, so that the spatial queries only check the records
+in the cells that overlap with the searched area, instead of scanning all the records.
+*/
+type geoIndex struct {
+	field  string
+	cells  map[geoCell]map[string]struct{}
+	points map[string]geoPoint
+}
+
+func newGeoIndex(field string) *geoIndex {
+	return &geoIndex{
+		field:  field,
+		cells:  make(map[geoCell]map[string]struct{}),
+		points: make(map[string]geoPoint),
+	}
+}
+
+func (gi *geoIndex) put(key string, doc bson.M) {
+	gi.remove(key)
+
+	point, ok := locationOf(doc[gi.field])
+	if !ok {
+		return
+	}
+
+	cell := cellOf(point.lon, point.lat)
+	if gi.cells[cell] == nil {
+		gi.cells[cell] = make(map[string]struct{})
+	}
+	gi.cells[cell][key] = struct{}{}
+	gi.points[key] = point
+}
+
+func (gi *geoIndex) remove(key string) {
+	point, found := gi.points[key]
+	if !found {
+		return
+	}
+
+	cell := cellOf(point.lon, point.lat)
+	delete(gi.cells[cell], key)
+	if len(gi.cells[cell]) == 0 {
+		delete(gi.cells, cell)
+	}
+	delete(gi.points, key)
+}
+
+type geoMatch struct {
+	key      string
+	distance float64
+}
+
+// near returns the records within maxDistance meters from the point, ordered by distance
+func (gi *geoIndex) near(lon, lat, maxDistance float64) []geoMatch {
+	var found []geoMatch
+	gi.scanCells(nearCells(lon, lat, maxDistance), func(key string, point geoPoint) {
+		distance := storage.DistanceMeters(lon, lat, point.lon, point.lat)
+		if maxDistance <= 0 || distance <= maxDistance {
+			found = append(found, geoMatch{key: key, distance: distance})
+		}
+	})
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].distance != found[j].distance {
+			return found[i].distance < found[j].distance
+		}
+		return found[i].key < found[j].key
+	})
+	return found
+}
+
+// within returns the keys of the records inside the box, or inside the polygon if there is no box, ordered by key
+func (gi *geoIndex) within(box *storage.BBox, polygon storage.Polygon) []string {
+	polygons := []storage.Polygon{polygon}
+	if box != nil {
+		polygons = box.Polygons()
+	}
+
+	matched := make(map[string]struct{})
+	for _, polygon := range polygons {
+		var ranges []cellRange
+		for _, part := range polygon.Bounds().Split() {
+			ranges = append(ranges, cellRange{
+				minLon: cellIndex(part.MinLon),
+				maxLon: cellIndex(math.Min(part.MaxLon, 180-geoCellSize/2)),
+				minLat: cellIndex(part.MinLat),
+				maxLat: cellIndex(part.MaxLat),
+			})
+		}
+
+		area := polygon.Gnomonic()
+		gi.scanCells(ranges, func(key string, point geoPoint) {
+			if area.Contains(point.lon, point.lat) {
+				matched[key] = struct{}{}
+			}
+		})
+	}
+
+	found := make([]string, 0, len(matched))
+	for key := range matched {
+		found = append(found, key)
+	}
+	sort.Strings(found)
+	return found
+}
+
+// cellRange is a range of grid cells, where the longitudes may wrap around the antimeridian
+type cellRange struct {
+	minLon, maxLon int
+	minLat, maxLat int
+	allLon         bool
+}
+
+func (gi *geoIndex) scanCells(ranges []cellRange, fn func(key string, point geoPoint)) {
+	for _, r := range ranges {
+		if r.allLon {
+			r.minLon, r.maxLon = cellIndex(-180), cellIndex(180-geoCellSize)
+		}
+
+		for lat := r.minLat; lat <= r.maxLat; lat++ {
+			for lon := r.minLon; lon <= r.maxLon; lon++ {
+				for key := range gi.cells[geoCell{lon: wrapCell(lon), lat: lat}] {
+					fn(key, gi.points[key])
+				}
+			}
+		}
+	}
+}
+
+// nearCells returns the cells of the bounding box of the circle, with the radius of maxDistance meters
+func nearCells(lon, lat, maxDistance float64) []cellRange {
+	if maxDistance <= 0 {
+		return []cellRange{{minLat: cellIndex(-90), maxLat: cellIndex(90), allLon: true}}
+	}
+
+	angular := maxDistance / storage.EarthRadiusMeters
+	dLat := angular * 180 / math.Pi
+	minLat, maxLat := lat-dLat, lat+dLat
+
+	// if a pole is within the circle, all the longitudes should be checked
+	if minLat <= -90 || maxLat >= 90 || angular >= math.Pi/2 {
+		return []cellRange{{
+			minLat: cellIndex(math.Max(minLat, -90)),
+			maxLat: cellIndex(math.Min(maxLat, 90)),
+			allLon: true,
+		}}
+	}
+
+	dLon := math.Asin(math.Min(1, math.Sin(angular)/math.Cos(lat*math.Pi/180))) * 180 / math.Pi
+	r := cellRange{
+		minLon: cellIndex(lon - dLon),
+		maxLon: cellIndex(lon + dLon),
+		minLat: cellIndex(minLat),
+		maxLat: cellIndex(maxLat),
+	}
+	r.allLon = r.maxLon-r.minLon+1 >= int(360/geoCellSize)
+	return []cellRange{r}
+}
+
+func locationOf(value interface{}) (geoPoint, bool) {
+	coordinates := asSlice(value)
+	if len(coordinates) != 2 {
+		return geoPoint{}, false
+	}
+
+	lon, lonOk := asFloat(coordinates[0])
+	lat, latOk := asFloat(coordinates[1])
+	if !lonOk || !latOk || lon < -180 || lon > 180 || lat < -90 || lat > 90 {
+		return geoPoint{}, false
+	}
+	return geoPoint{lon: lon, lat: lat}, true
+}
+
+func cellOf(lon, lat float64) geoCell {
+	return geoCell{lon: wrapCell(cellIndex(lon)), lat: cellIndex(lat)}
+}
+
+func cellIndex(degrees float64) int {
+	return int(math.Floor(degrees / geoCellSize))
+}
+
+// wrapCell brings a longitude cell index into the [-180, 180) degrees range
+func wrapCell(index int) int {
+	cells := int(360 / geoCellSize)
+	min := cellIndex(-180)
+	return ((index-min)%cells+cells)%cells + min
+}
@@ -0,0 +1,171 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
+	"github.com/stretchr/testify/require"
+)
+
+type location struct {
+	Code        string    `bson:"port_code"`
+	Coordinates []float64 `bson:"coordinates"`
+}
+
+func locationsStorage(t *testing.T) storage.Storage {
+	st := NewInMemoryStorage()
+	for _, loc := range []location{
+		{"AEDXB", []float64{55.27, 25.25}},
+		{"AEJEA", []float64{55.0272904, 24.9857145}},
+		{"AEAUH", []float64{54.37, 24.47}},
+		{"SGSIN", []float64{103.8198, 1.3521}},
+		{"FJSUV", []float64{178.4419, -18.1416}},
+		{"FJLTK", []float64{177.4167, -17.6167}},
+		{"TONUK", []float64{-175.2018, -21.1394}},
+		{"NOLYR", []float64{15.6356, 78.2232}},
+		{"ISREY", []float64{-21.9426, 64.1466}},
+		{"NOWHERE", nil},
+	} {
+		require.NoError(t, st.Insert(context.Background(), KeyValue{Key: loc.Code, Value: loc}))
+	}
+	return st
+}
+
+func nearCodes(t *testing.T, st storage.Storage, query storage.NearQuery) []string {
+	query.Field = "coordinates"
+
+	var found []location
+	require.NoError(t, st.Near(context.Background(), query, &found))
+
+	var codes []string
+	for _, loc := range found {
+		codes = append(codes, loc.Code)
+	}
+	return codes
+}
+
+func TestNear(t *testing.T) {
+	st := locationsStorage(t)
+
+	t.Run("return closest first within distance", func(t *testing.T) {
+		codes := nearCodes(t, st, storage.NearQuery{Lon: 55.27, Lat: 25.25, MaxDistance: 150_000})
+		require.Equal(t, []string{"AEDXB", "AEJEA", "AEAUH"}, codes)
+	})
+
+	t.Run("limit the number of results", func(t *testing.T) {
+		codes := nearCodes(t, st, storage.NearQuery{Lon: 55.27, Lat: 25.25, MaxDistance: 150_000, Limit: 2})
+		require.Equal(t, []string{"AEDXB", "AEJEA"}, codes)
+	})
+
+	t.Run("find across the antimeridian", func(t *testing.T) {
+		codes := nearCodes(t, st, storage.NearQuery{Lon: -179.5, Lat: -19, MaxDistance: 700_000})
+		require.Equal(t, []string{"FJSUV", "FJLTK", "TONUK"}, codes)
+	})
+
+	t.Run("find close to the poles", func(t *testing.T) {
+		codes := nearCodes(t, st, storage.NearQuery{Lon: -160, Lat: 89, MaxDistance: 1_500_000})
+		require.Equal(t, []string{"NOLYR"}, codes)
+	})
+
+	t.Run("keep index up to date on writes", func(t *testing.T) {
+		st := locationsStorage(t)
+		require.NoError(t, st.Update(context.Background(), "AEDXB", location{"AEDXB", []float64{103.8, 1.3}}))
+
+		codes := nearCodes(t, st, storage.NearQuery{Lon: 103.8198, Lat: 1.3521, MaxDistance: 50_000})
+		require.Equal(t, []string{"SGSIN", "AEDXB"}, codes)
+	})
+}
+
+func TestDistance(t *testing.T) {
+	// Dubai to Singapore is about 5840 km
+	require.InDelta(t, 5_840_000, storage.DistanceMeters(55.27, 25.25, 103.8198, 1.3521), 20_000)
+	require.InDelta(t, 0, storage.DistanceMeters(179.9, 0, -179.9, 0)-storage.DistanceMeters(-0.1, 0, 0.1, 0), 1)
+}
+
+func withinCodes(t *testing.T, st storage.Storage, query storage.WithinQuery) []string {
+	query.Field = "coordinates"
+
+	var found []location
+	require.NoError(t, st.Within(context.Background(), query, &found))
+
+	var codes []string
+	for _, loc := range found {
+		codes = append(codes, loc.Code)
+	}
+	return codes
+}
+
+func TestWithin(t *testing.T) {
+	st := locationsStorage(t)
+
+	t.Run("return ports inside box, ordered by code", func(t *testing.T) {
+		codes := withinCodes(t, st, storage.WithinQuery{Box: &storage.BBox{MinLon: 54, MinLat: 24, MaxLon: 56, MaxLat: 26}})
+		require.Equal(t, []string{"AEAUH", "AEDXB", "AEJEA"}, codes)
+	})
+
+	t.Run("limit the number of results", func(t *testing.T) {
+		codes := withinCodes(t, st, storage.WithinQuery{Box: &storage.BBox{MinLon: 54, MinLat: 24, MaxLon: 56, MaxLat: 26}, Limit: 2})
+		require.Equal(t, []string{"AEAUH", "AEDXB"}, codes)
+	})
+
+	t.Run("find inside box crossing the antimeridian", func(t *testing.T) {
+		codes := withinCodes(t, st, storage.WithinQuery{Box: &storage.BBox{MinLon: 178, MinLat: -22, MaxLon: -175, MaxLat: -17}})
+		require.Equal(t, []string{"FJSUV", "TONUK"}, codes)
+	})
+
+	t.Run("don't mistake antimeridian box for whole world box", func(t *testing.T) {
+		codes := withinCodes(t, st, storage.WithinQuery{Box: &storage.BBox{MinLon: 179, MinLat: -90, MaxLon: -179, MaxLat: 90}})
+		require.Empty(t, codes)
+	})
+
+	t.Run("find inside box reaching the edges of the map", func(t *testing.T) {
+		codes := withinCodes(t, st, storage.WithinQuery{Box: &storage.BBox{MinLon: 170, MinLat: -90, MaxLon: 180, MaxLat: 90}})
+		require.Equal(t, []string{"FJLTK", "FJSUV"}, codes)
+	})
+
+	t.Run("follow the parallels along box edges", func(t *testing.T) {
+		codes := withinCodes(t, st, storage.WithinQuery{Box: &storage.BBox{MinLon: -60, MinLat: 55, MaxLon: 60, MaxLat: 65}})
+		require.Equal(t, []string{"ISREY"}, codes)
+
+		// the great-circle arc between the corners reaches 73 degrees north, at the longitude of Reykjavik
+		codes = withinCodes(t, st, storage.WithinQuery{Box: &storage.BBox{MinLon: -60, MinLat: 55, MaxLon: 60, MaxLat: 64}})
+		require.Empty(t, codes)
+	})
+
+	t.Run("find inside box reaching the pole", func(t *testing.T) {
+		codes := withinCodes(t, st, storage.WithinQuery{Box: &storage.BBox{MinLon: 0, MinLat: 70, MaxLon: 30, MaxLat: 90}})
+		require.Equal(t, []string{"NOLYR"}, codes)
+	})
+
+	t.Run("find inside polygon", func(t *testing.T) {
+		// a triangle around Dubai and Jebel Ali, leaving Abu Dhabi out
+		codes := withinCodes(t, st, storage.WithinQuery{Polygon: storage.Polygon{
+			{{54.9, 24.9}, {55.4, 24.9}, {55.4, 25.4}, {54.9, 24.9}},
+		}})
+		require.Equal(t, []string{"AEDXB", "AEJEA"}, codes)
+	})
+
+	t.Run("skip ports inside polygon holes", func(t *testing.T) {
+		codes := withinCodes(t, st, storage.WithinQuery{Polygon: storage.Polygon{
+			{{54, 24}, {56, 24}, {56, 26}, {54, 26}, {54, 24}},
+			{{55.2, 25.2}, {55.3, 25.2}, {55.3, 25.3}, {55.2, 25.3}, {55.2, 25.2}},
+		}})
+		require.Equal(t, []string{"AEAUH", "AEJEA"}, codes)
+	})
+
+	t.Run("treat polygon edges as great-circle arcs", func(t *testing.T) {
+		// the edge along the 60th parallel bulges north, up to 73 degrees at the longitude of Reykjavik
+		codes := withinCodes(t, st, storage.WithinQuery{Polygon: storage.Polygon{
+			{{-60, 60}, {0, 40}, {60, 60}, {-60, 60}},
+		}})
+		require.Equal(t, []string{"ISREY"}, codes)
+	})
+
+	t.Run("find inside polygon crossing the antimeridian", func(t *testing.T) {
+		codes := withinCodes(t, st, storage.WithinQuery{Polygon: storage.Polygon{
+			{{177, -22}, {-171, -22}, {-171, -13}, {177, -13}, {177, -22}},
+		}})
+		require.Equal(t, []string{"FJLTK", "FJSUV", "TONUK"}, codes)
+	})
+}
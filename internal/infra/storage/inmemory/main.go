@@ -3,46 +3,128 @@ package inmemory
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 type InMemoryStorage struct {
 	store map[string]interface{}
-	mx    *sync.RWMutex
+	// docs are the bson representations of the stored values, used to evaluate filters
+	docs map[string]bson.M
+	mx   *sync.RWMutex
+
+	// geo are the spatial indexes by field, declared with WithGeoIndex, or created on the first spatial query on the field
+	geo map[string]*geoIndex
+	// text are the inverted indexes by fields and weights, declared with WithTextIndex, or created on the first search over the fields
+	text map[string]*textIndex
+	// prefix are the tries by fields, declared with WithPrefixIndex, or created on the first prefix search over the fields
+	prefix map[string]*prefixIndex
+
+	// keys are sorted lazily, on the first listing after a key is added or removed; the removed keys are dropped then, instead of on each delete
+	keys       []string
+	keysSorted bool
 }
 
-func NewInMemoryStorage() storage.Storage {
-	return &InMemoryStorage{
-		store: make(map[string]interface{}),
-		mx:    &sync.RWMutex{},
+// Option configures the in memory storage, created with NewInMemoryStorage
+type Option func(*InMemoryStorage)
+
+// WithGeoIndex creates the spatial index of the field along with the storage, so that it is kept up to date by every write
+func WithGeoIndex(field string) Option {
+	return func(im *InMemoryStorage) {
+		im.geoIndex(field)
 	}
 }
 
-func (im *InMemoryStorage) Find(ctx context.Context, filter map[string]interface{}, result interface{}) error {
-	key, keyFound := filter["port_code"]
-	if !keyFound {
-		return errors.New("no `port_code` key set to filter for in memory lookup")
+// WithTextIndex creates the inverted index of the fields along with the storage, so that it is kept up to date by every write
+func WithTextIndex(weights map[string]int) Option {
+	return func(im *InMemoryStorage) {
+		im.textIndex(weights)
 	}
+}
 
-	im.mx.Lock()
-	res, found := im.store[key.(string)]
-	im.mx.Unlock()
+/*
+WithPrefixIndex creates the trie of the fields along with the storage, so that it is kept up to
+date by every write, and the first prefix search after a bulk import doesn't build it under the lock.
+*/
+func WithPrefixIndex(fields ...string) Option {
+	return func(im *InMemoryStorage) {
+		im.prefixIndex(fields)
+	}
+}
 
-	if !found {
-		return storage.ErrNotFound
+func NewInMemoryStorage(opts ...Option) storage.Storage {
+	im := &InMemoryStorage{
+		store:      make(map[string]interface{}),
+		docs:       make(map[string]bson.M),
+		geo:        make(map[string]*geoIndex),
+		text:       make(map[string]*textIndex),
+		prefix:     make(map[string]*prefixIndex),
+		mx:         &sync.RWMutex{},
+		keysSorted: true,
+	}
+	for _, opt := range opts {
+		opt(im)
 	}
+	return im
+}
+
+/*
+Find returns the first record, in key order, that matches the filter. A `port_code` equality
+is looked up directly by key, while the rest of the filters are evaluated on each record.
+*/
+func (im *InMemoryStorage) Find(ctx context.Context, filter map[string]interface{}, result interface{}) error {
 	resultValue := reflect.ValueOf(result)
 	if resultValue.Kind() != reflect.Ptr {
 		return errors.New("result should be a pointer")
 	}
+
+	if _, isKey := filter["port_code"].(string); isKey {
+		im.mx.RLock()
+	} else {
+		im.rlock(im.keysReady, im.sortKeys)
+	}
+	res, found := im.findMatch(filter)
+	im.mx.RUnlock()
+
+	if !found {
+		return storage.ErrNotFound
+	}
 	resultValue.Elem().Set(reflect.ValueOf(res))
 
 	return nil
 }
 
+// findMatch should be called holding the read lock, with the keys sorted, unless the filter has a `port_code` equality
+func (im *InMemoryStorage) findMatch(filter map[string]interface{}) (interface{}, bool) {
+	if key, isKey := filter["port_code"].(string); isKey {
+		res, found := im.store[key]
+		if !found {
+			return nil, false
+		}
+
+		rest := make(map[string]interface{}, len(filter)-1)
+		for field, condition := range filter {
+			if field != "port_code" {
+				rest[field] = condition
+			}
+		}
+		return res, matches(im.docs[key], rest)
+	}
+
+	for _, key := range im.sortedKeys() {
+		if matches(im.docs[key], filter) {
+			return im.store[key], true
+		}
+	}
+	return nil, false
+}
+
 type KeyValue struct {
 	Key   string
 	Value interface{}
@@ -57,11 +139,29 @@ func (im *InMemoryStorage) Insert(ctx context.Context, obj interface{}) error {
 	im.mx.Lock()
 	defer im.mx.Unlock()
 
-	im.store[insertable.Key] = insertable.Value
+	im.put(insertable.Key, insertable.Value)
+
+	return nil
+}
+
+func (im *InMemoryStorage) Upsert(ctx context.Context, id interface{}, obj interface{}) error {
+	key, isString := id.(string)
+	if !isString {
+		return errors.New("the key given to store is not a `string`")
+	}
+
+	im.mx.Lock()
+	defer im.mx.Unlock()
+
+	im.put(key, obj)
 
 	return nil
 }
 
+// UpdateFunc is an update, that changes a record by its current value; the returned value is stored, unless an error is returned
+type UpdateFunc func(current interface{}) (interface{}, error)
+
+// Update stores obj as the record, or, if obj is an UpdateFunc, the value it returns, both under the same lock as the lookup
 func (im *InMemoryStorage) Update(ctx context.Context, id interface{}, obj interface{}) error {
 	key, isString := id.(string)
 	if !isString {
@@ -71,7 +171,401 @@ func (im *InMemoryStorage) Update(ctx context.Context, id interface{}, obj inter
 	im.mx.Lock()
 	defer im.mx.Unlock()
 
-	im.store[key] = obj
+	current, found := im.store[key]
+	if !found {
+		return storage.ErrNotFound
+	}
+	if update, isFunc := obj.(UpdateFunc); isFunc {
+		var err error
+		if obj, err = update(current); err != nil {
+			return err
+		}
+	}
+	im.put(key, obj)
+
+	return nil
+}
+
+func (im *InMemoryStorage) Delete(ctx context.Context, id interface{}) error {
+	key, isString := id.(string)
+	if !isString {
+		return errors.New("the key given to delete is not a `string`")
+	}
+
+	im.mx.Lock()
+	defer im.mx.Unlock()
+
+	if _, found := im.store[key]; !found {
+		return storage.ErrNotFound
+	}
+	im.remove(key)
+
+	return nil
+}
+
+// BulkUpsert writes all the records under a single lock; records, that are equal to the stored ones, are reported as unchanged
+func (im *InMemoryStorage) BulkUpsert(ctx context.Context, records []storage.UpsertRecord) (storage.BulkUpsertResult, error) {
+	var result storage.BulkUpsertResult
+
+	im.mx.Lock()
+	defer im.mx.Unlock()
+
+	for i, record := range records {
+		key, isString := record.ID.(string)
+		if !isString {
+			result.Failures = append(result.Failures, storage.BulkFailure{
+				Index: i,
+				Err:   errors.New("the key given to store is not a `string`"),
+			})
+			continue
+		}
+
+		existing, found := im.store[key]
+		switch {
+		case !found:
+			result.Created++
+		case reflect.DeepEqual(existing, record.Obj):
+			result.Unchanged++
+		default:
+			result.Updated++
+		}
+
+		im.put(key, record.Obj)
+	}
+
+	return result, nil
+}
+
+/*
+List returns the records, that match the filter, ordered by their key, starting after the
+opts.After key; the in memory storage always orders by key, so opts.SortField is not used.
+*/
+func (im *InMemoryStorage) List(ctx context.Context, opts storage.ListOptions, results interface{}) error {
+	resultsValue := reflect.ValueOf(results)
+	if resultsValue.Kind() != reflect.Ptr || resultsValue.Elem().Kind() != reflect.Slice {
+		return errors.New("results should be a pointer to a slice")
+	}
+
+	im.rlock(im.keysReady, im.sortKeys)
+	defer im.mx.RUnlock()
+
+	keys := im.sortedKeys()
+	start := 0
+	if opts.After != "" {
+		start = sort.SearchStrings(keys, opts.After)
+		if start < len(keys) && keys[start] == opts.After {
+			start++
+		}
+	}
+
+	page := reflect.MakeSlice(resultsValue.Elem().Type(), 0, opts.Limit)
+	for _, key := range keys[start:] {
+		if opts.Limit > 0 && page.Len() >= opts.Limit {
+			break
+		}
+		if !matches(im.docs[key], opts.Filter) {
+			continue
+		}
+		page = reflect.Append(page, reflect.ValueOf(im.store[key]))
+	}
+	resultsValue.Elem().Set(page)
+
+	return nil
+}
+
+/*
+Stream returns a cursor, that reads the records in key order, a page at a time, each page after the
+last key of the previous one, so the memory used by the cursor doesn't depend on the storage size.
+A page is read under the read lock when the cursor reaches its end, so the records written before
+that are included, and the records removed before that are skipped.
+*/
+func (im *InMemoryStorage) Stream(ctx context.Context, opts storage.ListOptions) (storage.Cursor, error) {
+	return &cursor{
+		storage: im,
+		after:   opts.After,
+		filter:  opts.Filter,
+		limit:   opts.Limit,
+	}, nil
+}
+
+/*
+page returns up to limit records, that match the filter, with the keys after the after key, and
+the last key it has checked; the last key is empty if there are no more keys. The keys are sorted
+under the write lock first, if they need to, so that the page itself is read under the read lock.
+*/
+func (im *InMemoryStorage) page(after string, filter map[string]interface{}, limit int) ([]interface{}, string) {
+	im.rlock(im.keysReady, im.sortKeys)
+	defer im.mx.RUnlock()
+
+	keys := im.keys
+	start := 0
+	if after != "" {
+		start = sort.SearchStrings(keys, after)
+		if start < len(keys) && keys[start] == after {
+			start++
+		}
+	}
+
+	var values []interface{}
+	last := ""
+	for _, key := range keys[start:] {
+		if len(values) >= limit {
+			break
+		}
+		last = key
+		if matches(im.docs[key], filter) {
+			values = append(values, im.store[key])
+		}
+	}
+	return values, last
+}
+
+// Near returns the records within query.MaxDistance meters from the point, closest first, using the spatial index of the field
+func (im *InMemoryStorage) Near(ctx context.Context, query storage.NearQuery, results interface{}) error {
+	resultsValue := reflect.ValueOf(results)
+	if resultsValue.Kind() != reflect.Ptr || resultsValue.Elem().Kind() != reflect.Slice {
+		return errors.New("results should be a pointer to a slice")
+	}
+
+	im.rlock(im.geoReady(query.Field), func() { im.geoIndex(query.Field) })
+	defer im.mx.RUnlock()
+
+	found := reflect.MakeSlice(resultsValue.Elem().Type(), 0, query.Limit)
+	for _, match := range im.geo[query.Field].near(query.Lon, query.Lat, query.MaxDistance) {
+		if query.Limit > 0 && found.Len() >= query.Limit {
+			break
+		}
+		if !matches(im.docs[match.key], query.Filter) {
+			continue
+		}
+		found = reflect.Append(found, reflect.ValueOf(im.store[match.key]))
+	}
+	resultsValue.Elem().Set(found)
 
 	return nil
 }
+
+// Within returns the records inside the query box or polygon, ordered by key, using the spatial index of the field
+func (im *InMemoryStorage) Within(ctx context.Context, query storage.WithinQuery, results interface{}) error {
+	resultsValue := reflect.ValueOf(results)
+	if resultsValue.Kind() != reflect.Ptr || resultsValue.Elem().Kind() != reflect.Slice {
+		return errors.New("results should be a pointer to a slice")
+	}
+
+	im.rlock(im.geoReady(query.Field), func() { im.geoIndex(query.Field) })
+	defer im.mx.RUnlock()
+
+	found := reflect.MakeSlice(resultsValue.Elem().Type(), 0, query.Limit)
+	for _, key := range im.geo[query.Field].within(query.Box, query.Polygon) {
+		if query.Limit > 0 && found.Len() >= query.Limit {
+			break
+		}
+		if !matches(im.docs[key], query.Filter) {
+			continue
+		}
+		found = reflect.Append(found, reflect.ValueOf(im.store[key]))
+	}
+	resultsValue.Elem().Set(found)
+
+	return nil
+}
+
+// Search returns the records, that contain the words of the query text, most relevant first, using the inverted index of the fields
+func (im *InMemoryStorage) Search(ctx context.Context, query storage.SearchQuery, results interface{}) error {
+	resultsValue := reflect.ValueOf(results)
+	if resultsValue.Kind() != reflect.Ptr || resultsValue.Elem().Kind() != reflect.Slice {
+		return errors.New("results should be a pointer to a slice")
+	}
+
+	name := textIndexName(query.Fields)
+	im.rlock(func() bool { return im.text[name] != nil }, func() { im.textIndex(query.Fields) })
+	defer im.mx.RUnlock()
+
+	found := reflect.MakeSlice(resultsValue.Elem().Type(), 0, query.Limit)
+	for _, match := range im.text[name].search(query.Text) {
+		if query.Limit > 0 && found.Len() >= query.Limit {
+			break
+		}
+		if !matches(im.docs[match.key], query.Filter) {
+			continue
+		}
+		found = reflect.Append(found, reflect.ValueOf(im.store[match.key]))
+	}
+	resultsValue.Elem().Set(found)
+
+	return nil
+}
+
+// SearchPrefix returns the records with a value of the fields starting with the prefix, ordered by the value, using the trie of the fields
+func (im *InMemoryStorage) SearchPrefix(ctx context.Context, query storage.PrefixQuery, results interface{}) error {
+	resultsValue := reflect.ValueOf(results)
+	if resultsValue.Kind() != reflect.Ptr || resultsValue.Elem().Kind() != reflect.Slice {
+		return errors.New("results should be a pointer to a slice")
+	}
+
+	name := strings.Join(query.Fields, ",")
+	im.rlock(func() bool { return im.prefix[name] != nil }, func() { im.prefixIndex(query.Fields) })
+	defer im.mx.RUnlock()
+
+	keys := im.prefix[name].lookup(query.Prefix, query.Limit, func(key string) bool {
+		return matches(im.docs[key], query.Filter)
+	})
+
+	found := reflect.MakeSlice(resultsValue.Elem().Type(), 0, len(keys))
+	for _, key := range keys {
+		found = reflect.Append(found, reflect.ValueOf(im.store[key]))
+	}
+	resultsValue.Elem().Set(found)
+
+	return nil
+}
+
+// put stores the value by key; it should be called holding the write lock
+func (im *InMemoryStorage) put(key string, value interface{}) {
+	if _, found := im.store[key]; !found {
+		im.keys = append(im.keys, key)
+		im.keysSorted = false
+	}
+	im.store[key] = value
+	im.docs[key] = toDocument(value)
+
+	for _, index := range im.geo {
+		index.put(key, im.docs[key])
+	}
+	for _, index := range im.text {
+		index.put(key, im.docs[key])
+	}
+	for _, index := range im.prefix {
+		index.put(key, im.docs[key])
+	}
+}
+
+// remove deletes the value by key, along with its entries in the indexes; it should be called holding the write lock
+func (im *InMemoryStorage) remove(key string) {
+	delete(im.store, key)
+	delete(im.docs, key)
+	im.keysSorted = false
+
+	for _, index := range im.geo {
+		index.remove(key)
+	}
+	for _, index := range im.text {
+		index.remove(key)
+	}
+	for _, index := range im.prefix {
+		index.remove(key)
+	}
+}
+
+/*
+rlock takes the read lock, once the storage is ready for a read: if it is not, ie. the keys are not
+sorted, or an index is not built yet, prepare is called under the write lock first. A write can
+undo it before the read lock is taken, so the check is repeated under the read lock.
+*/
+func (im *InMemoryStorage) rlock(ready func() bool, prepare func()) {
+	im.mx.RLock()
+	for !ready() {
+		im.mx.RUnlock()
+		im.mx.Lock()
+		prepare()
+		im.mx.Unlock()
+		im.mx.RLock()
+	}
+}
+
+func (im *InMemoryStorage) keysReady() bool {
+	return im.keysSorted
+}
+
+func (im *InMemoryStorage) sortKeys() {
+	im.sortedKeys()
+}
+
+func (im *InMemoryStorage) geoReady(field string) func() bool {
+	return func() bool {
+		_, found := im.geo[field]
+		return found
+	}
+}
+
+// geoIndex returns the spatial index of the field, building it on first use; it should be called holding the write lock
+func (im *InMemoryStorage) geoIndex(field string) *geoIndex {
+	index, found := im.geo[field]
+	if found {
+		return index
+	}
+
+	index = newGeoIndex(field)
+	for key, doc := range im.docs {
+		index.put(key, doc)
+	}
+	im.geo[field] = index
+	return index
+}
+
+// textIndex returns the inverted index of the fields, building it on first use; it should be called holding the write lock
+func (im *InMemoryStorage) textIndex(weights map[string]int) *textIndex {
+	name := textIndexName(weights)
+	index, found := im.text[name]
+	if found {
+		return index
+	}
+
+	index = newTextIndex(weights)
+	for key, doc := range im.docs {
+		index.put(key, doc)
+	}
+	im.text[name] = index
+	return index
+}
+
+// textIndexName identifies the inverted index by its fields and weights
+func textIndexName(weights map[string]int) string {
+	fields := make([]string, 0, len(weights))
+	for field, weight := range weights {
+		fields = append(fields, fmt.Sprintf("%s:%d", field, weight))
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ",")
+}
+
+// prefixIndex returns the trie of the fields, building it on first use, if it was not declared with WithPrefixIndex; it should be called holding the write lock
+func (im *InMemoryStorage) prefixIndex(fields []string) *prefixIndex {
+	name := strings.Join(fields, ",")
+
+	index, found := im.prefix[name]
+	if found {
+		return index
+	}
+
+	index = newPrefixIndex(fields)
+	for key, doc := range im.docs {
+		index.put(key, doc)
+	}
+	im.prefix[name] = index
+	return index
+}
+
+/*
+sortedKeys returns all the keys in ascending order, dropping the removed keys, and the duplicates of
+the keys added again after being removed; it should be called holding the write lock, or the read
+lock once the keys are sorted.
+*/
+func (im *InMemoryStorage) sortedKeys() []string {
+	if !im.keysSorted {
+		sort.Strings(im.keys)
+		compacted := im.keys[:0]
+		for _, key := range im.keys {
+			if _, found := im.store[key]; !found {
+				continue
+			}
+			if n := len(compacted); n > 0 && compacted[n-1] == key {
+				continue
+			}
+			compacted = append(compacted, key)
+		}
+		im.keys = compacted
+		im.keysSorted = true
+	}
+	return im.keys
+}
@@ -0,0 +1,238 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	st := NewInMemoryStorage()
+	ctx := context.Background()
+
+	for _, key := range []string{"C", "A", "D", "B"} {
+		require.NoError(t, st.Insert(ctx, KeyValue{Key: key, Value: key}))
+	}
+
+	var page []string
+	require.NoError(t, st.List(ctx, storage.ListOptions{Limit: 3}, &page))
+	require.Equal(t, []string{"A", "B", "C"}, page)
+
+	require.NoError(t, st.List(ctx, storage.ListOptions{After: "C", Limit: 3}, &page))
+	require.Equal(t, []string{"D"}, page)
+
+	require.NoError(t, st.Insert(ctx, KeyValue{Key: "BB", Value: "BB"}))
+	require.NoError(t, st.List(ctx, storage.ListOptions{After: "B"}, &page))
+	require.Equal(t, []string{"BB", "C", "D"}, page)
+
+	require.NoError(t, st.Delete(ctx, "B"))
+	require.NoError(t, st.Insert(ctx, KeyValue{Key: "AA", Value: "AA"}))
+	require.NoError(t, st.Delete(ctx, "C"))
+	require.NoError(t, st.List(ctx, storage.ListOptions{}, &page))
+	require.Equal(t, []string{"A", "AA", "BB", "D"}, page)
+
+	// removed keys are dropped on the next listing, even if they were added again in between
+	require.NoError(t, st.Delete(ctx, "A"))
+	require.NoError(t, st.Insert(ctx, KeyValue{Key: "A", Value: "A"}))
+	require.NoError(t, st.Delete(ctx, "D"))
+	require.Len(t, st.(*InMemoryStorage).keys, 5)
+	require.NoError(t, st.List(ctx, storage.ListOptions{}, &page))
+	require.Equal(t, []string{"A", "AA", "BB"}, page)
+	require.Len(t, st.(*InMemoryStorage).keys, 3)
+}
+
+func TestStream(t *testing.T) {
+	st := NewInMemoryStorage()
+	ctx := context.Background()
+
+	for _, key := range []string{"C", "A", "E", "D", "B"} {
+		require.NoError(t, st.Insert(ctx, KeyValue{Key: key, Value: key}))
+	}
+
+	cursor, err := st.Stream(ctx, storage.ListOptions{After: "A", Limit: 3})
+	require.NoError(t, err)
+	defer cursor.Close(ctx)
+
+	require.NoError(t, st.Delete(ctx, "C"))
+
+	var values []string
+	for cursor.Next(ctx) {
+		var value string
+		require.NoError(t, cursor.Decode(&value))
+		values = append(values, value)
+	}
+	require.NoError(t, cursor.Err())
+	require.Equal(t, []string{"B", "D", "E"}, values)
+}
+
+func TestStreamPages(t *testing.T) {
+	st := NewInMemoryStorage()
+	ctx := context.Background()
+
+	var want []string
+	for i := 0; i < 2*streamPageSize+5; i++ {
+		key := fmt.Sprintf("K%04d", i)
+		require.NoError(t, st.Insert(ctx, KeyValue{Key: key, Value: key}))
+		want = append(want, key)
+	}
+
+	cursor, err := st.Stream(ctx, storage.ListOptions{})
+	require.NoError(t, err)
+	defer cursor.Close(ctx)
+
+	var values []string
+	for cursor.Next(ctx) {
+		var value string
+		require.NoError(t, cursor.Decode(&value))
+		values = append(values, value)
+
+		// the writes past the current page are seen by the next pages
+		if len(values) == 1 {
+			require.NoError(t, st.Delete(ctx, want[streamPageSize+1]))
+			require.NoError(t, st.Insert(ctx, KeyValue{Key: "K9999", Value: "K9999"}))
+		}
+	}
+	require.NoError(t, cursor.Err())
+
+	want = append(append(want[:streamPageSize+1], want[streamPageSize+2:]...), "K9999")
+	require.Equal(t, want, values)
+}
+
+func TestBulkUpsert(t *testing.T) {
+	st := NewInMemoryStorage()
+	ctx := context.Background()
+
+	require.NoError(t, st.Insert(ctx, KeyValue{Key: "updated", Value: "old"}))
+	require.NoError(t, st.Insert(ctx, KeyValue{Key: "unchanged", Value: "same"}))
+
+	result, err := st.BulkUpsert(ctx, []storage.UpsertRecord{
+		{ID: "created", Obj: "new"},
+		{ID: "updated", Obj: "new"},
+		{ID: "unchanged", Obj: "same"},
+		{ID: 42, Obj: "not a string key"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Created)
+	require.Equal(t, 1, result.Updated)
+	require.Equal(t, 1, result.Unchanged)
+	require.Len(t, result.Failures, 1)
+	require.Equal(t, 3, result.Failures[0].Index)
+
+	var value string
+	require.NoError(t, st.Find(ctx, map[string]interface{}{"port_code": "updated"}, &value))
+	require.Equal(t, "new", value)
+}
+
+func TestUpdate(t *testing.T) {
+	st := NewInMemoryStorage()
+	ctx := context.Background()
+	require.NoError(t, st.Insert(ctx, KeyValue{Key: "A", Value: 1}))
+
+	increment := UpdateFunc(func(current interface{}) (interface{}, error) {
+		return current.(int) + 1, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, st.Update(ctx, "A", increment))
+		}()
+	}
+	wg.Wait()
+
+	var value int
+	require.NoError(t, st.Find(ctx, map[string]interface{}{"port_code": "A"}, &value))
+	require.Equal(t, 101, value)
+
+	failed := errors.New("failed")
+	require.ErrorIs(t, st.Update(ctx, "A", UpdateFunc(func(interface{}) (interface{}, error) { return nil, failed })), failed)
+	require.NoError(t, st.Find(ctx, map[string]interface{}{"port_code": "A"}, &value))
+	require.Equal(t, 101, value)
+
+	require.ErrorIs(t, st.Update(ctx, "B", increment), storage.ErrNotFound)
+}
+
+func TestDelete(t *testing.T) {
+	st := locationsStorage(t)
+	ctx := context.Background()
+
+	near := storage.NearQuery{Lon: 55.27, Lat: 25.25, MaxDistance: 150_000}
+	require.Equal(t, []string{"AEDXB", "AEJEA", "AEAUH"}, nearCodes(t, st, near))
+
+	require.NoError(t, st.Delete(ctx, "AEDXB"))
+	require.ErrorIs(t, st.Delete(ctx, "AEDXB"), storage.ErrNotFound)
+
+	var loc location
+	require.ErrorIs(t, st.Find(ctx, map[string]interface{}{"port_code": "AEDXB"}, &loc), storage.ErrNotFound)
+	require.Equal(t, []string{"AEJEA", "AEAUH"}, nearCodes(t, st, near))
+
+	var page []location
+	require.NoError(t, st.List(ctx, storage.ListOptions{Limit: 2}, &page))
+	require.Equal(t, "AEAUH", page[0].Code)
+	require.Equal(t, "AEJEA", page[1].Code)
+
+	require.ErrorIs(t, st.Update(ctx, "AEDXB", location{"AEDXB", nil}), storage.ErrNotFound)
+}
+
+// concurrentReads runs the reads while another reader holds the read lock, and fails if they wait for it
+func concurrentReads(t *testing.T, st *InMemoryStorage, reads ...func() error) {
+	st.mx.RLock()
+	defer st.mx.RUnlock()
+
+	done := make(chan error, 1)
+	go func() {
+		for _, read := range reads {
+			if err := read(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the reads wait for the other readers")
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	ctx := context.Background()
+	weights := map[string]int{"port_code": 1}
+	st := NewInMemoryStorage(WithGeoIndex("coordinates"), WithTextIndex(weights), WithPrefixIndex("port_code")).(*InMemoryStorage)
+	require.NoError(t, st.Insert(ctx, KeyValue{Key: "AEDXB", Value: location{"AEDXB", []float64{55.27, 25.25}}}))
+	require.NoError(t, st.Insert(ctx, KeyValue{Key: "AEAUH", Value: location{"AEAUH", []float64{54.37, 24.47}}}))
+	// sort the keys, which is done once under the write lock
+	var found []location
+	require.NoError(t, st.List(ctx, storage.ListOptions{}, &found))
+
+	concurrentReads(t, st,
+		func() error {
+			var found location
+			return st.Find(ctx, map[string]interface{}{"port_code": "AEDXB"}, &found)
+		},
+		func() error { return st.List(ctx, storage.ListOptions{}, &found) },
+		func() error {
+			return st.Near(ctx, storage.NearQuery{Field: "coordinates", Lon: 55.27, Lat: 25.25}, &found)
+		},
+		func() error {
+			box := &storage.BBox{MinLon: 54, MinLat: 24, MaxLon: 56, MaxLat: 26}
+			return st.Within(ctx, storage.WithinQuery{Field: "coordinates", Box: box}, &found)
+		},
+		func() error {
+			return st.Search(ctx, storage.SearchQuery{Fields: weights, Text: "aedxb"}, &found)
+		},
+		func() error {
+			return st.SearchPrefix(ctx, storage.PrefixQuery{Fields: []string{"port_code"}, Prefix: "AE"}, &found)
+		},
+	)
+}
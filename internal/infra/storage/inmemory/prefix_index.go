@@ -0,0 +1,124 @@
+package inmemory
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+prefixIndex is a trie of the folded values of the indexed fields, that finds the records
+with a value starting with a prefix, by walking the prefix and then the subtree below it,
+so the lookup time depends on the prefix and the number of results, not on the records.
+*/
+type prefixIndex struct {
+	fields []string
+	root   *trieNode
+	// values maps each record to its indexed values, to remove them when the record changes
+	values map[string][]string
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	// keys are the records with a value ending at this node
+	keys map[string]struct{}
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{children: make(map[rune]*trieNode), keys: make(map[string]struct{})}
+}
+
+func newPrefixIndex(fields []string) *prefixIndex {
+	return &prefixIndex{fields: fields, root: newTrieNode(), values: make(map[string][]string)}
+}
+
+func (pi *prefixIndex) put(key string, doc bson.M) {
+	pi.remove(key)
+
+	seen := make(map[string]bool)
+	for _, field := range pi.fields {
+		for _, text := range textValues(doc[field]) {
+			value := fold(text)
+			if value == "" || seen[value] {
+				continue
+			}
+			seen[value] = true
+
+			node := pi.root
+			for _, r := range value {
+				child, found := node.children[r]
+				if !found {
+					child = newTrieNode()
+					node.children[r] = child
+				}
+				node = child
+			}
+			node.keys[key] = struct{}{}
+			pi.values[key] = append(pi.values[key], value)
+		}
+	}
+}
+
+func (pi *prefixIndex) remove(key string) {
+	for _, value := range pi.values[key] {
+		removeFromTrie(pi.root, []rune(value), key)
+	}
+	delete(pi.values, key)
+}
+
+// removeFromTrie removes the key from the node of the value, and prunes the nodes that are left empty
+func removeFromTrie(node *trieNode, value []rune, key string) bool {
+	if len(value) == 0 {
+		delete(node.keys, key)
+	} else if child, found := node.children[value[0]]; found && removeFromTrie(child, value[1:], key) {
+		delete(node.children, value[0])
+	}
+	return len(node.keys) == 0 && len(node.children) == 0
+}
+
+// lookup returns up to limit records, with a value starting with the prefix, ordered by the value, so exact matches come first
+func (pi *prefixIndex) lookup(prefix string, limit int, accept func(key string) bool) []string {
+	node := pi.root
+	for _, r := range fold(prefix) {
+		node = node.children[r]
+		if node == nil {
+			return nil
+		}
+	}
+
+	var found []string
+	seen := make(map[string]bool)
+	var walk func(node *trieNode) bool
+	walk = func(node *trieNode) bool {
+		keys := make([]string, 0, len(node.keys))
+		for key := range node.keys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if seen[key] || !accept(key) {
+				continue
+			}
+			seen[key] = true
+			found = append(found, key)
+			if limit > 0 && len(found) >= limit {
+				return false
+			}
+		}
+
+		runes := make([]rune, 0, len(node.children))
+		for r := range node.children {
+			runes = append(runes, r)
+		}
+		sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+		for _, r := range runes {
+			if !walk(node.children[r]) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(node)
+
+	return found
+}
@@ -0,0 +1,88 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func prefixCodes(t testing.TB, st storage.Storage, prefix string, limit int) []string {
+	var found []place
+	require.NoError(t, st.SearchPrefix(context.Background(), storage.PrefixQuery{
+		Fields: []string{"port_code", "name", "alias"},
+		Prefix: prefix,
+		Limit:  limit,
+	}, &found))
+
+	var codes []string
+	for _, p := range found {
+		codes = append(codes, p.Code)
+	}
+	return codes
+}
+
+func TestSearchPrefix(t *testing.T) {
+	st := NewInMemoryStorage()
+	for _, p := range []place{
+		{"AEAUH", "Abu Dhabi", nil, ""},
+		{"AEJEA", "Jebel Ali", []string{"Mina Jebel Ali"}, ""},
+		{"AEDXB", "Dubai", nil, ""},
+		{"USLAX", "Los Angeles", []string{"LA"}, ""},
+		{"FJLTK", "Lautoka", nil, ""},
+		{"ESALG", "Algeciras", nil, ""},
+	} {
+		require.NoError(t, st.Insert(context.Background(), KeyValue{Key: p.Code, Value: p}))
+	}
+
+	t.Run("match codes, names and aliases, ordered by value", func(t *testing.T) {
+		require.Equal(t, []string{"AEAUH", "AEDXB", "AEJEA"}, prefixCodes(t, st, "ae", 0))
+		require.Equal(t, []string{"AEJEA"}, prefixCodes(t, st, "Mina J", 0))
+		require.Equal(t, []string{"USLAX", "FJLTK"}, prefixCodes(t, st, "l", 0))
+		require.Empty(t, prefixCodes(t, st, "x", 0))
+	})
+
+	t.Run("ignore case, accents and diacritics", func(t *testing.T) {
+		require.Equal(t, []string{"ESALG"}, prefixCodes(t, st, "ÁLGE", 0))
+	})
+
+	t.Run("limit the number of results", func(t *testing.T) {
+		require.Equal(t, []string{"AEAUH", "AEDXB"}, prefixCodes(t, st, "ae", 2))
+	})
+
+	t.Run("keep index up to date on writes", func(t *testing.T) {
+		require.NoError(t, st.Update(context.Background(), "AEDXB", place{"AEDXB", "Port Rashid", nil, ""}))
+		require.Empty(t, prefixCodes(t, st, "dub", 0))
+		require.Equal(t, []string{"AEDXB"}, prefixCodes(t, st, "port r", 0))
+	})
+}
+
+func TestWithPrefixIndex(t *testing.T) {
+	fields := []string{"port_code", "name", "alias"}
+	st := NewInMemoryStorage(WithPrefixIndex(fields...)).(*InMemoryStorage)
+	require.Contains(t, st.prefix, "port_code,name,alias")
+
+	require.NoError(t, st.Insert(context.Background(), KeyValue{Key: "AEDXB", Value: place{"AEDXB", "Dubai", nil, ""}}))
+	require.Contains(t, st.prefix["port_code,name,alias"].values, "AEDXB")
+	require.Equal(t, []string{"AEDXB"}, prefixCodes(t, st, "dub", 0))
+
+	require.NoError(t, st.Delete(context.Background(), "AEDXB"))
+	require.NotContains(t, st.prefix["port_code,name,alias"].values, "AEDXB")
+}
+
+// BenchmarkSearchPrefix measures the lookups of short prefixes, which match the most records, at 100k records
+func BenchmarkSearchPrefix(b *testing.B) {
+	st := NewInMemoryStorage()
+	for i := 0; i < 100_000; i++ {
+		p := place{Code: fmt.Sprintf("P%07d", i), Name: fmt.Sprintf("Port %d", i), Alias: []string{fmt.Sprintf("Harbour %d", i)}}
+		require.NoError(b, st.Insert(context.Background(), KeyValue{Key: p.Code, Value: p}))
+	}
+	prefixCodes(b, st, "p", 10)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		prefixCodes(b, st, "p", 10)
+	}
+}
@@ -0,0 +1,319 @@
+package inmemory
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/text/unicode/norm"
+)
+
+/*
+textIndex is an inverted index of the words found in the text fields of the records. Words are
+normalized, so that the search is not sensitive to case, accents and diacritics, and the
+words of the query match the indexed words with a few typos, depending on their length.
+The words with typos are found through the bigrams they share with the query word, so that
+only the nearby words are compared with it, instead of the whole vocabulary.
+*/
+type textIndex struct {
+	weights map[string]int
+	// postings maps each word to the records that contain it, with the weight of the best field it was found in
+	postings map[string]map[string]int
+	// words maps each record to its indexed words, to remove them when the record changes
+	words map[string][]string
+	// grams maps each bigram of the padded words to the indexed words, that contain it
+	grams map[string]map[string]struct{}
+	// lengths maps each length in runes to the indexed words of that length
+	lengths map[int]map[string]struct{}
+}
+
+type textMatch struct {
+	key   string
+	score float64
+}
+
+func newTextIndex(weights map[string]int) *textIndex {
+	return &textIndex{
+		weights:  weights,
+		postings: make(map[string]map[string]int),
+		words:    make(map[string][]string),
+		grams:    make(map[string]map[string]struct{}),
+		lengths:  make(map[int]map[string]struct{}),
+	}
+}
+
+func (ti *textIndex) put(key string, doc bson.M) {
+	ti.remove(key)
+
+	found := make(map[string]int)
+	for field, weight := range ti.weights {
+		for _, text := range textValues(doc[field]) {
+			for _, word := range tokenize(text) {
+				if weight > found[word] {
+					found[word] = weight
+				}
+			}
+		}
+	}
+
+	for word, weight := range found {
+		if ti.postings[word] == nil {
+			ti.postings[word] = make(map[string]int)
+			ti.addWord(word)
+		}
+		ti.postings[word][key] = weight
+		ti.words[key] = append(ti.words[key], word)
+	}
+}
+
+func (ti *textIndex) remove(key string) {
+	for _, word := range ti.words[key] {
+		delete(ti.postings[word], key)
+		if len(ti.postings[word]) == 0 {
+			delete(ti.postings, word)
+			ti.removeWord(word)
+		}
+	}
+	delete(ti.words, key)
+}
+
+/*
+search scores each record by the words of the text it contains: a word found in the record adds
+the weight of the field it was found in, and a word found with typos adds a part of the weight,
+which gets smaller with the number of edits. Records are returned with the best score first.
+*/
+func (ti *textIndex) search(text string) []textMatch {
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, word := range tokenize(text) {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+
+		best := make(map[string]float64)
+		for indexed, similarity := range ti.similarWords(word) {
+			for key, weight := range ti.postings[indexed] {
+				if score := float64(weight) * similarity; score > best[key] {
+					best[key] = score
+				}
+			}
+		}
+		for key, score := range best {
+			scores[key] += score
+		}
+	}
+
+	found := make([]textMatch, 0, len(scores))
+	for key, score := range scores {
+		found = append(found, textMatch{key: key, score: score})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].score != found[j].score {
+			return found[i].score > found[j].score
+		}
+		return found[i].key < found[j].key
+	})
+	return found
+}
+
+// similarWords returns the indexed words within the allowed number of edits from the word, with their similarity
+func (ti *textIndex) similarWords(word string) map[string]float64 {
+	similar := make(map[string]float64)
+	if _, found := ti.postings[word]; found {
+		similar[word] = 1
+	}
+
+	maxEdits := allowedEdits(word)
+	if maxEdits == 0 {
+		return similar
+	}
+
+	runes := []rune(word)
+	for indexed := range ti.candidates(runes, maxEdits) {
+		if indexed == word {
+			continue
+		}
+		if edits, ok := editDistance(runes, []rune(indexed), maxEdits); ok {
+			similar[indexed] = 1 / float64(edits+1)
+		}
+	}
+	return similar
+}
+
+/*
+candidates returns the indexed words, that can be within maxEdits from the word. An edit changes
+at most 2 bigrams of the padded word, so a word within maxEdits shares at least all but 2*maxEdits
+of the distinct bigrams of the word. For the words with too many repeated bigrams to rely on that,
+ie. "aaaaaaaa", the candidates are the words of a length within maxEdits from the word.
+*/
+func (ti *textIndex) candidates(word []rune, maxEdits int) map[string]struct{} {
+	found := make(map[string]struct{})
+
+	grams := bigrams(word)
+	required := len(grams) - 2*maxEdits
+	if required <= 0 {
+		for n := len(word) - maxEdits; n <= len(word)+maxEdits; n++ {
+			for indexed := range ti.lengths[n] {
+				found[indexed] = struct{}{}
+			}
+		}
+		return found
+	}
+
+	shared := make(map[string]int)
+	for _, gram := range grams {
+		for indexed := range ti.grams[gram] {
+			shared[indexed]++
+		}
+	}
+	for indexed, count := range shared {
+		if count >= required {
+			found[indexed] = struct{}{}
+		}
+	}
+	return found
+}
+
+// addWord indexes a new word by its bigrams and its length
+func (ti *textIndex) addWord(word string) {
+	runes := []rune(word)
+	for _, gram := range bigrams(runes) {
+		if ti.grams[gram] == nil {
+			ti.grams[gram] = make(map[string]struct{})
+		}
+		ti.grams[gram][word] = struct{}{}
+	}
+	if ti.lengths[len(runes)] == nil {
+		ti.lengths[len(runes)] = make(map[string]struct{})
+	}
+	ti.lengths[len(runes)][word] = struct{}{}
+}
+
+// removeWord removes a word, that is no longer found in any record, from the bigrams and the lengths
+func (ti *textIndex) removeWord(word string) {
+	runes := []rune(word)
+	for _, gram := range bigrams(runes) {
+		delete(ti.grams[gram], word)
+		if len(ti.grams[gram]) == 0 {
+			delete(ti.grams, gram)
+		}
+	}
+	delete(ti.lengths[len(runes)], word)
+	if len(ti.lengths[len(runes)]) == 0 {
+		delete(ti.lengths, len(runes))
+	}
+}
+
+// bigrams returns the distinct pairs of consecutive runes of the word, padded with a start and an end mark
+func bigrams(word []rune) []string {
+	padded := make([]rune, 0, len(word)+2)
+	padded = append(padded, '^')
+	padded = append(padded, word...)
+	padded = append(padded, '$')
+
+	seen := make(map[string]bool, len(padded)-1)
+	grams := make([]string, 0, len(padded)-1)
+	for i := 0; i+1 < len(padded); i++ {
+		gram := string(padded[i : i+2])
+		if !seen[gram] {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+	return grams
+}
+
+// allowedEdits tolerates no typos in short words, which would match too many other words otherwise
+func allowedEdits(word string) int {
+	switch n := len([]rune(word)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance computes the Levenshtein distance of the words, giving up once it exceeds max
+func editDistance(a, b []rune, max int) (int, bool) {
+	if diff := len(a) - len(b); diff > max || -diff > max {
+		return 0, false
+	}
+
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			rowMin = minInt(rowMin, current[j])
+		}
+		if rowMin > max {
+			return 0, false
+		}
+		previous, current = current, previous
+	}
+
+	distance := previous[len(b)]
+	return distance, distance <= max
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+	return min
+}
+
+// textValues returns the strings of a field, that is either a string or an array of strings
+func textValues(value interface{}) []string {
+	if text, ok := value.(string); ok {
+		return []string{text}
+	}
+
+	var texts []string
+	for _, element := range asSlice(value) {
+		if text, ok := element.(string); ok {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// tokenize splits the text into lower case words, without accents and diacritics
+func tokenize(text string) []string {
+	return strings.FieldsFunc(fold(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+/*
+fold converts the text to lower case, without accents and diacritics: the text is decomposed,
+so that "é" becomes "e" followed by a combining accent, and the marks are dropped, including
+the spacing ones like "¸", that are found in some names, ie. "Abu Z¸aby".
+*/
+func fold(text string) string {
+	var folded strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		if unicode.In(r, unicode.Mn, unicode.Sk) {
+			continue
+		}
+		folded.WriteRune(unicode.ToLower(r))
+	}
+	return folded.String()
+}
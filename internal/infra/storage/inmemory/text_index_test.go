@@ -0,0 +1,102 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type place struct {
+	Code     string   `bson:"port_code"`
+	Name     string   `bson:"name"`
+	Alias    []string `bson:"alias"`
+	Province string   `bson:"province"`
+}
+
+func searchCodes(t *testing.T, st storage.Storage, text string) []string {
+	var found []place
+	require.NoError(t, st.Search(context.Background(), storage.SearchQuery{
+		Fields: map[string]int{"name": 2, "alias": 1, "province": 1},
+		Text:   text,
+	}, &found))
+
+	var codes []string
+	for _, p := range found {
+		codes = append(codes, p.Code)
+	}
+	return codes
+}
+
+func TestSearch(t *testing.T) {
+	st := NewInMemoryStorage()
+	for _, p := range []place{
+		{"AEAUH", "Abu Dhabi", nil, "Abu Z¸aby [Abu Dhabi]"},
+		{"AEJEA", "Jebel Ali", []string{"Mina Jebel Ali"}, "Dubai"},
+		{"AEDXB", "Dubai", nil, "Dubayy [Dubai]"},
+		{"ESALG", "Algeciras", nil, "Andalucía"},
+	} {
+		require.NoError(t, st.Insert(context.Background(), KeyValue{Key: p.Code, Value: p}))
+	}
+
+	t.Run("rank matches in name above other fields", func(t *testing.T) {
+		require.Equal(t, []string{"AEDXB", "AEJEA"}, searchCodes(t, st, "dubai"))
+	})
+
+	t.Run("ignore case, accents and diacritics", func(t *testing.T) {
+		require.Equal(t, []string{"AEAUH"}, searchCodes(t, st, "ABU ZABY"))
+		require.Equal(t, []string{"ESALG"}, searchCodes(t, st, "andalucia"))
+	})
+
+	t.Run("tolerate typos in longer words", func(t *testing.T) {
+		require.Equal(t, []string{"ESALG"}, searchCodes(t, st, "algesiras"))
+		require.Equal(t, []string{"AEJEA"}, searchCodes(t, st, "jebl"))
+	})
+
+	t.Run("don't tolerate typos in short words", func(t *testing.T) {
+		require.Empty(t, searchCodes(t, st, "abi"))
+	})
+
+	t.Run("keep index up to date on writes", func(t *testing.T) {
+		require.NoError(t, st.Update(context.Background(), "AEDXB", place{"AEDXB", "Port Rashid", nil, ""}))
+		require.Equal(t, []string{"AEJEA"}, searchCodes(t, st, "dubai"))
+		require.Equal(t, []string{"AEDXB"}, searchCodes(t, st, "rashid"))
+	})
+}
+
+func TestTextIndexCandidates(t *testing.T) {
+	index := newTextIndex(map[string]int{"name": 1})
+	for key, name := range map[string]string{
+		"SGSIN": "Singapore",
+		"CNSHA": "Shanghai",
+		"ESALG": "Algeciras",
+		"AAAAA": "Aaaaaaaa",
+	} {
+		index.put(key, bson.M{"name": name})
+	}
+
+	require.Equal(t, map[string]struct{}{"singapore": {}}, index.candidates([]rune("singapur"), 2))
+	require.Contains(t, index.candidates([]rune("aaaaaaab"), 2), "aaaaaaaa")
+	require.Equal(t, map[string]float64{"algeciras": 0.5}, index.similarWords("algesiras"))
+
+	index.remove("SGSIN")
+	require.Empty(t, index.candidates([]rune("singapur"), 2))
+	require.NotContains(t, index.grams, "po")
+}
+
+func TestTokenize(t *testing.T) {
+	require.Equal(t, []string{"abu", "zaby", "abu", "dhabi"}, tokenize("Abu Z¸aby [Abu Dhabi]"))
+	require.Equal(t, []string{"sao", "paulo"}, tokenize("São Paulo"))
+	require.Equal(t, []string{"nuku", "alofa"}, tokenize("Nuku'alofa"))
+}
+
+func TestEditDistance(t *testing.T) {
+	distance, ok := editDistance([]rune("singapur"), []rune("singapore"), 2)
+	require.True(t, ok)
+	require.Equal(t, 2, distance)
+
+	_, ok = editDistance([]rune("shanghai"), []rune("singapore"), 2)
+	require.False(t, ok)
+}
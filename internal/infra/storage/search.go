@@ -0,0 +1,18 @@
+package storage
+
+// SearchQuery selects the records, that contain the words of the Text in any of the Fields, most relevant first;
+// Fields map each field name to its weight in the relevance score
+type SearchQuery struct {
+	Fields map[string]int
+	Filter map[string]interface{}
+	Text   string
+	Limit  int
+}
+
+// PrefixQuery selects the records, with a value of any of the Fields starting with the Prefix
+type PrefixQuery struct {
+	Fields []string
+	Filter map[string]interface{}
+	Prefix string
+	Limit  int
+}
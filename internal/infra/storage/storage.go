@@ -12,5 +12,60 @@ var (
 type Storage interface {
 	Find(ctx context.Context, filter map[string]interface{}, result interface{}) error
 	Insert(ctx context.Context, obj interface{}) error
+	// Update changes the record identified by id, and returns ErrNotFound if there is no such record
 	Update(ctx context.Context, id interface{}, obj interface{}) error
+	// Upsert updates the record identified by id, or creates it if it does not exist, in a single atomic write
+	Upsert(ctx context.Context, id interface{}, obj interface{}) error
+	// Delete removes the record identified by id, and returns ErrNotFound if there is no such record
+	Delete(ctx context.Context, id interface{}) error
+	// BulkUpsert upserts all the records, and reports the outcome per record, instead of failing on the first error
+	BulkUpsert(ctx context.Context, records []UpsertRecord) (BulkUpsertResult, error)
+	// List fills results, which should be a pointer to a slice, with a page of records selected by opts
+	List(ctx context.Context, opts ListOptions, results interface{}) error
+	// Stream returns a cursor over all the records selected by opts, in the same order as List, that are read one at a time
+	Stream(ctx context.Context, opts ListOptions) (Cursor, error)
+	// Near fills results, which should be a pointer to a slice, with the records closest to the query point, ordered by distance
+	Near(ctx context.Context, query NearQuery, results interface{}) error
+	// Within fills results, which should be a pointer to a slice, with the records located inside the query area
+	Within(ctx context.Context, query WithinQuery, results interface{}) error
+	// Search fills results, which should be a pointer to a slice, with the records matching the query text, most relevant first
+	Search(ctx context.Context, query SearchQuery, results interface{}) error
+	// SearchPrefix fills results, which should be a pointer to a slice, with the records having a value that starts with the query prefix
+	SearchPrefix(ctx context.Context, query PrefixQuery, results interface{}) error
+}
+
+// ListOptions selects a page of records, ordered ascending by SortField, that come after the After value
+type ListOptions struct {
+	Filter    map[string]interface{}
+	SortField string
+	After     string
+	Limit     int
+}
+
+// Cursor walks the records returned by Stream; Decode reads the current record into result, which should be a pointer
+type Cursor interface {
+	Next(ctx context.Context) bool
+	Decode(result interface{}) error
+	// Err returns the error, that stopped Next, if any
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// UpsertRecord is a single write of BulkUpsert, with the same ID and Obj semantics as Storage.Upsert
+type UpsertRecord struct {
+	ID  interface{}
+	Obj interface{}
+}
+
+type BulkUpsertResult struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	Failures  []BulkFailure
+}
+
+// BulkFailure is a record, that failed to be written by BulkUpsert; Index is the position of the record in the input
+type BulkFailure struct {
+	Index int
+	Err   error
 }
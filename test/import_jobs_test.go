@@ -0,0 +1,136 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/imports"
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	httpApi "github.com/CristianCurteanu/koken-api/internal/infra/http"
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage/inmemory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncImport(t *testing.T) {
+	newRouter := func() http.Handler {
+		jobs := imports.NewManager(time.Hour)
+		return httpApi.NewRouter(
+			httpApi.PortHandlers(
+				ports.NewPortService(ports.NewPortRepository(ports.StorageTypeInMem, inmemory.NewInMemoryStorage())),
+				httpApi.WithImportJobs(jobs),
+			),
+			httpApi.ImportHandlers(jobs),
+		)
+	}
+
+	t.Run("import file in background", func(t *testing.T) {
+		router := newRouter()
+		resp := httptest.NewRecorder()
+		req, err := formFileUpload("/ports?async=true", "ports", "./fixtures/success.json")
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusAccepted, resp.Code)
+
+		var job struct {
+			ID       string `json:"id"`
+			State    string `json:"state"`
+			Progress struct {
+				Created int `json:"created"`
+			} `json:"progress"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &job))
+		require.NotEmpty(t, job.ID)
+		require.Equal(t, "/imports/"+job.ID, resp.Header().Get("Location"))
+
+		require.Eventually(t, func() bool {
+			resp := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/imports/"+job.ID, nil)
+			router.ServeHTTP(resp, req)
+			require.Equal(t, http.StatusOK, resp.Code)
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &job))
+			return job.State == string(imports.StateCompleted)
+		}, time.Second, 5*time.Millisecond)
+		require.Equal(t, 5, job.Progress.Created)
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest(http.MethodGet, "/ports/AEJEA", nil)
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest(http.MethodDelete, "/imports/"+job.ID, nil)
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusConflict, resp.Code)
+	})
+
+	t.Run("reject async that is not a boolean", func(t *testing.T) {
+		router := newRouter()
+		resp := httptest.NewRecorder()
+		req, err := formFileUpload("/ports?async=yes", "ports", "./fixtures/success.json")
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), `"code":"bad_mode"`)
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest(http.MethodGet, "/ports/AEJEA", nil)
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusNotFound, resp.Code)
+	})
+
+	t.Run("fail job if file is not valid", func(t *testing.T) {
+		router := newRouter()
+		resp := httptest.NewRecorder()
+		req, err := formFileUpload("/ports?async=true", "ports", "./fixtures/fail_as_array.json")
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusAccepted, resp.Code)
+
+		var job struct {
+			ID    string `json:"id"`
+			State string `json:"state"`
+			Error string `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &job))
+
+		require.Eventually(t, func() bool {
+			resp := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/imports/"+job.ID, nil)
+			router.ServeHTTP(resp, req)
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &job))
+			return job.State == string(imports.StateFailed)
+		}, time.Second, 5*time.Millisecond)
+		require.NotEmpty(t, job.Error)
+	})
+
+	t.Run("return not found for unknown job", func(t *testing.T) {
+		router := newRouter()
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest(method, "/imports/unknown", nil)
+			require.NoError(t, err)
+			router.ServeHTTP(resp, req)
+			require.Equal(t, http.StatusNotFound, resp.Code)
+		}
+	})
+
+	t.Run("reject async upload if jobs are not enabled", func(t *testing.T) {
+		router := httpApi.NewRouter(
+			httpApi.PortHandlers(ports.NewPortService(ports.NewPortRepository(ports.StorageTypeInMem, inmemory.NewInMemoryStorage()))),
+		)
+		resp := httptest.NewRecorder()
+		req, err := formFileUpload("/ports?async=true", "ports", "./fixtures/success.json")
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "async_not_supported")
+	})
+}
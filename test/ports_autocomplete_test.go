@@ -0,0 +1,48 @@
+package test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortsAutocomplete(t *testing.T) {
+	router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+	for _, tc := range []struct {
+		prefix string
+		codes  []string
+	}{
+		{"ae", []string{"AEAUH", "AEDXB", "AEJEA"}},
+		{"Du", []string{"AEDXB"}},
+		{"sgs", []string{"SGSIN"}},
+		{"sin", []string{"SGSIN"}},
+		{"new york", []string{"USNYC"}},
+		{"mina", []string{"AEJEA"}},
+		{"zzz", nil},
+	} {
+		t.Run(tc.prefix, func(t *testing.T) {
+			code, codes, _ := getGeoPorts(t, router, "/ports/autocomplete", url.Values{"prefix": {tc.prefix}})
+			require.Equal(t, http.StatusOK, code)
+			require.Equal(t, tc.codes, codes)
+		})
+	}
+
+	t.Run("limit the number of ports", func(t *testing.T) {
+		code, codes, _ := getGeoPorts(t, router, "/ports/autocomplete", url.Values{"prefix": {"a"}, "limit": {"2"}})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, []string{"AEAUH", "AEDXB"}, codes)
+	})
+
+	t.Run("fail if prefix is not valid", func(t *testing.T) {
+		for _, query := range []url.Values{
+			{},
+			{"prefix": {"a"}, "limit": {"51"}},
+		} {
+			code, _, _ := getGeoPorts(t, router, "/ports/autocomplete", query)
+			require.Equal(t, http.StatusBadRequest, code, query.Encode())
+		}
+	})
+}
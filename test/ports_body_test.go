@@ -0,0 +1,97 @@
+package test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func bodyUpload(t *testing.T, router http.Handler, uri, contentType string, body []byte) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewReader(body))
+	require.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestPortsUploadBody(t *testing.T) {
+	data, err := os.ReadFile("./fixtures/success.json")
+	require.NoError(t, err)
+
+	t.Run("import a JSON request body", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		resp := bodyUpload(t, router, "/ports", "application/json; charset=utf-8", data)
+		require.Equal(t, http.StatusCreated, resp.Code)
+		require.Contains(t, resp.Body.String(), `"created":5`)
+		require.Equal(t, "Ajman", getPort(t, router, "AEAJM").Name)
+	})
+
+	t.Run("validate a JSON request body", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := bodyUpload(t, router, "/ports/validate", "application/json", data)
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Contains(t, resp.Body.String(), `"unchanged":5`)
+	})
+
+	t.Run("fail on a malformed JSON request body", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		resp := bodyUpload(t, router, "/ports", "application/json", []byte(`{"AEAJM": {"name": "Ajman"`))
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "bad_json_file")
+	})
+
+	t.Run("fail if there is no body", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		for _, contentType := range []string{"", "application/json", "application/x-ndjson"} {
+			resp := bodyUpload(t, router, "/ports", contentType, nil)
+			require.Equal(t, http.StatusBadRequest, resp.Code, contentType)
+			require.Contains(t, resp.Body.String(), "no_file", contentType)
+		}
+	})
+
+	t.Run("fail if the form has no ports file", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		require.NoError(t, writer.WriteField("format", "json"))
+		require.NoError(t, writer.Close())
+
+		for _, uri := range []string{"/ports", "/ports/validate"} {
+			resp := bodyUpload(t, router, uri, writer.FormDataContentType(), body.Bytes())
+			require.Equal(t, http.StatusBadRequest, resp.Code, uri)
+			require.Contains(t, resp.Body.String(), "no_file", uri)
+		}
+	})
+
+	t.Run("fail if the form is malformed", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		resp := bodyUpload(t, router, "/ports", "multipart/form-data; boundary=xyz", []byte("--abc\r\nnot a form"))
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "bad_form")
+	})
+
+	t.Run("fail if the Content-Type is not supported", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		for _, contentType := range []string{"", "text/plain", "application/xml", "application/x-www-form-urlencoded"} {
+			resp := bodyUpload(t, router, "/ports", contentType, []byte(strings.Repeat("x", 10)))
+			require.Equal(t, http.StatusUnsupportedMediaType, resp.Code, contentType)
+			require.Contains(t, resp.Body.String(), "unsupported_media_type", contentType)
+		}
+	})
+}
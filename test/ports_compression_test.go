@@ -0,0 +1,145 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	httpApi "github.com/CristianCurteanu/koken-api/internal/infra/http"
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage/inmemory"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	writer := gzip.NewWriter(out)
+	_, err = writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return out.Bytes()
+}
+
+func zstdCompressed(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	return encoder.EncodeAll(data, nil)
+}
+
+func compressedPortsRouter(opts ...httpApi.PortHandlersOption) http.Handler {
+	return httpApi.NewRouter(
+		httpApi.PortHandlers(ports.NewPortService(ports.NewPortRepository(ports.StorageTypeInMem, inmemory.NewInMemoryStorage())), opts...),
+	)
+}
+
+func encodedBodyUpload(t *testing.T, router http.Handler, uri, contentType, encoding string, body []byte) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Content-Encoding", encoding)
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestPortsUploadCompressed(t *testing.T) {
+	t.Run("import a gzip compressed file", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		path := filepath.Join(t.TempDir(), "ports.json.gz")
+		require.NoError(t, os.WriteFile(path, gzipped(t, "./fixtures/success.json"), 0o600))
+
+		resp := httptest.NewRecorder()
+		req, err := formFileUpload("/ports", "ports", path)
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusCreated, resp.Code)
+		require.Contains(t, resp.Body.String(), `"created":5`)
+	})
+
+	t.Run("import a zstd compressed file in the given format", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		path := filepath.Join(t.TempDir(), "ports.csv.zst")
+		require.NoError(t, os.WriteFile(path, zstdCompressed(t, "./fixtures/unlocode.csv"), 0o600))
+
+		resp := formatFileUpload(t, router, "/ports", path, "unlocode")
+		require.Equal(t, http.StatusCreated, resp.Code)
+		require.Contains(t, resp.Body.String(), `"created":6`)
+	})
+
+	t.Run("validate a compressed file", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		path := filepath.Join(t.TempDir(), "ports.json.gz")
+		require.NoError(t, os.WriteFile(path, gzipped(t, "./fixtures/success.json"), 0o600))
+
+		resp := httptest.NewRecorder()
+		req, err := formFileUpload("/ports/validate", "ports", path)
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Contains(t, resp.Body.String(), `"unchanged":5`)
+	})
+
+	t.Run("import a request body by its Content-Encoding", func(t *testing.T) {
+		for encoding, body := range map[string][]byte{
+			"gzip": gzipped(t, "./fixtures/success.ndjson"),
+			"zstd": zstdCompressed(t, "./fixtures/success.ndjson"),
+		} {
+			router := compressedPortsRouter()
+
+			resp := encodedBodyUpload(t, router, "/ports", "application/x-ndjson", encoding, body)
+			require.Equal(t, http.StatusCreated, resp.Code, encoding)
+		}
+	})
+
+	t.Run("fail if the decompressed upload is over the limit", func(t *testing.T) {
+		router := compressedPortsRouter(httpApi.WithMaxDecompressedSize(100))
+
+		resp := encodedBodyUpload(t, router, "/ports", "application/x-ndjson", "gzip", gzipped(t, "./fixtures/success.ndjson"))
+		require.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+		require.Contains(t, resp.Body.String(), "upload_too_large")
+
+		path := filepath.Join(t.TempDir(), "ports.json.gz")
+		require.NoError(t, os.WriteFile(path, gzipped(t, "./fixtures/success.json"), 0o600))
+		for _, uri := range []string{"/ports", "/ports/validate"} {
+			resp := httptest.NewRecorder()
+			req, err := formFileUpload(uri, "ports", path)
+			require.NoError(t, err)
+			router.ServeHTTP(resp, req)
+			require.Equal(t, http.StatusRequestEntityTooLarge, resp.Code, uri)
+		}
+	})
+
+	t.Run("fail if the upload is not compressed as declared", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		data, err := os.ReadFile("./fixtures/success.ndjson")
+		require.NoError(t, err)
+		resp := encodedBodyUpload(t, router, "/ports", "application/x-ndjson", "zstd", data)
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "bad_compressed_file")
+	})
+
+	t.Run("fail if the encoding is not supported", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		resp := encodedBodyUpload(t, router, "/ports", "application/x-ndjson", "br", []byte("{}"))
+		require.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+		require.Contains(t, resp.Body.String(), "unsupported_encoding")
+	})
+}
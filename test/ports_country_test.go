@@ -0,0 +1,109 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortsCountryCode(t *testing.T) {
+	t.Run("store country code with the country name", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		resp := sendPortRequest(t, router, http.MethodGet, "/ports/RUVVO")
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Contains(t, resp.Body.String(), `"country_code":"RU"`)
+	})
+
+	t.Run("filter by alpha-2 or alpha-3 country code", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		for _, country := range []string{"FJ", "FJI", "fji"} {
+			code, page := getPortsPage(t, router, url.Values{"country_code": {country}})
+			require.Equal(t, http.StatusOK, code)
+
+			var codes []string
+			for _, port := range page.Data {
+				codes = append(codes, port.PortCode)
+			}
+			require.Equal(t, []string{"FJLTK", "FJSUV"}, codes, country)
+		}
+	})
+
+	t.Run("report countries, that don't match the port code, as warnings", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := httptest.NewRecorder()
+		req, err := formFileUpload("/ports", "ports", "./fixtures/country_mismatch.json")
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusCreated, resp.Code)
+
+		var report struct {
+			Created  int `json:"created"`
+			Warnings []struct {
+				PortCode string `json:"port_code"`
+				Field    string `json:"field"`
+				Message  string `json:"message"`
+			} `json:"warnings"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+		require.Equal(t, 2, report.Created)
+		require.Len(t, report.Warnings, 2)
+		require.Equal(t, "AEKLF", report.Warnings[0].PortCode)
+		require.Equal(t, "is OM, but the port code is from AE", report.Warnings[0].Message)
+		require.Equal(t, "AEQIW", report.Warnings[1].PortCode)
+		require.Equal(t, "is not a known country", report.Warnings[1].Message)
+
+		require.Contains(t, sendPortRequest(t, router, http.MethodGet, "/ports/AEKLF").Body.String(), `"country_code":"OM"`)
+		require.Contains(t, sendPortRequest(t, router, http.MethodGet, "/ports/AEQIW").Body.String(), `"country_code":"AE"`)
+	})
+
+	t.Run("report country warnings on validation", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		code, report := validatePorts(t, router, "./fixtures/country_mismatch.json")
+		require.Equal(t, http.StatusOK, code)
+		require.True(t, report.Valid)
+		require.Len(t, report.Warnings, 2)
+	})
+
+	t.Run("report country warnings on replace and patch", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		var response struct {
+			CountryCode string `json:"country_code"`
+			Warnings    []struct {
+				Field   string `json:"field"`
+				Message string `json:"message"`
+			} `json:"warnings"`
+		}
+		resp := sendPortRequestBody(t, router, http.MethodPut, "/ports/AEAJM", `{"name": "Ajman", "country": "Oman"}`)
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &response))
+		require.Equal(t, "OM", response.CountryCode)
+		require.Len(t, response.Warnings, 1)
+		require.Equal(t, "is OM, but the port code is from AE", response.Warnings[0].Message)
+
+		resp = sendPortRequestBody(t, router, http.MethodPatch, "/ports/AEAJM", `{"country": "Atlantis"}`)
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &response))
+		require.Equal(t, "is not a known country", response.Warnings[0].Message)
+
+		resp = sendPortRequestBody(t, router, http.MethodPatch, "/ports/AEAJM", `{"country": "United Arab Emirates"}`)
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.NotContains(t, resp.Body.String(), "warnings")
+	})
+
+	t.Run("update country code on patch", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		code, _ := sendPortBody(t, router, http.MethodPatch, "/ports/AEAJM", `{"country": "Oman"}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, sendPortRequest(t, router, http.MethodGet, "/ports/AEAJM").Body.String(), `"country_code":"OM"`)
+	})
+}
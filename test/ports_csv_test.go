@@ -0,0 +1,141 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// formatFileUpload sends the file as the `ports` form field, along with the `format` form field
+func formatFileUpload(t *testing.T, router http.Handler, uri, path, format string) *httptest.ResponseRecorder {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.NoError(t, writer.WriteField("format", format))
+	part, err := writer.CreateFormFile("ports", filepath.Base(path))
+	require.NoError(t, err)
+	_, err = part.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, uri, body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestPortsUploadCSV(t *testing.T) {
+	t.Run("import ports with the columns named by the header", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := httptest.NewRecorder()
+		req, err := typedFormFileUpload("/ports?partial=true", "ports", "./fixtures/ports.csv", "text/csv")
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+
+		var report ndjsonReport
+		require.Equal(t, http.StatusMultiStatus, resp.Code)
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+		require.Equal(t, 1, report.Created)
+		require.Equal(t, 1, report.Failed)
+		require.Equal(t, "AEQIW", report.Failures[0].PortCode)
+		require.Equal(t, 4, report.Failures[0].Line)
+
+		port := getPort(t, router, "AEKLF")
+		require.Equal(t, []string{"Khawr Fakkan", "Khor Fakan"}, port.Alias)
+		require.Equal(t, []float64{56.35, 25.33}, port.Coordinates)
+	})
+
+	t.Run("read request body as CSV, by its Content-Type", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		file, err := os.Open("./fixtures/ports.csv")
+		require.NoError(t, err)
+		defer file.Close()
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/ports", file)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+		router.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "line 4")
+	})
+
+	t.Run("import port locations from the official UN/LOCODE file", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := formatFileUpload(t, router, "/ports", "./fixtures/unlocode.csv", "unlocode")
+		require.Equal(t, http.StatusCreated, resp.Code)
+		require.Contains(t, resp.Body.String(), `"created":3,"updated":3`)
+
+		port := getPort(t, router, "BRSSO")
+		require.Equal(t, "São Sebastião", port.Name)
+		require.Equal(t, "Brazil", port.Country)
+		require.Equal(t, "SP", port.Province)
+		require.InDeltaSlice(t, []float64{-45.4, -23.8}, port.Coordinates, 0.001)
+
+		require.Equal(t, http.StatusNotFound, sendPortRequest(t, router, http.MethodGet, "/ports/AEZZA").Code)
+		require.Equal(t, http.StatusNotFound, sendPortRequest(t, router, http.MethodGet, "/ports/AEXXX").Code)
+	})
+
+	t.Run("validate file in the given format", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := formatFileUpload(t, router, "/ports/validate", "./fixtures/unlocode.csv", "unlocode")
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Contains(t, resp.Body.String(), `"summary":{"new":3,"changed":3`)
+	})
+
+	t.Run("fail if format is unknown", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		for _, uri := range []string{"/ports", "/ports/validate"} {
+			resp := formatFileUpload(t, router, uri, "./fixtures/ports.csv", "xlsx")
+			require.Equal(t, http.StatusBadRequest, resp.Code)
+			require.Contains(t, resp.Body.String(), "bad_format")
+		}
+	})
+
+	t.Run("fail on the first malformed record", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := formatFileUpload(t, router, "/ports?"+url.Values{"partial": {"false"}}.Encode(), "./fixtures/ports.csv", "csv")
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "line 4")
+	})
+
+	t.Run("report records without a name or country as failed ports, like the other formats", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := bodyUpload(t, router, "/ports", "text/csv", []byte(
+			"port_code,name,country\nAEKLF,Khor Fakkan,United Arab Emirates\nAEQIW,Umm al Qaiwain,\n",
+		))
+		require.Equal(t, http.StatusMultiStatus, resp.Code)
+		require.Contains(t, resp.Body.String(), `"created":1`)
+		require.Contains(t, resp.Body.String(), `"port_code":"AEQIW","line":3`)
+	})
+
+	t.Run("fail with the reason, if header can't be mapped", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		for _, uri := range []string{"/ports", "/ports/validate"} {
+			resp := bodyUpload(t, router, uri, "text/csv", []byte("code,name\n52000,Ajman\n"))
+			require.Equal(t, http.StatusBadRequest, resp.Code)
+			require.Contains(t, resp.Body.String(), "Please check the header at line 1 of your file: the header should have a port_code column")
+		}
+	})
+}
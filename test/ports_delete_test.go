@@ -0,0 +1,87 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/stretchr/testify/require"
+)
+
+func sendPortRequest(t *testing.T, router http.Handler, method, path string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(method, path, nil)
+	require.NoError(t, err)
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestPortsDelete(t *testing.T) {
+	t.Run("remove port", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		require.Equal(t, http.StatusNoContent, sendPortRequest(t, router, http.MethodDelete, "/ports/AEAJM").Code)
+		require.Equal(t, http.StatusNotFound, sendPortRequest(t, router, http.MethodGet, "/ports/AEAJM").Code)
+		require.Equal(t, http.StatusNotFound, sendPortRequest(t, router, http.MethodDelete, "/ports/AEAJM").Code)
+		require.Equal(t, http.StatusNotFound, sendPortRequest(t, router, http.MethodPost, "/ports/AEAJM/restore").Code)
+
+		_, page := getPortsPage(t, router, url.Values{"include_deleted": {"true"}})
+		require.Len(t, page.Data, 4)
+	})
+
+	t.Run("hide soft deleted port from reads", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json", ports.WithSoftDelete(true))
+
+		require.Equal(t, http.StatusNoContent, sendPortRequest(t, router, http.MethodDelete, "/ports/AEDXB").Code)
+		require.Equal(t, http.StatusNotFound, sendPortRequest(t, router, http.MethodGet, "/ports/AEDXB").Code)
+		require.Equal(t, http.StatusNotFound, sendPortRequest(t, router, http.MethodDelete, "/ports/AEDXB").Code)
+
+		_, page := getPortsPage(t, router, url.Values{"country": {"United Arab Emirates"}})
+		require.Len(t, page.Data, 2)
+
+		_, codes, _ := getGeoPorts(t, router, "/ports/nearby", url.Values{"lat": {"25.2"}, "lon": {"55.3"}})
+		require.Equal(t, []string{"AEJEA"}, codes)
+		_, codes, _ = getGeoPorts(t, router, "/ports/within", url.Values{"bbox": {"54,24,56,26"}})
+		require.Equal(t, []string{"AEAUH", "AEJEA"}, codes)
+		_, codes, _ = getGeoPorts(t, router, "/ports/search", url.Values{"q": {"dubai"}})
+		require.Equal(t, []string{"AEJEA"}, codes)
+		_, codes, _ = getGeoPorts(t, router, "/ports/autocomplete", url.Values{"prefix": {"du"}})
+		require.Empty(t, codes)
+	})
+
+	t.Run("list soft deleted ports if asked", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json", ports.WithSoftDelete(true))
+		require.Equal(t, http.StatusNoContent, sendPortRequest(t, router, http.MethodDelete, "/ports/AEAJM").Code)
+
+		resp := sendPortRequest(t, router, http.MethodGet, "/ports?include_deleted=true&limit=1")
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var page struct {
+			Data []struct {
+				PortCode  string  `json:"port_code"`
+				DeletedAt *string `json:"deleted_at"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+		require.Equal(t, "AEAJM", page.Data[0].PortCode)
+		require.NotNil(t, page.Data[0].DeletedAt)
+
+		code, _ := getPortsPage(t, router, url.Values{"include_deleted": {"maybe"}})
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("restore soft deleted port", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json", ports.WithSoftDelete(true))
+		require.Equal(t, http.StatusNoContent, sendPortRequest(t, router, http.MethodDelete, "/ports/AEAJM").Code)
+
+		resp := sendPortRequest(t, router, http.MethodPost, "/ports/AEAJM/restore")
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.NotContains(t, resp.Body.String(), "deleted_at")
+
+		require.Equal(t, http.StatusOK, sendPortRequest(t, router, http.MethodGet, "/ports/AEAJM").Code)
+		require.Equal(t, http.StatusNotFound, sendPortRequest(t, router, http.MethodPost, "/ports/AEAJM/restore").Code)
+	})
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	httpApi "github.com/CristianCurteanu/koken-api/internal/infra/http"
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage/inmemory"
+	"github.com/stretchr/testify/require"
+)
+
+func acceptExport(t *testing.T, router http.Handler, uri, accept string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", accept)
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestPortsExport(t *testing.T) {
+	t.Run("export map-keyed JSON by default, that can be imported back", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := exportPorts(t, router, "/ports/export")
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+		require.Contains(t, resp.Header().Get("Content-Disposition"), `filename="ports.json"`)
+
+		var exported map[string]map[string]interface{}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &exported))
+		require.Len(t, exported, 5)
+		require.Equal(t, "Ajman", exported["AEAJM"]["name"])
+		require.NotContains(t, exported["AEAJM"], "port_code")
+
+		path := filepath.Join(t.TempDir(), "ports.json")
+		require.NoError(t, os.WriteFile(path, resp.Body.Bytes(), 0o600))
+		imported := uploadedPortsRouter(t, path)
+		require.Equal(t, resp.Body.String(), exportPorts(t, imported, "/ports/export").Body.String())
+	})
+
+	t.Run("export an empty object if no port matches", func(t *testing.T) {
+		router := httpApi.NewRouter(
+			httpApi.PortHandlers(ports.NewPortService(ports.NewPortRepository(ports.StorageTypeInMem, inmemory.NewInMemoryStorage()))),
+		)
+
+		resp := exportPorts(t, router, "/ports/export")
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.JSONEq(t, `{}`, resp.Body.String())
+	})
+
+	t.Run("export NDJSON, as negotiated by the Accept header", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := acceptExport(t, router, "/ports/export?timezone=Asia/Dubai", "application/x-ndjson, application/json;q=0.5")
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Equal(t, "application/x-ndjson", resp.Header().Get("Content-Type"))
+
+		var codes []string
+		lines := bufio.NewScanner(resp.Body)
+		for lines.Scan() {
+			var port struct {
+				PortCode string `json:"port_code"`
+			}
+			require.NoError(t, json.Unmarshal(lines.Bytes(), &port))
+			codes = append(codes, port.PortCode)
+		}
+		require.Equal(t, []string{"AEAJM", "AEAUH", "AEDXB", "AEFJR", "AEJEA"}, codes)
+	})
+
+	t.Run("export CSV, that can be imported back", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := acceptExport(t, router, "/ports/export?city=Dubai", "text/csv")
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Equal(t, "text/csv", resp.Header().Get("Content-Type"))
+
+		records, err := csv.NewReader(bytes.NewReader(resp.Body.Bytes())).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		require.Equal(t, "port_code", records[0][0])
+		require.Equal(t, "AEDXB", records[1][0])
+
+		upload := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/ports", bytes.NewReader(resp.Body.Bytes()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "text/csv")
+		router.ServeHTTP(upload, req)
+		require.Equal(t, http.StatusCreated, upload.Code)
+		require.Contains(t, upload.Body.String(), `"created":0,`)
+	})
+
+	t.Run("prefer the format query param over the Accept header", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := acceptExport(t, router, "/ports/export?format=geojson", "text/csv")
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Equal(t, "application/geo+json", resp.Header().Get("Content-Type"))
+	})
+
+	t.Run("fail if no format is acceptable", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := acceptExport(t, router, "/ports/export", "text/html")
+		require.Equal(t, http.StatusNotAcceptable, resp.Code)
+		require.Contains(t, resp.Body.String(), "not_acceptable")
+	})
+}
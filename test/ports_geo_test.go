@@ -0,0 +1,159 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type geoPortsResponse struct {
+	Data []struct {
+		PortCode   string  `json:"port_code"`
+		DistanceKm float64 `json:"distance_km"`
+	} `json:"data"`
+}
+
+func getGeoPorts(t *testing.T, router http.Handler, path string, query url.Values) (int, []string, geoPortsResponse) {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, path+"?"+query.Encode(), nil)
+	require.NoError(t, err)
+	router.ServeHTTP(resp, req)
+
+	var body geoPortsResponse
+	var codes []string
+	if resp.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		for _, port := range body.Data {
+			codes = append(codes, port.PortCode)
+		}
+	}
+	return resp.Code, codes, body
+}
+
+func TestPortsNearby(t *testing.T) {
+	router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+	t.Run("return ports sorted by distance", func(t *testing.T) {
+		code, codes, body := getGeoPorts(t, router, "/ports/nearby", url.Values{
+			"lat": {"25.2"}, "lon": {"55.3"}, "radius_km": {"200"},
+		})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, []string{"AEDXB", "AEJEA", "AEAUH"}, codes)
+		require.Less(t, body.Data[0].DistanceKm, body.Data[1].DistanceKm)
+		require.InDelta(t, 6.3, body.Data[0].DistanceKm, 0.5)
+	})
+
+	t.Run("limit the number of ports", func(t *testing.T) {
+		code, codes, _ := getGeoPorts(t, router, "/ports/nearby", url.Values{
+			"lat": {"25.2"}, "lon": {"55.3"}, "radius_km": {"20000"}, "limit": {"4"},
+		})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, []string{"AEDXB", "AEJEA", "AEAUH", "DEHAM"}, codes)
+	})
+
+	t.Run("fail if location is not valid", func(t *testing.T) {
+		for _, query := range []url.Values{
+			{"lon": {"55.3"}},
+			{"lat": {"91"}, "lon": {"55.3"}},
+			{"lat": {"25.2"}, "lon": {"-181"}},
+			{"lat": {"25.2"}, "lon": {"55.3"}, "radius_km": {"-1"}},
+			{"lat": {"25.2"}, "lon": {"55.3"}, "radius_km": {"0"}},
+			{"lat": {"25.2"}, "lon": {"55.3"}, "limit": {"1000"}},
+		} {
+			code, _, _ := getGeoPorts(t, router, "/ports/nearby", query)
+			require.Equal(t, http.StatusBadRequest, code, query.Encode())
+		}
+	})
+
+	t.Run("still get port by code", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/ports/SGSIN", nil)
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+	})
+}
+
+func postGeoPorts(t *testing.T, router http.Handler, body string) (int, []string) {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/ports/within", strings.NewReader(body))
+	require.NoError(t, err)
+	router.ServeHTTP(resp, req)
+
+	var codes []string
+	if resp.Code == http.StatusOK {
+		var body geoPortsResponse
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		for _, port := range body.Data {
+			codes = append(codes, port.PortCode)
+		}
+	}
+	return resp.Code, codes
+}
+
+func TestPortsWithin(t *testing.T) {
+	router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+	t.Run("return ports inside box", func(t *testing.T) {
+		code, codes, _ := getGeoPorts(t, router, "/ports/within", url.Values{"bbox": {"54,24,56,26"}})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, []string{"AEAUH", "AEDXB", "AEJEA"}, codes)
+	})
+
+	t.Run("return ports inside box crossing the antimeridian", func(t *testing.T) {
+		code, codes, _ := getGeoPorts(t, router, "/ports/within", url.Values{"bbox": {"177,-22,-171,-13"}})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, []string{"FJLTK", "FJSUV", "TONUK", "WSAPW"}, codes)
+
+		code, codes, _ = getGeoPorts(t, router, "/ports/within", url.Values{"bbox": {"178,-22,-172,-13"}})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, []string{"FJSUV", "TONUK"}, codes)
+	})
+
+	t.Run("limit the number of ports", func(t *testing.T) {
+		code, codes, _ := getGeoPorts(t, router, "/ports/within", url.Values{"bbox": {"-180,-90,180,90"}, "limit": {"2"}})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, []string{"AEAUH", "AEDXB"}, codes)
+	})
+
+	t.Run("return ports inside polygon", func(t *testing.T) {
+		code, codes := postGeoPorts(t, router, `{
+			"type": "Polygon",
+			"coordinates": [[[54.9, 24.9], [55.4, 24.9], [55.4, 25.4], [54.9, 24.9]]]
+		}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, []string{"AEDXB", "AEJEA"}, codes)
+	})
+
+	t.Run("fail if area is not valid", func(t *testing.T) {
+		for _, query := range []url.Values{
+			{},
+			{"bbox": {"54,24,56"}},
+			{"bbox": {"54,24,56,north"}},
+			{"bbox": {"54,26,56,24"}},
+			{"bbox": {"54,24,54,26"}},
+			{"bbox": {"54,24,190,26"}},
+			{"bbox": {"54,24,56,26"}, "limit": {"0"}},
+		} {
+			code, _, _ := getGeoPorts(t, router, "/ports/within", query)
+			require.Equal(t, http.StatusBadRequest, code, query.Encode())
+		}
+
+		for _, body := range []string{
+			`[]`,
+			`{"type": "Point", "coordinates": [55.3, 25.2]}`,
+			`{"type": "Polygon", "coordinates": []}`,
+			`{"type": "Polygon", "coordinates": [[[54, 24], [56, 24], [56, 26]]]}`,
+			`{"type": "Polygon", "coordinates": [[[54, 24], [56, 24], [56, 26], [54, 26]]]}`,
+			`{"type": "Polygon", "coordinates": [[[-90, 0], [0, -60], [90, 0], [0, 60], [-90, 0]]]}`,
+		} {
+			code, _ := postGeoPorts(t, router, body)
+			require.Equal(t, http.StatusBadRequest, code, body)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type geojsonCollection struct {
+	Type     string `json:"type"`
+	Features []struct {
+		Type     string `json:"type"`
+		ID       string `json:"id"`
+		Geometry *struct {
+			Type        string    `json:"type"`
+			Coordinates []float64 `json:"coordinates"`
+		} `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	} `json:"features"`
+}
+
+func exportPorts(t *testing.T, router http.Handler, uri string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	require.NoError(t, err)
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestPortsGeoJSON(t *testing.T) {
+	t.Run("import Point features, skipping the other geometries", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := formatFileUpload(t, router, "/ports?partial=true", "./fixtures/ports.geojson", "geojson")
+		require.Equal(t, http.StatusMultiStatus, resp.Code)
+
+		var report ndjsonReport
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+		require.Equal(t, 2, report.Created)
+		require.Equal(t, 1, report.Failed)
+		require.Equal(t, "AEAJM", report.Failures[0].PortCode)
+
+		port := getPort(t, router, "AEKLF")
+		require.Equal(t, []float64{56.35, 25.33}, port.Coordinates)
+		require.Equal(t, []string{"Khawr Fakkan"}, port.Alias)
+		require.Empty(t, getPort(t, router, "AEQIW").Coordinates)
+	})
+
+	t.Run("fail on a non Point feature", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := formatFileUpload(t, router, "/ports", "./fixtures/ports.geojson", "geojson")
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "port AEAJM")
+	})
+
+	t.Run("export ports as a FeatureCollection", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := exportPorts(t, router, "/ports/export?format=geojson")
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Equal(t, "application/geo+json", resp.Header().Get("Content-Type"))
+
+		var collection geojsonCollection
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &collection))
+		require.Equal(t, "FeatureCollection", collection.Type)
+		require.Len(t, collection.Features, 5)
+
+		feature := collection.Features[0]
+		require.Equal(t, "AEAJM", feature.ID)
+		require.Equal(t, "Point", feature.Geometry.Type)
+		require.Equal(t, []float64{55.5136433, 25.4052165}, feature.Geometry.Coordinates)
+		require.Equal(t, "Ajman", feature.Properties["name"])
+	})
+
+	t.Run("export filtered ports", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := exportPorts(t, router, "/ports/export?format=geojson&city=Dubai")
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var collection geojsonCollection
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &collection))
+		require.Len(t, collection.Features, 1)
+		require.Equal(t, "AEDXB", collection.Features[0].ID)
+
+		resp = exportPorts(t, router, "/ports/export?format=geojson&city=Atlantis")
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.JSONEq(t, `{"type":"FeatureCollection","features":[]}`, resp.Body.String())
+	})
+
+	t.Run("re-import the exported ports", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+		before := getPort(t, router, "AEAUH")
+		exported := exportPorts(t, router, "/ports/export?format=geojson").Body.Bytes()
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/ports", bytes.NewReader(exported))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/geo+json")
+		router.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusCreated, resp.Code)
+		require.Contains(t, resp.Body.String(), `"created":0,`)
+		require.Contains(t, resp.Body.String(), `"failed":0,`)
+		require.Equal(t, before, getPort(t, router, "AEAUH"))
+	})
+
+	t.Run("fail if export format is unknown", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		resp := exportPorts(t, router, "/ports/export?format=kml")
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "bad_format")
+	})
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type badJSONFileError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details struct {
+		Offset   int64  `json:"offset"`
+		Line     int    `json:"line"`
+		Column   int    `json:"column"`
+		PortCode string `json:"port_code"`
+		Field    string `json:"field"`
+		Context  string `json:"context"`
+	} `json:"details"`
+}
+
+// uploadJSONFile sends the JSON fixture in a form, and reads the bad_json_file error of the response
+func uploadJSONFile(t *testing.T, router http.Handler, uri, fixture string) (int, badJSONFileError) {
+	resp := httptest.NewRecorder()
+	req, err := formFileUpload(uri, "ports", fixture)
+	require.NoError(t, err)
+	router.ServeHTTP(resp, req)
+
+	var apiErr badJSONFileError
+	if resp.Code == http.StatusBadRequest {
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &apiErr))
+	}
+	return resp.Code, apiErr
+}
+
+func TestPortsJSONErrors(t *testing.T) {
+	t.Run("locate a syntax error", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		body := "{\n  \"AEAJM\": {\"name\": \"Ajman\"},\n  \"AEAUH\": {\"name\": \"Abu Dhabi\" \"city\": \"Abu Dhabi\"}\n}"
+		resp := bodyUpload(t, router, "/ports", "application/json", []byte(body))
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+
+		var apiErr badJSONFileError
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &apiErr))
+		require.Equal(t, "bad_json_file", apiErr.Code)
+		require.Equal(t, "Please check the line 3, column 33 of your file: invalid character '\"' after object key:value pair", apiErr.Message)
+		require.Equal(t, int64(64), apiErr.Details.Offset)
+		require.Equal(t, 3, apiErr.Details.Line)
+		require.Equal(t, 33, apiErr.Details.Column)
+		require.Equal(t, "AEAUH", apiErr.Details.PortCode)
+		require.Equal(t, `": {"name": "Abu Dhabi" "city": "Abu Dhabi"}`, apiErr.Details.Context)
+	})
+
+	t.Run("name the field of the wrong type", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		code, apiErr := uploadJSONFile(t, router, "/ports", "./fixtures/fail_type_mismatch.json")
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, "Please check the line 7, column 9 of your file: AEAJM.coordinates[0] should be a number, got string", apiErr.Message)
+		require.Equal(t, int64(135), apiErr.Details.Offset)
+		require.Equal(t, "AEAJM", apiErr.Details.PortCode)
+		require.Equal(t, "AEAJM.coordinates[0]", apiErr.Details.Field)
+		require.Equal(t, `"55.5136433",`, apiErr.Details.Context)
+	})
+
+	t.Run("skip the ports with fields of the wrong type, if partial", func(t *testing.T) {
+		router := compressedPortsRouter()
+
+		resp := httptest.NewRecorder()
+		req, err := formFileUpload("/ports?partial=true", "ports", "./fixtures/fail_type_mismatch.json")
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+
+		var report ndjsonReport
+		require.Equal(t, http.StatusMultiStatus, resp.Code)
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+		require.Equal(t, 1, report.Created)
+		require.Equal(t, 1, report.Failed)
+		require.Equal(t, "AEAJM", report.Failures[0].PortCode)
+		require.Equal(t, 7, report.Failures[0].Line)
+		require.Contains(t, report.Failures[0].Reason, "AEAJM.coordinates[0] should be a number")
+	})
+
+	t.Run("locate the errors of a validated file", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		code, report := validatePorts(t, router, "./fixtures/fail_type_mismatch.json")
+		require.Equal(t, http.StatusOK, code)
+		require.False(t, report.Valid)
+		require.Len(t, report.Errors, 1)
+		require.Equal(t, "AEAJM", report.Errors[0].PortCode)
+		require.Equal(t, 7, report.Errors[0].Line)
+		require.Contains(t, report.Errors[0].Message, "AEAJM.coordinates[0] should be a number")
+	})
+}
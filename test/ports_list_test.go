@@ -0,0 +1,152 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	httpApi "github.com/CristianCurteanu/koken-api/internal/infra/http"
+	"github.com/CristianCurteanu/koken-api/internal/infra/storage/inmemory"
+	"github.com/stretchr/testify/require"
+)
+
+type portsPage struct {
+	Data []struct {
+		PortCode string `json:"port_code"`
+	} `json:"data"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func uploadedPortsRouter(t *testing.T, fixture string, opts ...ports.ServiceOption) http.Handler {
+	router := httpApi.NewRouter(
+		httpApi.PortHandlers(ports.NewPortService(ports.NewPortRepository(ports.StorageTypeInMem, inmemory.NewInMemoryStorage()), opts...)),
+	)
+	resp := httptest.NewRecorder()
+	req, err := formFileUpload("/ports", "ports", fixture)
+	require.NoError(t, err)
+	router.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	return router
+}
+
+func getPortsPage(t *testing.T, router http.Handler, query url.Values) (int, portsPage) {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/ports?"+query.Encode(), nil)
+	require.NoError(t, err)
+	router.ServeHTTP(resp, req)
+
+	var page portsPage
+	if resp.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+	}
+	return resp.Code, page
+}
+
+func TestPortsList(t *testing.T) {
+	t.Run("list all ports page by page, sorted by port code", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		var codes []string
+		query := url.Values{"limit": {"2"}}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 3)
+
+			code, page := getPortsPage(t, router, query)
+			require.Equal(t, http.StatusOK, code)
+			for _, port := range page.Data {
+				codes = append(codes, port.PortCode)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			query.Set("cursor", page.NextCursor)
+		}
+
+		require.Equal(t, []string{"AEAJM", "AEAUH", "AEDXB", "AEFJR", "AEJEA"}, codes)
+	})
+
+	t.Run("fail if limit is not valid", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		for _, limit := range []string{"0", "-1", "abc", "100000"} {
+			code, _ := getPortsPage(t, router, url.Values{"limit": {limit}})
+			require.Equal(t, http.StatusBadRequest, code)
+		}
+	})
+
+	t.Run("fail if cursor is not valid", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		code, _ := getPortsPage(t, router, url.Values{"cursor": {"not base64!"}})
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestPortsListFilters(t *testing.T) {
+	router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+	for name, tc := range map[string]struct {
+		query url.Values
+		codes []string
+	}{
+		"by timezone": {
+			query: url.Values{"timezone": {"Asia/Dubai"}},
+			codes: []string{"AEAUH", "AEDXB", "AEJEA"},
+		},
+		"by country": {
+			query: url.Values{"country": {"United States"}},
+			codes: []string{"USLAX", "USNYC"},
+		},
+		"by country and province": {
+			query: url.Values{"country": {"United States"}, "province": {"California"}},
+			codes: []string{"USLAX"},
+		},
+		"by city": {
+			query: url.Values{"city": {"Jebel Ali"}},
+			codes: []string{"AEJEA"},
+		},
+		"by all of the regions": {
+			query: url.Values{"regions": {"Asia Pacific", "Europe"}},
+			codes: []string{"RUVVO"},
+		},
+		"by unlocs": {
+			query: url.Values{"unlocs": {"SGSIN"}},
+			codes: []string{"SGSIN"},
+		},
+		"with no matches": {
+			query: url.Values{"country": {"Fiji"}, "timezone": {"Asia/Dubai"}},
+			codes: nil,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			code, page := getPortsPage(t, router, tc.query)
+			require.Equal(t, http.StatusOK, code)
+
+			var codes []string
+			for _, port := range page.Data {
+				codes = append(codes, port.PortCode)
+			}
+			require.Equal(t, tc.codes, codes)
+			require.Empty(t, page.NextCursor)
+		})
+	}
+
+	t.Run("paginate filtered ports", func(t *testing.T) {
+		query := url.Values{"regions": {"Oceania"}, "limit": {"3"}}
+		code, page := getPortsPage(t, router, query)
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, page.Data, 3)
+		require.NotEmpty(t, page.NextCursor)
+
+		query.Set("cursor", page.NextCursor)
+		code, page = getPortsPage(t, router, query)
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, page.Data, 1)
+		require.Equal(t, "WSAPW", page.Data[0].PortCode)
+		require.Empty(t, page.NextCursor)
+	})
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type ndjsonReport struct {
+	Created  int `json:"created"`
+	Failed   int `json:"failed"`
+	Failures []struct {
+		PortCode string `json:"port_code"`
+		Line     int    `json:"line"`
+		Reason   string `json:"reason"`
+	} `json:"failures"`
+}
+
+// ndjsonUpload sends the NDJSON fixture as the request body
+func ndjsonUpload(t *testing.T, router http.Handler, query url.Values, fixture string) (*httptest.ResponseRecorder, ndjsonReport) {
+	file, err := os.Open(fixture)
+	require.NoError(t, err)
+	defer file.Close()
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/ports?"+query.Encode(), file)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	router.ServeHTTP(resp, req)
+
+	var report ndjsonReport
+	if resp.Code < 300 {
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+	}
+	return resp, report
+}
+
+// typedFormFileUpload sends the file as the form field, with the Content-Type of the form field set
+func typedFormFileUpload(uri, paramName, path, contentType string) (*http.Request, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="`+paramName+`"; filename="`+filepath.Base(path)+`"`)
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, uri, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req, err
+}
+
+func TestPortsUploadNDJSON(t *testing.T) {
+	t.Run("import ports from request body", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		resp, report := ndjsonUpload(t, router, nil, "./fixtures/success.ndjson")
+		require.Equal(t, http.StatusCreated, resp.Code)
+		require.Equal(t, 2, report.Created)
+		require.Equal(t, "Ajman", getPort(t, router, "AEAJM").Name)
+	})
+
+	t.Run("import ports from form file", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		resp := httptest.NewRecorder()
+		req, err := typedFormFileUpload("/ports", "ports", "./fixtures/success.ndjson", "application/x-ndjson")
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusCreated, resp.Code)
+		require.Contains(t, resp.Body.String(), `"created":2`)
+	})
+
+	t.Run("fail on the first malformed line", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		resp, _ := ndjsonUpload(t, router, nil, "./fixtures/partial.ndjson")
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "bad_json_file")
+		require.Contains(t, resp.Body.String(), "line 2")
+	})
+
+	t.Run("import valid lines and report the rest by line number on partial upload", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		resp, report := ndjsonUpload(t, router, url.Values{"partial": {"true"}}, "./fixtures/partial.ndjson")
+		require.Equal(t, http.StatusMultiStatus, resp.Code)
+		require.Equal(t, 1, report.Created)
+		require.Equal(t, 3, report.Failed)
+
+		require.Equal(t, "AEKLF", report.Failures[0].PortCode)
+		require.Equal(t, 2, report.Failures[0].Line)
+		require.Equal(t, 4, report.Failures[1].Line)
+		require.Equal(t, "AEXXX", report.Failures[2].PortCode)
+		require.Equal(t, 6, report.Failures[2].Line)
+		require.Contains(t, report.Failures[2].Reason, "country")
+
+		require.Equal(t, "Ajman", getPort(t, router, "AEAJM").Name)
+		require.Equal(t, http.StatusNotFound, sendPortRequest(t, router, http.MethodGet, "/ports/AEKLF").Code)
+	})
+
+	t.Run("fail if partial is not a boolean", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		resp, _ := ndjsonUpload(t, router, url.Values{"partial": {"maybe"}}, "./fixtures/success.ndjson")
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "bad_mode")
+	})
+
+	t.Run("fail if partial is used in replace mode", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		resp, _ := ndjsonUpload(t, router, url.Values{"partial": {"true"}, "mode": {"replace"}}, "./fixtures/partial.ndjson")
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "bad_mode")
+
+		_, page := getPortsPage(t, router, url.Values{"limit": {"100"}})
+		require.Len(t, page.Data, 16)
+	})
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/CristianCurteanu/koken-api/internal/domains/ports"
+	"github.com/stretchr/testify/require"
+)
+
+type replaceReport struct {
+	Created        int      `json:"created"`
+	Updated        int      `json:"updated"`
+	Unchanged      int      `json:"unchanged"`
+	Failed         int      `json:"failed"`
+	Removed        int      `json:"removed"`
+	RemovedPorts   []string `json:"removed_ports"`
+	RemovalSkipped bool     `json:"removal_skipped"`
+	DryRun         bool     `json:"dry_run"`
+}
+
+func uploadPorts(t *testing.T, router http.Handler, query url.Values, fixture string) (int, replaceReport) {
+	resp := httptest.NewRecorder()
+	req, err := formFileUpload("/ports?"+query.Encode(), "ports", fixture)
+	require.NoError(t, err)
+	router.ServeHTTP(resp, req)
+
+	var report replaceReport
+	if resp.Code < 300 {
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+	}
+	return resp.Code, report
+}
+
+func TestPortsUploadReplace(t *testing.T) {
+	t.Run("preview removed ports on dry run", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		code, report := uploadPorts(t, router, url.Values{"mode": {"replace"}, "dry_run": {"true"}}, "./fixtures/success.json")
+		require.Equal(t, http.StatusOK, code)
+		require.True(t, report.DryRun)
+		require.Equal(t, 13, report.Removed)
+		require.Contains(t, report.RemovedPorts, "SGSIN")
+		require.NotContains(t, report.RemovedPorts, "AEDXB")
+		require.Zero(t, report.Created+report.Updated+report.Unchanged)
+
+		_, page := getPortsPage(t, router, url.Values{"limit": {"100"}})
+		require.Len(t, page.Data, 16)
+	})
+
+	t.Run("remove ports missing from file", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		code, report := uploadPorts(t, router, url.Values{"mode": {"replace"}}, "./fixtures/success.json")
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, 13, report.Removed)
+		require.Equal(t, 2, report.Created)
+
+		_, page := getPortsPage(t, router, url.Values{"limit": {"100"}, "include_deleted": {"true"}})
+		require.Len(t, page.Data, 5)
+	})
+
+	t.Run("soft delete ports missing from file", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json", ports.WithSoftDelete(true))
+
+		code, report := uploadPorts(t, router, url.Values{"mode": {"replace"}}, "./fixtures/success.json")
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, 13, report.Removed)
+
+		_, page := getPortsPage(t, router, url.Values{"limit": {"100"}})
+		require.Len(t, page.Data, 5)
+		_, page = getPortsPage(t, router, url.Values{"limit": {"100"}, "include_deleted": {"true"}})
+		require.Len(t, page.Data, 18)
+	})
+
+	t.Run("remove nothing if some ports fail", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		resp := bodyUpload(t, router, "/ports?mode=replace", "application/json", []byte(`{
+			"AEAJM": {"name": "Ajman", "country": "United Arab Emirates", "timezone": "Asia/Dubai"},
+			"AEDXB": {"country": "United Arab Emirates", "timezone": "Asia/Dubai"}
+		}`))
+		require.Equal(t, http.StatusMultiStatus, resp.Code)
+
+		var report replaceReport
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+		require.Equal(t, 1, report.Failed)
+		require.True(t, report.RemovalSkipped)
+		require.Zero(t, report.Removed)
+
+		_, page := getPortsPage(t, router, url.Values{"limit": {"100"}})
+		require.Len(t, page.Data, 17)
+	})
+
+	t.Run("fail if file has no ports", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+		resp := bodyUpload(t, router, "/ports?mode=replace", "application/json", []byte(`{}`))
+		require.Equal(t, http.StatusBadRequest, resp.Code)
+		require.Contains(t, resp.Body.String(), "empty_file")
+
+		_, page := getPortsPage(t, router, url.Values{"limit": {"100"}})
+		require.Len(t, page.Data, 16)
+	})
+
+	t.Run("fail if mode is not valid", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		for _, query := range []url.Values{
+			{"mode": {"merge"}},
+			{"dry_run": {"true"}},
+			{"mode": {"replace"}, "dry_run": {"maybe"}},
+		} {
+			code, _ := uploadPorts(t, router, query, "./fixtures/success.json")
+			require.Equal(t, http.StatusBadRequest, code, query.Encode())
+		}
+	})
+}
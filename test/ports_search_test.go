@@ -0,0 +1,51 @@
+package test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortsSearch(t *testing.T) {
+	router := uploadedPortsRouter(t, "./fixtures/world.json")
+
+	for _, tc := range []struct {
+		text  string
+		codes []string
+	}{
+		{"Abu Dhabi", []string{"AEAUH"}},
+		{"Abu Zaby", []string{"AEAUH"}},
+		{"jebel ali", []string{"AEJEA"}},
+		{"Mina", []string{"AEJEA"}},
+		{"dubai", []string{"AEDXB", "AEJEA"}},
+		{"Singapur", []string{"SGSIN"}},
+		{"Rotterdan", []string{"NLRTM"}},
+		{"sao paulo", []string{"BRSSZ"}},
+		{"Atlantis", nil},
+	} {
+		t.Run(tc.text, func(t *testing.T) {
+			code, codes, _ := getGeoPorts(t, router, "/ports/search", url.Values{"q": {tc.text}})
+			require.Equal(t, http.StatusOK, code)
+			require.Equal(t, tc.codes, codes)
+		})
+	}
+
+	t.Run("limit the number of ports", func(t *testing.T) {
+		code, codes, _ := getGeoPorts(t, router, "/ports/search", url.Values{"q": {"dubai"}, "limit": {"1"}})
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, []string{"AEDXB"}, codes)
+	})
+
+	t.Run("fail if query is not valid", func(t *testing.T) {
+		for _, query := range []url.Values{
+			{},
+			{"q": {"  "}},
+			{"q": {"dubai"}, "limit": {"101"}},
+		} {
+			code, _, _ := getGeoPorts(t, router, "/ports/search", query)
+			require.Equal(t, http.StatusBadRequest, code, query.Encode())
+		}
+	})
+}
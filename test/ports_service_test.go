@@ -30,6 +30,7 @@ func TestPortsFileUpload(t *testing.T) {
 		router.ServeHTTP(resp, req)
 
 		require.Equal(t, http.StatusCreated, resp.Code)
+		require.Contains(t, resp.Body.String(), `"created":5`)
 
 		resp = httptest.NewRecorder()
 		req, err = http.NewRequest(http.MethodGet, "/ports/AEJEA", nil)
@@ -87,7 +88,7 @@ func TestPortsFileUpload(t *testing.T) {
 
 	t.Run("fail if service is not storing data correctly", func(t *testing.T) {
 		serviceMock := new(MockPortsService)
-		serviceMock.On("CreateOrUpdateMany", mock.Anything, mock.Anything).Return(errors.New("store failed error"))
+		serviceMock.On("CreateOrUpdateFrom", mock.Anything, mock.Anything).Return(ports.ImportResult{}, errors.New("store failed error"))
 		router := httpApi.NewRouter(
 			httpApi.PortHandlers(serviceMock),
 		)
@@ -101,6 +102,56 @@ func TestPortsFileUpload(t *testing.T) {
 		body := resp.Body.String()
 		require.Contains(t, body, "err_data_store")
 	})
+
+	t.Run("report unchanged ports on repeated upload", func(t *testing.T) {
+		router := httpApi.NewRouter(
+			httpApi.PortHandlers(ports.NewPortService(ports.NewPortRepository(ports.StorageTypeInMem, inmemory.NewInMemoryStorage()))),
+		)
+		for i := 0; i < 2; i++ {
+			resp := httptest.NewRecorder()
+			req, err := formFileUpload("/ports", "ports", "./fixtures/success.json")
+			require.NoError(t, err)
+			router.ServeHTTP(resp, req)
+
+			require.Equal(t, http.StatusCreated, resp.Code)
+			if i == 1 {
+				require.Contains(t, resp.Body.String(), `"created":0,"updated":0,"unchanged":5,"failed":0`)
+			}
+		}
+	})
+
+	t.Run("report failed ports with multi-status", func(t *testing.T) {
+		serviceMock := new(MockPortsService)
+		serviceMock.On("CreateOrUpdateFrom", mock.Anything, mock.Anything).Return(ports.ImportResult{
+			Created:  4,
+			Failed:   1,
+			Failures: []ports.ImportFailure{{PortCode: "AEJEA", Reason: "write failed"}},
+		}, nil)
+		router := httpApi.NewRouter(
+			httpApi.PortHandlers(serviceMock),
+		)
+		resp := httptest.NewRecorder()
+		req, err := formFileUpload("/ports", "ports", "./fixtures/success.json")
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusMultiStatus, resp.Code)
+		require.Contains(t, resp.Body.String(), `"failures":[{"port_code":"AEJEA","reason":"write failed"}]`)
+	})
+
+	t.Run("report invalid ports as failed, and store the rest", func(t *testing.T) {
+		router := httpApi.NewRouter(
+			httpApi.PortHandlers(ports.NewPortService(ports.NewPortRepository(ports.StorageTypeInMem, inmemory.NewInMemoryStorage()))),
+		)
+		resp := httptest.NewRecorder()
+		req, err := formFileUpload("/ports", "ports", "./fixtures/validate.json")
+		require.NoError(t, err)
+		router.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusMultiStatus, resp.Code)
+		require.Contains(t, resp.Body.String(), `"created":3`)
+		require.Contains(t, resp.Body.String(), `"failures":[{"port_code":"AEQIW","reason":"invalid port: AEQIW.name: is required"}]`)
+	})
 }
 
 type MockPortsService struct {
@@ -112,16 +163,81 @@ func (m *MockPortsService) GetByPortCode(ctx context.Context, code string) (port
 	return args.Get(0).(ports.Port), args.Error(1)
 }
 
+func (m *MockPortsService) List(ctx context.Context, query ports.ListQuery) (ports.Page, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).(ports.Page), args.Error(1)
+}
+
+func (m *MockPortsService) Nearby(ctx context.Context, query ports.NearbyQuery) ([]ports.NearbyPort, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).([]ports.NearbyPort), args.Error(1)
+}
+
+func (m *MockPortsService) Within(ctx context.Context, query ports.WithinQuery) ([]ports.Port, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).([]ports.Port), args.Error(1)
+}
+
+func (m *MockPortsService) Search(ctx context.Context, query ports.SearchQuery) ([]ports.Port, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).([]ports.Port), args.Error(1)
+}
+
+func (m *MockPortsService) Autocomplete(ctx context.Context, query ports.AutocompleteQuery) ([]ports.Port, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).([]ports.Port), args.Error(1)
+}
+
+func (m *MockPortsService) Delete(ctx context.Context, code string) error {
+	args := m.Called(ctx, code)
+	return args.Error(0)
+}
+
+func (m *MockPortsService) Restore(ctx context.Context, code string) (ports.Port, error) {
+	args := m.Called(ctx, code)
+	return args.Get(0).(ports.Port), args.Error(1)
+}
+
+func (m *MockPortsService) Replace(ctx context.Context, port ports.Port) (ports.Port, bool, error) {
+	args := m.Called(ctx, port)
+	return args.Get(0).(ports.Port), args.Bool(1), args.Error(2)
+}
+
+func (m *MockPortsService) Patch(ctx context.Context, code string, patch ports.PortPatch) (ports.Port, error) {
+	args := m.Called(ctx, code, patch)
+	return args.Get(0).(ports.Port), args.Error(1)
+}
+
+func (m *MockPortsService) Validate(ctx context.Context, src ports.PortSource) (ports.ValidationReport, error) {
+	args := m.Called(ctx, src)
+	return args.Get(0).(ports.ValidationReport), args.Error(1)
+}
+
 func (m *MockPortsService) CreateOrUpdate(ctx context.Context, port ports.Port) error {
 	args := m.Called(ctx, port)
 	return args.Error(0)
 }
 
-func (m *MockPortsService) CreateOrUpdateMany(ctx context.Context, ports []ports.Port) error {
-	args := m.Called(ctx, ports)
+func (m *MockPortsService) CreateOrUpdateMany(ctx context.Context, pts []ports.Port) (ports.ImportResult, error) {
+	args := m.Called(ctx, pts)
+	return args.Get(0).(ports.ImportResult), args.Error(1)
+}
+
+func (m *MockPortsService) CreateOrUpdateFrom(ctx context.Context, src ports.PortSource, opts ...ports.ImportOption) (ports.ImportResult, error) {
+	args := m.Called(ctx, src)
+	return args.Get(0).(ports.ImportResult), args.Error(1)
+}
+
+func (m *MockPortsService) Export(ctx context.Context, filter ports.Filter, fn func(ports.Port) error) error {
+	args := m.Called(ctx, filter)
 	return args.Error(0)
 }
 
+func (m *MockPortsService) NormalizeCountries(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
 func formFileUpload(uri string, paramName, path string) (*http.Request, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -0,0 +1,199 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type portBody struct {
+	PortCode    string    `json:"port_code"`
+	Name        string    `json:"name"`
+	City        string    `json:"city"`
+	Country     string    `json:"country"`
+	Province    string    `json:"province"`
+	Alias       []string  `json:"alias"`
+	Coordinates []float64 `json:"coordinates"`
+	Timezone    string    `json:"timezone"`
+}
+
+func sendPortRequestBody(t *testing.T, router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	require.NoError(t, err)
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func sendPortBody(t *testing.T, router http.Handler, method, path, body string) (int, portBody) {
+	resp := sendPortRequestBody(t, router, method, path, body)
+
+	var port portBody
+	if resp.Code < 300 {
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &port))
+	}
+	return resp.Code, port
+}
+
+func getPort(t *testing.T, router http.Handler, code string) portBody {
+	status, port := sendPortBody(t, router, http.MethodGet, "/ports/"+code, "")
+	require.Equal(t, http.StatusOK, status)
+	return port
+}
+
+func TestPortsReplace(t *testing.T) {
+	router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+	t.Run("replace port, removing missing fields", func(t *testing.T) {
+		code, port := sendPortBody(t, router, http.MethodPut, "/ports/AEAJM", `{"name": "Ajman Port", "country": "United Arab Emirates", "timezone": "Asia/Dubai"}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "Ajman Port", port.Name)
+
+		port = getPort(t, router, "AEAJM")
+		require.Equal(t, portBody{PortCode: "AEAJM", Name: "Ajman Port", Country: "United Arab Emirates", Timezone: "Asia/Dubai"}, port)
+	})
+
+	t.Run("create missing port", func(t *testing.T) {
+		code, _ := sendPortBody(t, router, http.MethodPut, "/ports/AEKLF", `{"port_code": "AEKLF", "name": "Khor Fakkan", "country": "United Arab Emirates"}`)
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, "Khor Fakkan", getPort(t, router, "AEKLF").Name)
+	})
+
+	t.Run("report a single creation of concurrently replaced port", func(t *testing.T) {
+		codes := make(chan int, 10)
+		var wg sync.WaitGroup
+		for i := 0; i < cap(codes); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				code, _ := sendPortBody(t, router, http.MethodPut, "/ports/AESHJ", `{"name": "Sharjah", "country": "United Arab Emirates"}`)
+				codes <- code
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		created := 0
+		for code := range codes {
+			if code == http.StatusCreated {
+				created++
+			}
+		}
+		require.Equal(t, 1, created)
+	})
+
+	t.Run("fail if body is not valid", func(t *testing.T) {
+		for _, body := range []string{
+			``,
+			`null`,
+			`["Ajman"]`,
+			`{"name": 5}`,
+			`{"port_code": "AEDXB", "name": "Ajman"}`,
+			`{"name": "Ajman", "harbour_master": "John"}`,
+		} {
+			code, _ := sendPortBody(t, router, http.MethodPut, "/ports/AEAJM", body)
+			require.Equal(t, http.StatusBadRequest, code, body)
+		}
+	})
+
+	t.Run("reject invalid port with the broken rules", func(t *testing.T) {
+		resp := sendPortRequestBody(t, router, http.MethodPut, "/ports/AEAJM", `{"name": "Ajman", "coordinates": [55.51], "timezone": "Asia/Ajman"}`)
+		require.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+
+		var apiErr struct {
+			Code    string `json:"code"`
+			Details []struct {
+				PortCode string `json:"port_code"`
+				Field    string `json:"field"`
+				Message  string `json:"message"`
+			} `json:"details"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &apiErr))
+		require.Equal(t, "invalid_port", apiErr.Code)
+
+		var fields []string
+		for _, detail := range apiErr.Details {
+			require.Equal(t, "AEAJM", detail.PortCode)
+			fields = append(fields, detail.Field)
+		}
+		require.Equal(t, []string{"country", "coordinates", "timezone"}, fields)
+		require.Equal(t, "Ajman Port", getPort(t, router, "AEAJM").Name)
+	})
+
+	t.Run("reject port code, that is not a UN/LOCODE", func(t *testing.T) {
+		code, _ := sendPortBody(t, router, http.MethodPut, "/ports/AE-01", `{"name": "Nowhere", "country": "United Arab Emirates"}`)
+		require.Equal(t, http.StatusUnprocessableEntity, code)
+	})
+}
+
+func TestPortsPatch(t *testing.T) {
+	router := uploadedPortsRouter(t, "./fixtures/success.json")
+	before := getPort(t, router, "AEAJM")
+
+	t.Run("update only given fields", func(t *testing.T) {
+		code, port := sendPortBody(t, router, http.MethodPatch, "/ports/AEAJM", `{"timezone": "Asia/Muscat"}`)
+		require.Equal(t, http.StatusOK, code)
+
+		expected := before
+		expected.Timezone = "Asia/Muscat"
+		require.Equal(t, expected, port)
+		require.Equal(t, expected, getPort(t, router, "AEAJM"))
+	})
+
+	t.Run("replace lists and remove null fields", func(t *testing.T) {
+		code, port := sendPortBody(t, router, http.MethodPatch, "/ports/AEAJM", `{"alias": ["Ajman Port"], "coordinates": null}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, []string{"Ajman Port"}, port.Alias)
+		require.Nil(t, port.Coordinates)
+		require.Equal(t, before.Name, port.Name)
+	})
+
+	t.Run("keep the fields of concurrent patches", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for _, body := range []string{`{"city": "Ajman City"}`, `{"timezone": "Asia/Dubai"}`, `{"alias": ["Ajman Port"]}`} {
+			wg.Add(1)
+			go func(body string) {
+				defer wg.Done()
+				code, _ := sendPortBody(t, router, http.MethodPatch, "/ports/AEAJM", body)
+				require.Equal(t, http.StatusOK, code)
+			}(body)
+		}
+		wg.Wait()
+
+		port := getPort(t, router, "AEAJM")
+		require.Equal(t, "Ajman City", port.City)
+		require.Equal(t, "Asia/Dubai", port.Timezone)
+		require.Equal(t, []string{"Ajman Port"}, port.Alias)
+	})
+
+	t.Run("accept empty patch", func(t *testing.T) {
+		code, port := sendPortBody(t, router, http.MethodPatch, "/ports/AEAJM", `{}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "AEAJM", port.PortCode)
+	})
+
+	t.Run("fail if port is missing", func(t *testing.T) {
+		code, _ := sendPortBody(t, router, http.MethodPatch, "/ports/XXXXX", `{"name": "Atlantis"}`)
+		require.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("reject patch, that makes the port invalid", func(t *testing.T) {
+		for _, body := range []string{`{"name": null}`, `{"timezone": "Mars/Olympus"}`, `{"unlocs": ["AE-AJM"]}`, `{"coordinates": [55.51, 125.4]}`} {
+			code, _ := sendPortBody(t, router, http.MethodPatch, "/ports/AEAJM", body)
+			require.Equal(t, http.StatusUnprocessableEntity, code, body)
+		}
+		require.Equal(t, before.Name, getPort(t, router, "AEAJM").Name)
+	})
+
+	t.Run("fail if patch is not valid", func(t *testing.T) {
+		for _, body := range []string{`"Ajman"`, `{"coordinates": "north"}`, `{"country_code": "AE"}`} {
+			code, _ := sendPortBody(t, router, http.MethodPatch, "/ports/AEAJM", body)
+			require.Equal(t, http.StatusBadRequest, code, body)
+		}
+	})
+}
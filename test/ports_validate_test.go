@@ -0,0 +1,133 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type validationReport struct {
+	Valid   bool `json:"valid"`
+	Summary struct {
+		New       int `json:"new"`
+		Changed   int `json:"changed"`
+		Unchanged int `json:"unchanged"`
+		Invalid   int `json:"invalid"`
+	} `json:"summary"`
+	New     []string `json:"new"`
+	Changed []struct {
+		PortCode string `json:"port_code"`
+		Diffs    []struct {
+			Field string      `json:"field"`
+			Old   interface{} `json:"old"`
+			New   interface{} `json:"new"`
+		} `json:"diffs"`
+	} `json:"changed"`
+	Unchanged []string `json:"unchanged"`
+	Errors    []struct {
+		PortCode string `json:"port_code"`
+		Line     int    `json:"line"`
+		Field    string `json:"field"`
+		Message  string `json:"message"`
+	} `json:"errors"`
+	Warnings []struct {
+		PortCode string `json:"port_code"`
+		Message  string `json:"message"`
+	} `json:"warnings"`
+}
+
+func validatePorts(t *testing.T, router http.Handler, fixture string) (int, validationReport) {
+	resp := httptest.NewRecorder()
+	req, err := formFileUpload("/ports/validate", "ports", fixture)
+	require.NoError(t, err)
+	router.ServeHTTP(resp, req)
+
+	var report validationReport
+	if resp.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+	}
+	return resp.Code, report
+}
+
+func TestPortsValidate(t *testing.T) {
+	t.Run("report changes and errors without writing", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		code, report := validatePorts(t, router, "./fixtures/validate.json")
+		require.Equal(t, http.StatusOK, code)
+		require.False(t, report.Valid)
+		require.Equal(t, []string{"AEKLF"}, report.New)
+		require.Equal(t, []string{"AEAJM"}, report.Unchanged)
+
+		require.Len(t, report.Changed, 1)
+		require.Equal(t, "AEDXB", report.Changed[0].PortCode)
+		require.Len(t, report.Changed[0].Diffs, 2)
+		require.Equal(t, "alias", report.Changed[0].Diffs[0].Field)
+		require.Nil(t, report.Changed[0].Diffs[0].Old)
+		require.Equal(t, []interface{}{"Port Rashid"}, report.Changed[0].Diffs[0].New)
+		require.Equal(t, "timezone", report.Changed[0].Diffs[1].Field)
+		require.Equal(t, "Asia/Dubai", report.Changed[0].Diffs[1].Old)
+		require.Equal(t, "Asia/Muscat", report.Changed[0].Diffs[1].New)
+
+		require.Len(t, report.Errors, 1)
+		require.Equal(t, "AEQIW", report.Errors[0].PortCode)
+		require.Equal(t, "name", report.Errors[0].Field)
+		require.Equal(t, 1, report.Summary.Invalid)
+
+		require.Equal(t, "Asia/Dubai", getPort(t, router, "AEDXB").Timezone)
+		require.Equal(t, http.StatusNotFound, sendPortRequest(t, router, http.MethodGet, "/ports/AEKLF").Code)
+	})
+
+	t.Run("report valid file", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		code, report := validatePorts(t, router, "./fixtures/success.json")
+		require.Equal(t, http.StatusOK, code)
+		require.True(t, report.Valid)
+		require.Equal(t, 5, report.Summary.Unchanged)
+		require.Empty(t, report.New)
+		require.Empty(t, report.Changed)
+	})
+
+	t.Run("report malformed records by line", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		file, err := os.Open("./fixtures/partial.ndjson")
+		require.NoError(t, err)
+		defer file.Close()
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/ports/validate", file)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var report validationReport
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+		require.False(t, report.Valid)
+		require.Equal(t, 3, report.Summary.Unchanged)
+		require.NotEmpty(t, report.Errors)
+		require.Equal(t, "AEKLF", report.Errors[0].PortCode)
+		require.Equal(t, 2, report.Errors[0].Line)
+		require.Equal(t, 3, report.Summary.Invalid)
+	})
+
+	t.Run("fail if file is not valid json", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		code, _ := validatePorts(t, router, "./fixtures/fail_non_json.json")
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("fail if there is no file", func(t *testing.T) {
+		router := uploadedPortsRouter(t, "./fixtures/success.json")
+
+		code := sendPortRequest(t, router, http.MethodPost, "/ports/validate").Code
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+}